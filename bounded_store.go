@@ -0,0 +1,335 @@
+package hcat
+
+import (
+	"container/list"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cacheOwner is implemented by Cachers that track which entries are owned,
+// ie. kept up to date, by one of the Watcher's views. The Watcher calls Own
+// when it starts watching a dependency and Disown when it stops.
+type cacheOwner interface {
+	Own(id string)
+	Disown(id string)
+}
+
+// BoundedStore is a Cacher with a budget on the number of entries and their
+// approximate memory size.
+//
+// Entries owned by a Watcher's view are always kept, as templates rely on
+// them being up to date. When over budget, the least recently used entries
+// no view owns are evicted first. Unowned entries, which are no longer kept
+// up to date, also expire after a TTL.
+//
+// Recall returns the data saved for an entry as long as it is neither
+// deleted, evicted nor expired.
+type BoundedStore struct {
+	mux sync.Mutex
+
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	sizeFunc   func(interface{}) int64
+	now        func() time.Time
+
+	entries map[string]*list.Element
+	// lru orders the entries by use, most recently used first.
+	lru   *list.List
+	bytes int64
+	// owned are the IDs of the entries owned by views.
+	owned map[string]struct{}
+
+	hits, misses, evictions, expirations uint64
+}
+
+// BoundedStoreInput is used as input to the NewBoundedStore function.
+type BoundedStoreInput struct {
+	// MaxEntries is the maximum number of entries. Zero means no limit.
+	MaxEntries int
+	// MaxBytes is the maximum approximate memory size of the entries' data.
+	// Zero means no limit.
+	MaxBytes int64
+	// TTL is how long unowned entries are kept after they were last saved.
+	// Zero means they don't expire.
+	TTL time.Duration
+	// SizeFunc returns the size of the data in bytes. Defaults to an
+	// estimate of the memory used by the value.
+	SizeFunc func(interface{}) int64
+}
+
+// CacheStats are statistics of a BoundedStore.
+type CacheStats struct {
+	// Entries is the number of entries, Owned the number owned by views.
+	Entries int `json:"entries"`
+	Owned   int `json:"owned"`
+	// Bytes is the approximate memory size of the entries' data.
+	Bytes int64 `json:"bytes"`
+	// Hits and Misses count the Recall calls.
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Evictions counts entries evicted to stay within budget, Expirations
+	// entries removed as their TTL passed.
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+// cacheEntry is a single entry of the BoundedStore.
+type cacheEntry struct {
+	id    string
+	data  interface{}
+	size  int64
+	saved time.Time
+}
+
+// NewBoundedStore creates a new BoundedStore.
+func NewBoundedStore(i BoundedStoreInput) *BoundedStore {
+	sizeFunc := i.SizeFunc
+	if sizeFunc == nil {
+		sizeFunc = sizeOf
+	}
+	return &BoundedStore{
+		maxEntries: i.MaxEntries,
+		maxBytes:   i.MaxBytes,
+		ttl:        i.TTL,
+		sizeFunc:   sizeFunc,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		owned:      make(map[string]struct{}),
+	}
+}
+
+// Save stores the data for the dependency, evicting unowned entries if the
+// store is over budget.
+func (s *BoundedStore) Save(id string, data interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	e := &cacheEntry{
+		id:    id,
+		data:  data,
+		size:  s.sizeFunc(data),
+		saved: s.now(),
+	}
+	if el, ok := s.entries[id]; ok {
+		s.bytes -= el.Value.(*cacheEntry).size
+		el.Value = e
+		s.lru.MoveToFront(el)
+	} else {
+		s.entries[id] = s.lru.PushFront(e)
+	}
+	s.bytes += e.size
+	s.evict()
+}
+
+// Recall gets the current value for the given dependency.
+func (s *BoundedStore) Recall(id string) (interface{}, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	el, ok := s.entries[id]
+	if ok && s.expired(el.Value.(*cacheEntry)) {
+		s.remove(el)
+		s.expirations++
+		ok = false
+	}
+	if !ok {
+		s.misses++
+		return nil, false
+	}
+	s.hits++
+	s.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).data, true
+}
+
+// Delete removes the data of the dependency.
+func (s *BoundedStore) Delete(id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+}
+
+// Reset clears all stored data and ownership.
+func (s *BoundedStore) Reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.entries = make(map[string]*list.Element)
+	s.lru.Init()
+	s.bytes = 0
+	s.owned = make(map[string]struct{})
+}
+
+// Own marks the entry as owned by a view, so it is never evicted.
+func (s *BoundedStore) Own(id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.owned[id] = struct{}{}
+}
+
+// Disown marks the entry as no longer owned by a view.
+func (s *BoundedStore) Disown(id string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.owned, id)
+	s.evict()
+}
+
+// Keys returns the sorted IDs of all dependencies with data in the store.
+func (s *BoundedStore) Keys() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	keys := make([]string, 0, len(s.entries))
+	for k := range s.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Stats returns the store's statistics.
+func (s *BoundedStore) Stats() CacheStats {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	owned := 0
+	for id := range s.owned {
+		if _, ok := s.entries[id]; ok {
+			owned++
+		}
+	}
+	return CacheStats{
+		Entries:     len(s.entries),
+		Owned:       owned,
+		Bytes:       s.bytes,
+		Hits:        s.hits,
+		Misses:      s.misses,
+		Evictions:   s.evictions,
+		Expirations: s.expirations,
+	}
+}
+
+// expired returns true if the entry's TTL passed. The caller must hold the
+// lock.
+func (s *BoundedStore) expired(e *cacheEntry) bool {
+	if s.ttl <= 0 {
+		return false
+	}
+	if _, owned := s.owned[e.id]; owned {
+		return false
+	}
+	return s.now().Sub(e.saved) > s.ttl
+}
+
+// overBudget returns true if the store exceeds either budget. The caller
+// must hold the lock.
+func (s *BoundedStore) overBudget() bool {
+	return (s.maxEntries > 0 && len(s.entries) > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+// evict removes expired entries, then the least recently used unowned
+// entries until the store is within budget. Owned entries are kept even if
+// that leaves the store over budget. The caller must hold the lock.
+func (s *BoundedStore) evict() {
+	var next *list.Element
+	for el := s.lru.Back(); el != nil; el = next {
+		next = el.Prev()
+		e := el.Value.(*cacheEntry)
+		if s.expired(e) {
+			s.remove(el)
+			s.expirations++
+		}
+	}
+	for el := s.lru.Back(); el != nil && s.overBudget(); el = next {
+		next = el.Prev()
+		e := el.Value.(*cacheEntry)
+		if _, owned := s.owned[e.id]; owned {
+			continue
+		}
+		s.remove(el)
+		s.evictions++
+	}
+}
+
+// remove removes the entry. The caller must hold the lock.
+func (s *BoundedStore) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*cacheEntry)
+	delete(s.entries, e.id)
+	s.bytes -= e.size
+}
+
+// sizeOf estimates the memory used by the value, following pointers, slices
+// and maps. Shared pointers are only counted once.
+func sizeOf(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	seen := make(map[uintptr]struct{})
+	return sizeOfValue(reflect.ValueOf(v), seen)
+}
+
+func sizeOfValue(v reflect.Value, seen map[uintptr]struct{}) int64 {
+	size := int64(v.Type().Size())
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return size
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return size
+		}
+		seen[v.Pointer()] = struct{}{}
+		return size + sizeOfValue(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return size
+		}
+		return size + sizeOfValue(v.Elem(), seen)
+	case reflect.String:
+		return size + int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() {
+			return size
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return size
+		}
+		seen[v.Pointer()] = struct{}{}
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), seen)
+		}
+		// unused capacity
+		size += int64(v.Cap()-v.Len()) * int64(v.Type().Elem().Size())
+		return size
+	case reflect.Array:
+		size = 0
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() {
+			return size
+		}
+		if _, ok := seen[v.Pointer()]; ok {
+			return size
+		}
+		seen[v.Pointer()] = struct{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOfValue(iter.Key(), seen) + sizeOfValue(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		size = 0
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), seen)
+		}
+		return size
+	}
+	return size
+}
@@ -0,0 +1,169 @@
+package hcat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestBoundedStore(t *testing.T) {
+	t.Parallel()
+	unitSize := func(interface{}) int64 { return 1 }
+
+	t.Run("max-entries", func(t *testing.T) {
+		st := NewBoundedStore(BoundedStoreInput{MaxEntries: 2})
+		st.Save("a", 1)
+		st.Save("b", 2)
+		st.Recall("a") // b is now the least recently used
+		st.Save("c", 3)
+
+		if keys := st.Keys(); !reflect.DeepEqual(keys, []string{"a", "c"}) {
+			t.Fatalf("bad keys: %v", keys)
+		}
+		if s := st.Stats(); s.Evictions != 1 {
+			t.Fatalf("expected 1 eviction, got %#v", s)
+		}
+	})
+	t.Run("owned-kept", func(t *testing.T) {
+		st := NewBoundedStore(BoundedStoreInput{MaxEntries: 1})
+		st.Own("a")
+		st.Own("b")
+		st.Save("a", 1)
+		st.Save("b", 2)
+
+		if keys := st.Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+			t.Fatalf("owned entries should not be evicted: %v", keys)
+		}
+		st.Disown("a")
+		if keys := st.Keys(); !reflect.DeepEqual(keys, []string{"b"}) {
+			t.Fatalf("disowned entry should be evicted: %v", keys)
+		}
+	})
+	t.Run("max-bytes", func(t *testing.T) {
+		st := NewBoundedStore(BoundedStoreInput{
+			MaxBytes: 10,
+			SizeFunc: func(v interface{}) int64 { return int64(len(v.(string))) },
+		})
+		st.Save("a", "12345")
+		st.Save("b", "123456")
+
+		if keys := st.Keys(); !reflect.DeepEqual(keys, []string{"b"}) {
+			t.Fatalf("bad keys: %v", keys)
+		}
+		if s := st.Stats(); s.Bytes != 6 {
+			t.Fatalf("expected 6 bytes, got %#v", s)
+		}
+		st.Save("b", "1")
+		if s := st.Stats(); s.Bytes != 1 {
+			t.Fatalf("expected 1 byte after replacing, got %#v", s)
+		}
+	})
+	t.Run("ttl", func(t *testing.T) {
+		now := time.Now()
+		st := NewBoundedStore(BoundedStoreInput{TTL: time.Minute})
+		st.now = func() time.Time { return now }
+		st.Save("unowned", 1)
+		st.Own("owned")
+		st.Save("owned", 2)
+		// eg. of a blocking query whose view stopped
+		st.Own("disowned")
+		st.Save("disowned", 3)
+		st.Disown("disowned")
+
+		now = now.Add(2 * time.Minute)
+		if _, ok := st.Recall("unowned"); ok {
+			t.Fatal("expected unowned entry to expire")
+		}
+		if _, ok := st.Recall("owned"); !ok {
+			t.Fatal("owned entry should not expire")
+		}
+		if _, ok := st.Recall("disowned"); ok {
+			t.Fatal("expected disowned entry to expire")
+		}
+		st.Disown("owned")
+		if keys := st.Keys(); len(keys) != 0 {
+			t.Fatalf("bad keys: %v", keys)
+		}
+		if s := st.Stats(); s.Expirations != 3 {
+			t.Fatalf("expected 3 expirations, got %#v", s)
+		}
+	})
+	t.Run("stats", func(t *testing.T) {
+		st := NewBoundedStore(BoundedStoreInput{SizeFunc: unitSize})
+		st.Own("a")
+		st.Save("a", 1)
+		st.Save("b", 2)
+		st.Recall("a")
+		st.Recall("b")
+		st.Recall("c")
+
+		exp := CacheStats{Entries: 2, Owned: 1, Bytes: 2, Hits: 2, Misses: 1}
+		if s := st.Stats(); !reflect.DeepEqual(s, exp) {
+			t.Fatalf("bad stats:\n%#v\nexpected:\n%#v", s, exp)
+		}
+	})
+	t.Run("delete-reset", func(t *testing.T) {
+		st := NewBoundedStore(BoundedStoreInput{SizeFunc: unitSize})
+		st.Save("a", 1)
+		st.Save("b", 2)
+		st.Delete("a")
+		if _, ok := st.Recall("a"); ok {
+			t.Fatal("expected deleted entry to be gone")
+		}
+		st.Reset()
+		if s := st.Stats(); s.Entries != 0 || s.Bytes != 0 {
+			t.Fatalf("expected empty store, got %#v", s)
+		}
+	})
+	t.Run("size-of", func(t *testing.T) {
+		small := sizeOf([]string{"a"})
+		large := sizeOf([]string{"a", "0123456789"})
+		if small <= 0 || large <= small {
+			t.Fatalf("bad sizes: %d, %d", small, large)
+		}
+		s := "0123456789"
+		shared := sizeOf([]*string{&s, &s})
+		if shared >= sizeOf([]*string{&s})+int64(len(s)) {
+			t.Fatalf("shared pointer counted twice: %d", shared)
+		}
+	})
+}
+
+func TestWatcherBoundedStore(t *testing.T) {
+	st := NewBoundedStore(BoundedStoreInput{MaxEntries: 1})
+	w := NewWatcher(WatcherInput{
+		Clients: NewClientSet(),
+		Cache:   st,
+	})
+	defer w.Close()
+
+	foo := &idep.FakeDep{Name: "foo"}
+	w.Register("tmpl", foo)
+	if err := w.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s := st.Stats(); s.Owned != 1 {
+		t.Fatalf("expected the watched entry to be owned: %#v", s)
+	}
+
+	// removed dependencies keep their data, unowned
+	w.depTracker.forget("tmpl")
+	if !w.remove(foo.String()) {
+		t.Fatal("expected dependency to be removed")
+	}
+	if _, ok := st.Recall(foo.String()); !ok {
+		t.Fatal("expected data to be kept")
+	}
+	if s := st.Stats(); s.Owned != 0 {
+		t.Fatalf("expected the entry to be unowned: %#v", s)
+	}
+
+	// registering it again watches it
+	w.Register("tmpl", foo)
+	if !w.Watching(foo.String()) {
+		t.Fatal("expected the registered dependency to be watched")
+	}
+}
@@ -1,6 +1,7 @@
 package hcat
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -12,7 +13,20 @@ type timers struct {
 	timers   map[string]*timer
 	buffered map[string]bool
 	ch       chan string
-	mux      sync.RWMutex
+	// group is the set of goroutines halted by the next Stop.
+	group *runGroup
+	mux   sync.RWMutex
+}
+
+// runGroup is a set of goroutines that are stopped and joined together.
+type runGroup struct {
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	running bool // the Run loop is running
+}
+
+func newRunGroup() *runGroup {
+	return &runGroup{stopCh: make(chan struct{})}
 }
 
 // timer is an internal representation of a single buffer state.
@@ -21,6 +35,7 @@ type timer struct {
 	min      time.Duration
 	max      time.Duration
 	ch       chan string
+	group    *runGroup
 	timer    *time.Timer
 	deadline time.Time
 
@@ -33,27 +48,57 @@ func newTimers() *timers {
 		timers:   make(map[string]*timer),
 		buffered: make(map[string]bool),
 		ch:       make(chan string, 10),
+		group:    newRunGroup(),
 	}
 }
 
 // Run is a blocking function to monitor timers and notify the channel
-// a buffer period has completed.
+// a buffer period has completed. It returns when Stop is called.
 func (t *timers) Run(triggerCh chan string) {
+	t.mux.Lock()
+	g := t.group
+	g.wg.Add(1)
+	t.mux.Unlock()
+	t.run(g, triggerCh)
+}
+
+// Start runs the monitoring of timers in the background until Stop is
+// called. It is a no-op if it is already running.
+func (t *timers) Start(triggerCh chan string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	g := t.group
+	if g.running {
+		return
+	}
+	g.running = true
+	g.wg.Add(1)
+	go t.run(g, triggerCh)
+}
+
+func (t *timers) run(g *runGroup, triggerCh chan string) {
+	defer g.wg.Done()
 	for {
-		id, ok := <-t.ch
-		if !ok {
+		select {
+		case id := <-t.ch:
+			t.mux.Lock()
+			t.buffered[id] = true
+			t.mux.Unlock()
+			select {
+			case triggerCh <- id:
+			case <-g.stopCh:
+				return
+			}
+		case <-g.stopCh:
 			return
 		}
-		t.mux.Lock()
-		t.buffered[id] = true
-		t.mux.Unlock()
-		triggerCh <- id
 	}
 }
 
 // Stop sends a signal to halt monitoring of timers and clears out any active
-// timers.
-func (t *timers) Stop() {
+// timers. The returned channel is closed once all of the goroutines have
+// exited. The timers can be used, and run, again after stopping.
+func (t *timers) Stop() <-chan struct{} {
 	t.mux.Lock()
 	defer t.mux.Unlock()
 
@@ -61,6 +106,48 @@ func (t *timers) Stop() {
 		timer.stop()
 		delete(t.timers, id)
 	}
+
+	g := t.group
+	t.group = newRunGroup()
+	close(g.stopCh)
+	doneCh := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(doneCh)
+	}()
+	return doneCh
+}
+
+// bufferStatus is a snapshot of a template's buffer period state.
+type bufferStatus struct {
+	id       string
+	active   bool
+	deadline time.Time
+	// buffered is true if the buffer period completed and the template is
+	// waiting to be rendered.
+	buffered bool
+}
+
+// status returns a snapshot of all timers sorted by ID.
+func (t *timers) status() []bufferStatus {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+
+	result := make([]bufferStatus, 0, len(t.timers))
+	for id, timer := range t.timers {
+		timer.mux.RLock()
+		result = append(result, bufferStatus{
+			id:       id,
+			active:   timer.isActive,
+			deadline: timer.deadline,
+			buffered: t.buffered[id],
+		})
+		timer.mux.RUnlock()
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id < result[j].id
+	})
+	return result
 }
 
 // Add a new timer and returns if the timer was added.
@@ -72,7 +159,7 @@ func (t *timers) Add(min, max time.Duration, id string) bool {
 		return false
 	}
 
-	t.timers[id] = newTimer(t.ch, min, max, id)
+	t.timers[id] = newTimer(t.ch, t.group, min, max, id)
 	return true
 }
 
@@ -105,12 +192,13 @@ func (t *timers) Buffer(id string) bool {
 }
 
 // newTimer creates a new buffer timer for the given template.
-func newTimer(ch chan string, min, max time.Duration, id string) *timer {
+func newTimer(ch chan string, g *runGroup, min, max time.Duration, id string) *timer {
 	return &timer{
-		id:  id,
-		min: min,
-		max: max,
-		ch:  ch,
+		id:    id,
+		min:   min,
+		max:   max,
+		ch:    ch,
+		group: g,
 	}
 }
 
@@ -141,7 +229,7 @@ func (t *timer) active() bool {
 }
 
 // inactiveTick is the first tick of a buffer period, set up the timer and
-// calculate the max deadline.
+// calculate the max deadline. The caller must hold the timers' lock.
 func (t *timer) inactiveTick(now time.Time) {
 	if t.timer == nil {
 		t.timer = time.NewTimer(t.min)
@@ -154,12 +242,25 @@ func (t *timer) inactiveTick(now time.Time) {
 	t.deadline = now.Add(t.max) // reset the deadline ot the future
 	t.mux.Unlock()
 
+	g := t.group
+	g.wg.Add(1)
 	go func() {
-		<-t.timer.C
+		defer g.wg.Done()
+		select {
+		case <-t.timer.C:
+		case <-g.stopCh:
+			return
+		}
+		// The period is over once the timer fired, a tick while waiting to
+		// send starts a new one. The lock isn't held while sending as status
+		// and Stop take it and the send blocks while the consumer does.
 		t.mux.Lock()
-		t.ch <- t.id
 		t.isActive = false
 		t.mux.Unlock()
+		select {
+		case t.ch <- t.id:
+		case <-g.stopCh:
+		}
 	}()
 }
 
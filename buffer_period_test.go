@@ -1,6 +1,7 @@
 package hcat
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -127,6 +128,38 @@ func TestBufferPeriod(t *testing.T) {
 		}
 	})
 
+	t.Run("blocked consumer", func(t *testing.T) {
+		t.Parallel()
+
+		// nothing reads the trigger channel, so the timers' channel fills up
+		// and the timer goroutines block sending
+		triggerCh := make(chan string)
+		bufferPeriods := newTimers()
+		bufferPeriods.Start(triggerCh)
+
+		n := cap(bufferPeriods.ch) + 2
+		for i := 0; i < n; i++ {
+			id := fmt.Sprint("tmpl", i)
+			bufferPeriods.Add(time.Millisecond, time.Millisecond, id)
+			bufferPeriods.Buffer(id)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for _, st := range bufferPeriods.status() {
+				assert.False(t, st.active, st.id)
+			}
+			<-bufferPeriods.Stop()
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			assert.Fail(t, "status and Stop blocked by the timers")
+		}
+	})
+
 	t.Run("stop unused timers", func(t *testing.T) {
 		t.Parallel()
 
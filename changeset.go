@@ -0,0 +1,117 @@
+package hcat
+
+import (
+	"context"
+	"sort"
+)
+
+// ChangeSet describes what changed during a Wait.
+type ChangeSet struct {
+	// Dependencies are the dependencies whose data changed, sorted by ID.
+	Dependencies []DependencyChange
+	// Buffered are the sorted IDs of the templates whose buffer period
+	// completed, or that were otherwise triggered to run again.
+	Buffered []string
+	// Templates are the sorted IDs of all templates affected by the changes,
+	// ie. those using a changed dependency and those in Buffered. Templates
+	// not yet registered with the Watcher are not included.
+	Templates []string
+}
+
+// DependencyChange is a change to a dependency's data.
+type DependencyChange struct {
+	// ID is the dependency's ID (its String() value).
+	ID string
+	// OldIndex is the last index of the data before the change, zero if
+	// this is the dependency's first data.
+	OldIndex uint64
+	// NewIndex is the last index of the changed data.
+	NewIndex uint64
+	// Templates are the sorted IDs of the templates using the dependency.
+	Templates []string
+}
+
+// Empty returns true if nothing changed.
+func (c ChangeSet) Empty() bool {
+	return len(c.Dependencies) == 0 && len(c.Buffered) == 0
+}
+
+// WaitChanges is Wait, also returning what changed. Only the templates in the
+// ChangeSet's Templates need to be run again.
+func (w *Watcher) WaitChanges(ctx context.Context) (ChangeSet, error) {
+	err := w.Wait(ctx)
+	return w.changeSet(), err
+}
+
+// resetChanges clears the changes recorded during the last Wait.
+func (w *Watcher) resetChanges() {
+	w.changesMx.Lock()
+	defer w.changesMx.Unlock()
+	w.changes = make(map[string]DependencyChange)
+	w.triggered = make(map[string]struct{})
+}
+
+// recordChange records the dependency's new index, keeping its old index if
+// it changes more than once during a Wait.
+func (w *Watcher) recordChange(id string, index uint64) {
+	w.changesMx.Lock()
+	defer w.changesMx.Unlock()
+	old := w.indexes[id]
+	w.indexes[id] = index
+	c, ok := w.changes[id]
+	if !ok {
+		c = DependencyChange{ID: id, OldIndex: old}
+	}
+	c.NewIndex = index
+	w.changes[id] = c
+}
+
+// recordTrigger records that the template was triggered to run again.
+func (w *Watcher) recordTrigger(tmplID string) {
+	w.changesMx.Lock()
+	defer w.changesMx.Unlock()
+	w.triggered[tmplID] = struct{}{}
+}
+
+// forgetIndex drops the dependency's last index when it is no longer
+// watched.
+func (w *Watcher) forgetIndex(id string) {
+	w.changesMx.Lock()
+	defer w.changesMx.Unlock()
+	delete(w.indexes, id)
+}
+
+// resetIndexes drops the last indexes of all dependencies.
+func (w *Watcher) resetIndexes() {
+	w.changesMx.Lock()
+	defer w.changesMx.Unlock()
+	w.indexes = make(map[string]uint64)
+}
+
+// changeSet returns the changes recorded during the last Wait.
+func (w *Watcher) changeSet() ChangeSet {
+	w.changesMx.Lock()
+	defer w.changesMx.Unlock()
+
+	var cs ChangeSet
+	templates := make(map[string]struct{})
+	for _, c := range w.changes {
+		c.Templates = w.depTracker.depTemplates(c.ID)
+		for _, id := range c.Templates {
+			templates[id] = struct{}{}
+		}
+		cs.Dependencies = append(cs.Dependencies, c)
+	}
+	sort.Slice(cs.Dependencies, func(i, j int) bool {
+		return cs.Dependencies[i].ID < cs.Dependencies[j].ID
+	})
+	for id := range w.triggered {
+		cs.Buffered = append(cs.Buffered, id)
+		templates[id] = struct{}{}
+	}
+	sort.Strings(cs.Buffered)
+	if len(templates) > 0 {
+		cs.Templates = sortedKeys(templates)
+	}
+	return cs
+}
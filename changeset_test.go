@@ -0,0 +1,89 @@
+package hcat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestWatcherWaitChanges(t *testing.T) {
+	t.Run("dependencies", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		foo := &idep.FakeDep{Name: "foo"}
+		bar := &idep.FakeDep{Name: "bar"}
+		w.Register("tmpl-a", foo)
+		w.Register("tmpl-b", foo, bar)
+		w.Register("tmpl-c", &idep.FakeDep{Name: "unchanged"})
+		w.Add(foo)
+
+		cs, err := w.WaitChanges(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := ChangeSet{
+			Dependencies: []DependencyChange{{
+				ID:        foo.String(),
+				OldIndex:  0,
+				NewIndex:  1,
+				Templates: []string{"tmpl-a", "tmpl-b"},
+			}},
+			Templates: []string{"tmpl-a", "tmpl-b"},
+		}
+		if !reflect.DeepEqual(cs, exp) {
+			t.Fatalf("bad change set:\n%#v\nexpected:\n%#v", cs, exp)
+		}
+	})
+	t.Run("indexes", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		w.recordChange("foo", 5)
+		w.resetChanges()
+		w.recordChange("foo", 7)
+		w.recordChange("foo", 9)
+		cs := w.changeSet()
+		if len(cs.Dependencies) != 1 {
+			t.Fatalf("bad change set: %#v", cs)
+		}
+		if c := cs.Dependencies[0]; c.OldIndex != 5 || c.NewIndex != 9 {
+			t.Fatalf("bad indexes: %#v", c)
+		}
+
+		w.forgetIndex("foo")
+		w.resetChanges()
+		w.recordChange("foo", 3)
+		if c := w.changeSet().Dependencies[0]; c.OldIndex != 0 {
+			t.Fatalf("index should have been forgotten: %#v", c)
+		}
+	})
+	t.Run("buffered", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		w.bufferTrigger <- "tmpl"
+		cs, err := w.WaitChanges(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := ChangeSet{Buffered: []string{"tmpl"}, Templates: []string{"tmpl"}}
+		if !reflect.DeepEqual(cs, exp) {
+			t.Fatalf("bad change set: %#v", cs)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		w.recordChange("foo", 1)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		cs, err := w.WaitChanges(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cs.Empty() {
+			t.Fatalf("expected no changes, got: %#v", cs)
+		}
+	})
+}
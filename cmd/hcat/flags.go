@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcat"
+)
+
+// config is the configuration of a run, from the command line.
+type config struct {
+	templates []templateSpec
+
+	consul hcat.ConsulInput
+	vault  hcat.VaultInput
+	// vaultRenewToken watches the Vault token to keep it renewed
+	vaultRenewToken bool
+
+	// once exits after all the templates have rendered
+	once bool
+	// dry writes the rendered templates to stdout
+	dry bool
+
+	perms          os.FileMode
+	createDestDirs bool
+	backup         bool
+}
+
+// templateSpec is a template given as a source:destination pair.
+type templateSpec struct {
+	source string
+	dest   string
+}
+
+func (s templateSpec) String() string {
+	return s.source + ":" + s.dest
+}
+
+// parseTemplateSpec parses a source:destination pair. A Windows volume name
+// on the source, eg. C:, is not taken as the separator.
+func parseTemplateSpec(s string) (templateSpec, error) {
+	vol := filepath.VolumeName(s)
+	i := strings.Index(s[len(vol):], ":")
+	if i < 0 {
+		return templateSpec{}, fmt.Errorf("invalid template %q: expected source:destination", s)
+	}
+	i += len(vol)
+	spec := templateSpec{source: s[:i], dest: s[i+1:]}
+	if spec.source == "" || spec.dest == "" {
+		return templateSpec{}, fmt.Errorf("invalid template %q: expected source:destination", s)
+	}
+	return spec, nil
+}
+
+// templatesFlag is a repeatable -template flag.
+type templatesFlag []templateSpec
+
+func (f *templatesFlag) String() string {
+	specs := make([]string, len(*f))
+	for i, s := range *f {
+		specs[i] = s.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f *templatesFlag) Set(s string) error {
+	spec, err := parseTemplateSpec(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, spec)
+	return nil
+}
+
+// permsFlag is an octal file mode flag.
+type permsFlag os.FileMode
+
+func (f *permsFlag) String() string {
+	return fmt.Sprintf("%#o", os.FileMode(*f))
+}
+
+func (f *permsFlag) Set(s string) error {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file mode %q", s)
+	}
+	*f = permsFlag(mode)
+	return nil
+}
+
+// authFlag is a username[:password] flag enabling basic auth.
+type authFlag struct{ i *hcat.ConsulInput }
+
+func (f authFlag) String() string {
+	if f.i == nil || !f.i.AuthEnabled {
+		return ""
+	}
+	return f.i.AuthUsername
+}
+
+func (f authFlag) Set(s string) error {
+	user, pass := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		user, pass = s[:i], s[i+1:]
+	}
+	f.i.AuthEnabled = true
+	f.i.AuthUsername = user
+	f.i.AuthPassword = pass
+	return nil
+}
+
+// transportFlags adds the flags of the upstream's TransportInput.
+func transportFlags(fs *flag.FlagSet, prefix string, t *hcat.TransportInput) {
+	fs.BoolVar(&t.SSLEnabled, prefix+"-ssl", false,
+		"use TLS to connect")
+	fs.BoolVar(&t.SSLVerify, prefix+"-ssl-verify", true,
+		"verify the server's certificate")
+	fs.StringVar(&t.SSLCert, prefix+"-ssl-cert", "",
+		"client certificate file for TLS")
+	fs.StringVar(&t.SSLKey, prefix+"-ssl-key", "",
+		"client key file for TLS")
+	fs.StringVar(&t.SSLCACert, prefix+"-ssl-ca-cert", "",
+		"CA certificate file to verify the server")
+	fs.StringVar(&t.SSLCAPath, prefix+"-ssl-ca-path", "",
+		"directory of CA certificates to verify the server")
+	fs.StringVar(&t.ServerName, prefix+"-ssl-server-name", "",
+		"server name to verify the server's certificate against")
+	fs.DurationVar(&t.DialTimeout, prefix+"-dial-timeout", 0,
+		"timeout to connect")
+	fs.DurationVar(&t.DialKeepAlive, prefix+"-dial-keep-alive", 0,
+		"keep-alive period of connections")
+	fs.DurationVar(&t.TLSHandshakeTimeout, prefix+"-tls-handshake-timeout", 0,
+		"timeout of the TLS handshake")
+	fs.DurationVar(&t.IdleConnTimeout, prefix+"-idle-conn-timeout", 0,
+		"time idle connections are kept")
+	fs.IntVar(&t.MaxIdleConns, prefix+"-max-idle-conns", 0,
+		"maximum number of idle connections")
+	fs.IntVar(&t.MaxIdleConnsPerHost, prefix+"-max-idle-conns-per-host", 0,
+		"maximum number of idle connections per host")
+	fs.BoolVar(&t.DisableKeepAlives, prefix+"-disable-keep-alives", false,
+		"use a new connection for each request")
+}
+
+const usage = `Usage: hcat [options] [source:destination ...]
+
+  Renders the templates with data from Consul and Vault, re-rendering them
+  as the data changes. Templates are given as source:destination pairs,
+  either as arguments or with -template.
+
+  The Consul and Vault addresses and tokens default to the CONSUL_HTTP_ADDR,
+  CONSUL_HTTP_TOKEN, VAULT_ADDR and VAULT_TOKEN environment variables.
+
+Options:
+`
+
+// parseFlags parses the command line. Environment variables, read with
+// getenv, give the defaults of the upstreams' addresses and tokens.
+func parseFlags(args []string, getenv func(string) string, out io.Writer) (*config, error) {
+	c := &config{perms: 0644}
+	var templates templatesFlag
+	perms := permsFlag(c.perms)
+
+	fs := flag.NewFlagSet("hcat", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprint(out, usage)
+		fs.PrintDefaults()
+	}
+
+	fs.Var(&templates, "template",
+		"template as source:destination, can be repeated")
+	fs.BoolVar(&c.once, "once", false,
+		"exit after all the templates have rendered")
+	fs.BoolVar(&c.dry, "dry", false,
+		"write the rendered templates to stdout instead of their destinations")
+	fs.Var(&perms, "perms",
+		"file mode of the rendered templates")
+	fs.BoolVar(&c.createDestDirs, "create-dest-dirs", true,
+		"create missing parent directories of the destinations")
+	fs.BoolVar(&c.backup, "backup", false,
+		"keep a .bak copy of the destinations before rendering")
+
+	fs.StringVar(&c.consul.Address, "consul-addr", getenv("CONSUL_HTTP_ADDR"),
+		"address of Consul, disabled if empty")
+	fs.StringVar(&c.consul.Token, "consul-token", getenv("CONSUL_HTTP_TOKEN"),
+		"Consul ACL token")
+	fs.StringVar(&c.consul.Namespace, "consul-namespace", getenv("CONSUL_NAMESPACE"),
+		"Consul namespace")
+	fs.Var(authFlag{&c.consul}, "consul-auth",
+		"Consul basic auth as username[:password]")
+	transportFlags(fs, "consul", &c.consul.Transport)
+
+	fs.StringVar(&c.vault.Address, "vault-addr", getenv("VAULT_ADDR"),
+		"address of Vault, disabled if empty")
+	fs.StringVar(&c.vault.Token, "vault-token", getenv("VAULT_TOKEN"),
+		"Vault token")
+	fs.StringVar(&c.vault.Namespace, "vault-namespace", getenv("VAULT_NAMESPACE"),
+		"Vault namespace")
+	fs.BoolVar(&c.vault.UnwrapToken, "vault-unwrap-token", false,
+		"unwrap the Vault token, which is a wrapped token")
+	fs.BoolVar(&c.vaultRenewToken, "vault-renew-token", true,
+		"keep renewing the Vault token")
+	transportFlags(fs, "vault", &c.vault.Transport)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	for _, arg := range fs.Args() {
+		if err := templates.Set(arg); err != nil {
+			return nil, err
+		}
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no templates given")
+	}
+	c.templates = templates
+	c.perms = os.FileMode(perms)
+	return c, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseTemplateSpec(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		exp  templateSpec
+		err  bool
+	}{
+		{"pair", "in.tmpl:out.txt", templateSpec{"in.tmpl", "out.txt"}, false},
+		{"dest-with-colon", "in.tmpl:/tmp/a:b", templateSpec{"in.tmpl", "/tmp/a:b"}, false},
+		{"no-dest", "in.tmpl", templateSpec{}, true},
+		{"empty-dest", "in.tmpl:", templateSpec{}, true},
+		{"empty-source", ":out.txt", templateSpec{}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := parseTemplateSpec(tc.in)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if spec != tc.exp {
+				t.Fatalf("bad spec: %#v", spec)
+			}
+		})
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	env := map[string]string{
+		"CONSUL_HTTP_ADDR":  "consul.example:8500",
+		"CONSUL_HTTP_TOKEN": "consul-token",
+		"VAULT_ADDR":        "https://vault.example:8200",
+	}
+	getenv := func(k string) string { return env[k] }
+	parse := func(args ...string) (*config, error) {
+		return parseFlags(args, getenv, ioutil.Discard)
+	}
+
+	t.Run("templates", func(t *testing.T) {
+		c, err := parse("-template", "a.tmpl:a", "b.tmpl:b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := []templateSpec{{"a.tmpl", "a"}, {"b.tmpl", "b"}}
+		if !reflect.DeepEqual(c.templates, exp) {
+			t.Fatalf("bad templates: %#v", c.templates)
+		}
+	})
+	t.Run("defaults", func(t *testing.T) {
+		c, err := parse("a.tmpl:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case c.consul.Address != "consul.example:8500":
+			t.Error("bad consul address:", c.consul.Address)
+		case c.consul.Token != "consul-token":
+			t.Error("bad consul token:", c.consul.Token)
+		case c.vault.Address != "https://vault.example:8200":
+			t.Error("bad vault address:", c.vault.Address)
+		case !c.vault.Transport.SSLVerify || !c.vaultRenewToken:
+			t.Error("expected verification and renewal by default")
+		case c.perms != 0644 || !c.createDestDirs:
+			t.Errorf("bad file defaults: %#v", c)
+		case c.once || c.dry:
+			t.Error("expected daemon mode by default")
+		}
+	})
+	t.Run("upstreams", func(t *testing.T) {
+		c, err := parse(
+			"-consul-addr", "127.0.0.1:8500",
+			"-consul-auth", "user:pass",
+			"-consul-ssl", "-consul-ssl-ca-cert", "ca.pem",
+			"-vault-token", "vault-token",
+			"-vault-ssl-verify=false",
+			"-vault-dial-timeout", "5s",
+			"a.tmpl:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case c.consul.Address != "127.0.0.1:8500":
+			t.Error("bad consul address:", c.consul.Address)
+		case !c.consul.AuthEnabled || c.consul.AuthUsername != "user" ||
+			c.consul.AuthPassword != "pass":
+			t.Errorf("bad consul auth: %#v", c.consul)
+		case !c.consul.Transport.SSLEnabled ||
+			c.consul.Transport.SSLCACert != "ca.pem":
+			t.Errorf("bad consul transport: %#v", c.consul.Transport)
+		case c.vault.Token != "vault-token":
+			t.Error("bad vault token:", c.vault.Token)
+		case c.vault.Transport.SSLVerify ||
+			c.vault.Transport.DialTimeout.String() != "5s":
+			t.Errorf("bad vault transport: %#v", c.vault.Transport)
+		}
+	})
+	t.Run("modes", func(t *testing.T) {
+		c, err := parse("-once", "-dry", "-perms", "0600", "a.tmpl:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.once || !c.dry || c.perms != os.FileMode(0600) {
+			t.Errorf("bad config: %#v", c)
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		for _, args := range [][]string{
+			{},
+			{"a.tmpl"},
+			{"-perms", "rw", "a.tmpl:a"},
+			{"-nope", "a.tmpl:a"},
+		} {
+			if _, err := parse(args...); err == nil {
+				t.Errorf("expected an error for %q", args)
+			}
+		}
+	})
+}
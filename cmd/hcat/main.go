@@ -0,0 +1,30 @@
+// Command hcat renders templates with data from Consul and Vault.
+//
+// Templates are given as source:destination pairs. By default hcat runs as a
+// daemon, re-rendering the templates as their data changes. With -once it
+// exits after all templates have rendered, and with -dry it writes the
+// rendered templates to stdout instead of their destinations.
+//
+// On SIGHUP the template files are read again, keeping the watched data, and
+// on SIGINT or SIGTERM hcat exits. It exits non-zero if a template fails to
+// render or its data can't be fetched.
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+
+	c := &cli{
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+		getenv:   os.Getenv,
+		signalCh: signalCh,
+	}
+	os.Exit(c.run(os.Args[1:]))
+}
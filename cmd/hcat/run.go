@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	"github.com/hashicorp/hcat"
+	"github.com/pkg/errors"
+)
+
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// cli runs hcat with its environment, replaced in tests.
+type cli struct {
+	stdout, stderr io.Writer
+	getenv         func(string) string
+	// signalCh receives SIGHUP to reload the templates and SIGINT or
+	// SIGTERM to exit
+	signalCh <-chan os.Signal
+}
+
+// run runs hcat with the command line arguments, returning the exit code.
+func (c *cli) run(args []string) int {
+	cfg, err := parseFlags(args, c.getenv, c.stderr)
+	switch {
+	case err == flag.ErrHelp:
+		return exitOK
+	case err != nil:
+		fmt.Fprintf(c.stderr, "hcat: %s\n", err)
+		return exitUsage
+	}
+
+	r, err := newRunner(cfg, c.stdout, c.stderr)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "hcat: %s\n", err)
+		return exitError
+	}
+	defer r.stop()
+
+	if err := r.run(c.signalCh); err != nil {
+		fmt.Fprintf(c.stderr, "hcat: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runner renders the templates as their data changes.
+type runner struct {
+	cfg            *config
+	stdout, stderr io.Writer
+
+	watcher  *hcat.Watcher
+	resolver *hcat.Resolver
+
+	templates []*template
+}
+
+// template is a template being rendered to its destination.
+type template struct {
+	spec templateSpec
+	*hcat.Template
+	// rendered is true once the template has rendered
+	rendered bool
+}
+
+func newRunner(cfg *config, stdout, stderr io.Writer) (*runner, error) {
+	clients := hcat.NewClientSet()
+	if cfg.consul.Address != "" {
+		if err := clients.AddConsul(cfg.consul); err != nil {
+			return nil, errors.Wrap(err, "consul")
+		}
+	}
+	if cfg.vault.Address != "" {
+		if err := clients.AddVault(cfg.vault); err != nil {
+			return nil, errors.Wrap(err, "vault")
+		}
+	}
+
+	r := &runner{
+		cfg:    cfg,
+		stdout: stdout,
+		stderr: stderr,
+		watcher: hcat.NewWatcher(hcat.WatcherInput{
+			Clients: clients,
+			Cache:   hcat.NewStore(),
+		}),
+		resolver: hcat.NewResolver(),
+	}
+	if cfg.vault.Address != "" && cfg.vaultRenewToken {
+		if err := r.watcher.WatchVaultToken(cfg.vault.Token); err != nil {
+			r.stop()
+			return nil, err
+		}
+	}
+	templates, err := r.loadTemplates()
+	if err != nil {
+		r.stop()
+		return nil, err
+	}
+	r.templates = templates
+	return r, nil
+}
+
+// loadTemplates reads the template files.
+func (r *runner) loadTemplates() ([]*template, error) {
+	templates := make([]*template, len(r.cfg.templates))
+	for i, spec := range r.cfg.templates {
+		contents, err := ioutil.ReadFile(spec.source)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading template")
+		}
+		var renderer hcat.Renderer = dryRenderer{dest: spec.dest, w: r.stdout}
+		if !r.cfg.dry {
+			var backup hcat.BackupFunc
+			if r.cfg.backup {
+				backup = hcat.Backup
+			}
+			renderer = hcat.NewFileRenderer(hcat.FileRendererInput{
+				CreateDestDirs: r.cfg.createDestDirs,
+				Path:           spec.dest,
+				Perms:          r.cfg.perms,
+				Backup:         backup,
+			})
+		}
+		templates[i] = &template{
+			spec: spec,
+			Template: hcat.NewTemplate(hcat.TemplateInput{
+				Contents: string(contents),
+				Renderer: renderer,
+			}),
+		}
+	}
+	return templates, nil
+}
+
+// reload reads the template files again. The watcher and its cache are
+// kept, so the templates render with the data already fetched. On error
+// the current templates are kept.
+func (r *runner) reload() error {
+	templates, err := r.loadTemplates()
+	if err != nil {
+		return err
+	}
+	// forget all the current templates, so the templates are all rendered
+	// again and the dependencies no longer used are dropped
+	ids := make([]string, len(r.templates))
+	for i, t := range r.templates {
+		ids[i] = t.ID()
+	}
+	r.watcher.Deregister(ids...)
+	r.templates = templates
+	return nil
+}
+
+// run renders the templates until they have all rendered in once mode, or
+// until SIGINT or SIGTERM.
+func (r *runner) run(signalCh <-chan os.Signal) error {
+	for {
+		done, err := r.render()
+		if err != nil {
+			return err
+		}
+		if r.cfg.once && done {
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := r.watcher.WaitCh(ctx)
+		select {
+		case err := <-errCh:
+			cancel()
+			if err != nil {
+				return errors.Wrap(err, "watching data")
+			}
+		case sig := <-signalCh:
+			cancel()
+			<-errCh
+			if sig != syscall.SIGHUP {
+				return nil
+			}
+			if err := r.reload(); err != nil {
+				fmt.Fprintf(r.stderr, "hcat: reload failed, keeping templates: %s\n", err)
+			}
+		}
+	}
+}
+
+// render runs the templates, all against the same data, rendering the
+// complete ones. Returns true once all the templates have rendered.
+func (r *runner) render() (bool, error) {
+	tmpls := make([]hcat.Templater, len(r.templates))
+	for i, t := range r.templates {
+		tmpls[i] = t
+	}
+	events, err := r.resolver.RunBatch(tmpls, r.watcher)
+	if err != nil {
+		t := r.templates[len(events)]
+		return false, errors.Wrapf(err, "template %s", t.spec.source)
+	}
+
+	done := true
+	for i, event := range events {
+		t := r.templates[i]
+		if event.Complete {
+			result, err := t.Render(event.Contents)
+			if err != nil {
+				return false, errors.Wrapf(err, "rendering %s", t.spec.dest)
+			}
+			if result.DidRender {
+				fmt.Fprintf(r.stderr, "hcat: rendered %s\n", t.spec.dest)
+			}
+			t.rendered = true
+		}
+		done = done && t.rendered
+	}
+	return done, nil
+}
+
+// stop stops watching the data, closing the clients' connections.
+func (r *runner) stop() {
+	r.watcher.Close()
+}
+
+// dryRenderer writes the rendered templates to stdout, under a line with
+// their destination.
+type dryRenderer struct {
+	dest string
+	w    io.Writer
+}
+
+func (d dryRenderer) Render(contents []byte) (hcat.RenderResult, error) {
+	if _, err := fmt.Fprintf(d.w, "> %s\n%s\n", d.dest, contents); err != nil {
+		return hcat.RenderResult{}, err
+	}
+	return hcat.RenderResult{WouldRender: true}, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeConsul is a fake Consul KV store. Keys named "fail" fail with a
+// permanent error.
+type fakeConsul struct {
+	*httptest.Server
+	mu    sync.Mutex
+	index int
+	kv    map[string]string
+}
+
+func newFakeConsul(kv map[string]string) *fakeConsul {
+	c := &fakeConsul{index: 1, kv: kv}
+	c.Server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *fakeConsul) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.kv[key] = value
+	c.index++
+}
+
+func (c *fakeConsul) serve(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/v1/status/leader" {
+		rw.Write([]byte(`"127.0.0.1:8300"`))
+		return
+	}
+	key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+	if key == "fail" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// blocking queries block for a bit when there are no changes
+	if index, _ := strconv.Atoi(req.URL.Query().Get("index")); index > 0 {
+		c.mu.Lock()
+		unchanged := index >= c.index
+		c.mu.Unlock()
+		if unchanged {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rw.Header().Set("X-Consul-Index", strconv.Itoa(c.index))
+	value, ok := c.kv[key]
+	if !ok {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	fmt.Fprintf(rw, `[{"Key":%q,"Value":%q,"ModifyIndex":%d}]`,
+		key, base64.StdEncoding.EncodeToString([]byte(value)), c.index)
+}
+
+// newFakeVault returns a fake Vault serving the KV v1 secret "secret/foo",
+// counting its reads.
+func newFakeVault(reads *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/v1/secret/foo" {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			atomic.AddInt32(reads, 1)
+			rw.Write([]byte(`{"data":{"value":"s3cr3t"},"lease_duration":0}`))
+		}))
+}
+
+// testCLI returns a cli with its output captured and no environment.
+func testCLI(signalCh chan os.Signal) (*cli, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	return &cli{
+		stdout:   &stdout,
+		stderr:   &stderr,
+		getenv:   func(string) string { return "" },
+		signalCh: signalCh,
+	}, &stdout, &stderr
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForFile waits for the file to have the contents.
+func waitForFile(t *testing.T, path, contents string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := ioutil.ReadFile(path)
+		if string(got) == contents {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be %q, got %q", path, contents, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun(t *testing.T) {
+	consul := newFakeConsul(map[string]string{"foo": "bar"})
+	defer consul.Close()
+	var vaultReads int32
+	vault := newFakeVault(&vaultReads)
+	defer vault.Close()
+
+	upstreams := []string{
+		"-consul-addr", consul.URL,
+		"-vault-addr", vault.URL,
+		"-vault-token", "token",
+		"-vault-renew-token=false",
+	}
+	args := func(args ...string) []string {
+		return append(append([]string{}, upstreams...), args...)
+	}
+	const contents = `{{key "foo"}} {{with secret "secret/foo"}}{{.Data.value}}{{end}}`
+
+	t.Run("once", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "hcat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		src, dest := filepath.Join(dir, "in.tmpl"), filepath.Join(dir, "out", "out.txt")
+		writeFile(t, src, contents)
+
+		c, _, stderr := testCLI(nil)
+		if code := c.run(args("-once", src+":"+dest)); code != exitOK {
+			t.Fatalf("bad exit code %d: %s", code, stderr)
+		}
+		waitForFile(t, dest, "bar s3cr3t")
+	})
+	t.Run("dry", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "hcat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		src, dest := filepath.Join(dir, "in.tmpl"), filepath.Join(dir, "out.txt")
+		writeFile(t, src, contents)
+
+		c, stdout, stderr := testCLI(nil)
+		if code := c.run(args("-once", "-dry", src+":"+dest)); code != exitOK {
+			t.Fatalf("bad exit code %d: %s", code, stderr)
+		}
+		if exp := "> " + dest + "\nbar s3cr3t\n"; stdout.String() != exp {
+			t.Fatalf("expected %q, got %q", exp, stdout)
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Fatal("expected no file to be written in dry mode")
+		}
+	})
+	t.Run("errors", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "hcat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dest := filepath.Join(dir, "out.txt")
+		bad := filepath.Join(dir, "bad.tmpl")
+		writeFile(t, bad, `{{ key "foo" `)
+		failing := filepath.Join(dir, "failing.tmpl")
+		writeFile(t, failing, `{{ key "fail" }}`)
+
+		cases := []struct {
+			name string
+			args []string
+			code int
+		}{
+			{"usage", args("-once"), exitUsage},
+			{"missing-template", args("-once", filepath.Join(dir, "nope")+":"+dest), exitError},
+			{"parse-error", args("-once", bad+":"+dest), exitError},
+			{"fetch-error", args("-once", failing+":"+dest), exitError},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				c, _, stderr := testCLI(nil)
+				if code := c.run(tc.args); code != tc.code {
+					t.Fatalf("expected exit code %d, got %d: %s", tc.code, code, stderr)
+				}
+				if !strings.HasPrefix(stderr.String(), "hcat: ") {
+					t.Fatalf("expected an error message, got %q", stderr)
+				}
+			})
+		}
+	})
+	t.Run("daemon", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "hcat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		src, dest := filepath.Join(dir, "in.tmpl"), filepath.Join(dir, "out.txt")
+		writeFile(t, src, contents)
+		atomic.StoreInt32(&vaultReads, 0)
+
+		signalCh := make(chan os.Signal)
+		c, _, stderr := testCLI(signalCh)
+		codeCh := make(chan int, 1)
+		go func() {
+			codeCh <- c.run(args(src + ":" + dest))
+		}()
+
+		waitForFile(t, dest, "bar s3cr3t")
+		consul.set("foo", "baz")
+		waitForFile(t, dest, "baz s3cr3t")
+
+		// reloading renders the new template with the data already fetched
+		writeFile(t, src, "reloaded "+contents)
+		signalCh <- syscall.SIGHUP
+		waitForFile(t, dest, "reloaded baz s3cr3t")
+		if n := atomic.LoadInt32(&vaultReads); n != 1 {
+			t.Errorf("expected the secret to be read once, got %d reads", n)
+		}
+
+		signalCh <- syscall.SIGTERM
+		select {
+		case code := <-codeCh:
+			if code != exitOK {
+				t.Fatalf("bad exit code %d: %s", code, stderr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for exit")
+		}
+	})
+}
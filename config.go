@@ -0,0 +1,733 @@
+package hcat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/pkg/errors"
+)
+
+// Config is a declarative configuration of the clients, watcher and
+// templates, loaded from an HCL or JSON file. For example:
+//
+//	consul {
+//	  address = "127.0.0.1:8500"
+//	  retry {
+//	    attempts = 5
+//	    backoff  = "500ms"
+//	  }
+//	}
+//
+//	vault {
+//	  address = "https://vault.service.consul:8200"
+//	  ssl {
+//	    ca_cert = "/etc/vault/ca.pem"
+//	  }
+//	}
+//
+//	template {
+//	  source      = "/etc/app/config.tmpl"
+//	  destination = "/etc/app/config.json"
+//	  perms       = "0600"
+//	  wait {
+//	    min = "2s"
+//	    max = "10s"
+//	  }
+//	}
+//
+// Use Build to create all of them, or the Input methods to create only some.
+type Config struct {
+	// Consul and Vault configure the clients, nil if not configured.
+	Consul *ConsulConfig
+	Vault  *VaultConfig
+
+	// StaleOnErrorMaxAge, see WatcherInput.
+	StaleOnErrorMaxAge time.Duration
+
+	// Wait is the default buffer period of the templates, nil for none.
+	Wait *WaitConfig
+
+	Templates []*TemplateConfig
+}
+
+// ConsulConfig is the configuration of the Consul client and its views,
+// from the `consul` block.
+type ConsulConfig struct {
+	ConsulInput
+	MaxStale            time.Duration
+	BlockWait           time.Duration
+	KVCoalesceThreshold int
+	RateLimit           RateLimitInput
+	// RetryFunc is nil for the watcher's default.
+	RetryFunc ErrorRetryFunc
+}
+
+// VaultConfig is the configuration of the Vault client and its views, from
+// the `vault` block.
+type VaultConfig struct {
+	VaultInput
+	DefaultLease time.Duration
+	// RenewToken watches the token to keep it renewed, it defaults to true.
+	RenewToken bool
+	RateLimit  RateLimitInput
+	// RetryFunc is nil for the watcher's default.
+	RetryFunc ErrorRetryFunc
+}
+
+// WaitConfig is a buffer period, see Watcher.SetBufferPeriod.
+type WaitConfig struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// TemplateConfig is the configuration of a template rendered to a file, from
+// a `template` block.
+type TemplateConfig struct {
+	// Source is the path of the template file, or Contents the template.
+	Source   string
+	Contents string
+
+	// Destination is the path of the rendered file.
+	Destination    string
+	Perms          os.FileMode
+	CreateDestDirs bool
+	Backup         bool
+
+	LeftDelim     string
+	RightDelim    string
+	ErrMissingKey bool
+	SandboxPath   string
+
+	// DecryptKeyFile is the age identity file of the decrypt functions.
+	DecryptKeyFile string
+
+	// Wait is the buffer period of the template, defaults to the Config's.
+	Wait *WaitConfig
+
+	// pos is the position of the block, for errors.
+	pos configPos
+}
+
+// LoadConfig loads the configuration file, in HCL or JSON. Errors in the
+// file are returned as ConfigErrors.
+func LoadConfig(path string) (*Config, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "config")
+	}
+	return ParseConfig(path, src)
+}
+
+// ParseConfig parses the configuration, in HCL or JSON. The filename is only
+// used in errors. Errors in the configuration are returned as ConfigErrors.
+func ParseConfig(filename string, src []byte) (*Config, error) {
+	f, err := hcl.ParseBytes(src)
+	if err != nil {
+		pos := configPos{Filename: filename}
+		var perr *parser.PosError
+		if errors.As(err, &perr) {
+			pos.Line, pos.Column = perr.Pos.Line, perr.Pos.Column
+			err = perr.Err
+		}
+		return nil, ConfigErrors{{configPos: pos, Err: err}}
+	}
+	root, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, ConfigErrors{{configPos: configPos{Filename: filename},
+			Err: errors.New("expected an object")}}
+	}
+
+	d := &configDecoder{filename: filename}
+	c := d.config(root)
+	if len(d.errs) > 0 {
+		return nil, d.errs
+	}
+	return c, nil
+}
+
+// ConfigError is an error in a configuration, at a position in the file.
+type ConfigError struct {
+	configPos
+	Err error
+}
+
+// configPos is a position in a configuration file. Line is zero if unknown.
+type configPos struct {
+	Filename     string
+	Line, Column int
+}
+
+func (p configPos) String() string {
+	s := p.Filename
+	if p.Line > 0 {
+		s = fmt.Sprintf("%s:%d:%d", s, p.Line, p.Column)
+	}
+	return strings.TrimPrefix(s, ":")
+}
+
+func (e *ConfigError) Error() string {
+	if pos := e.configPos.String(); pos != "" {
+		return pos + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors are all the errors found in a configuration.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Input returns the input for ClientSet.AddConsul.
+func (c *ConsulConfig) Input() ConsulInput {
+	return c.ConsulInput
+}
+
+// Input returns the input for ClientSet.AddVault.
+func (c *VaultConfig) Input() VaultInput {
+	return c.VaultInput
+}
+
+// ClientSet returns a client set with the configured clients.
+func (c *Config) ClientSet() (*ClientSet, error) {
+	clients := NewClientSet()
+	if c.Consul != nil {
+		if err := clients.AddConsul(c.Consul.Input()); err != nil {
+			return nil, errors.Wrap(err, "consul")
+		}
+	}
+	if c.Vault != nil {
+		if err := clients.AddVault(c.Vault.Input()); err != nil {
+			return nil, errors.Wrap(err, "vault")
+		}
+	}
+	return clients, nil
+}
+
+// WatcherInput returns the input for NewWatcher, using the clients and a new
+// Store as the cache.
+func (c *Config) WatcherInput(clients Looker) WatcherInput {
+	i := WatcherInput{
+		Clients:            clients,
+		Cache:              NewStore(),
+		StaleOnErrorMaxAge: c.StaleOnErrorMaxAge,
+	}
+	if c.Consul != nil {
+		i.ConsulMaxStale = c.Consul.MaxStale
+		i.ConsulBlockWait = c.Consul.BlockWait
+		i.ConsulKVCoalesceThreshold = c.Consul.KVCoalesceThreshold
+		i.ConsulRateLimit = c.Consul.RateLimit
+		i.ConsulErrorRetryFunc = c.Consul.RetryFunc
+	}
+	if c.Vault != nil {
+		i.VaultDefaultLease = c.Vault.DefaultLease
+		i.VaultRateLimit = c.Vault.RateLimit
+		i.VaultErrorRetryFunc = c.Vault.RetryFunc
+	}
+	return i
+}
+
+// TemplateInput returns the input for NewTemplate, reading the template's
+// source file, with a FileRenderer for its destination.
+func (t *TemplateConfig) TemplateInput() (TemplateInput, error) {
+	contents := t.Contents
+	if t.Source != "" {
+		b, err := ioutil.ReadFile(t.Source)
+		if err != nil {
+			return TemplateInput{}, &ConfigError{configPos: t.pos,
+				Err: errors.Wrap(err, "template")}
+		}
+		contents = string(b)
+	}
+	var backup BackupFunc
+	if t.Backup {
+		backup = Backup
+	}
+	return TemplateInput{
+		Contents:       contents,
+		ErrMissingKey:  t.ErrMissingKey,
+		LeftDelim:      t.LeftDelim,
+		RightDelim:     t.RightDelim,
+		SandboxPath:    t.SandboxPath,
+		DecryptKeyFile: t.DecryptKeyFile,
+		Renderer: NewFileRenderer(FileRendererInput{
+			CreateDestDirs: t.CreateDestDirs,
+			Path:           t.Destination,
+			Perms:          t.Perms,
+			Backup:         backup,
+		}),
+	}, nil
+}
+
+// BuildResult is returned by Config.Build.
+type BuildResult struct {
+	Clients *ClientSet
+	Watcher *Watcher
+	// Templates are in the order of the Config's Templates.
+	Templates []*Template
+}
+
+// Build creates the client set, the watcher and the templates, setting the
+// templates' buffer periods on the watcher and watching the Vault token if
+// it is to be renewed.
+func (c *Config) Build() (*BuildResult, error) {
+	clients, err := c.ClientSet()
+	if err != nil {
+		return nil, err
+	}
+	w := NewWatcher(c.WatcherInput(clients))
+	if c.Vault != nil && c.Vault.RenewToken {
+		if err := w.WatchVaultToken(c.Vault.Token); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+
+	templates := make([]*Template, len(c.Templates))
+	for i, tc := range c.Templates {
+		input, err := tc.TemplateInput()
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		templates[i] = NewTemplate(input)
+
+		wait := tc.Wait
+		if wait == nil {
+			wait = c.Wait
+		}
+		if wait != nil && wait.Min > 0 {
+			w.SetBufferPeriod(wait.Min, wait.Max, templates[i].ID())
+		}
+	}
+	return &BuildResult{Clients: clients, Watcher: w, Templates: templates}, nil
+}
+
+// configDecoder decodes a configuration from its syntax tree, collecting
+// the errors.
+type configDecoder struct {
+	filename string
+	errs     ConfigErrors
+}
+
+// pos returns the position of the node of the item, or of the item if n is
+// nil. JSON has no positions for keys and values so the item's assignment
+// is used.
+func (d *configDecoder) pos(item *ast.ObjectItem, n ast.Node) configPos {
+	var p token.Pos
+	if n != nil {
+		p = n.Pos()
+	}
+	if !p.IsValid() {
+		p = item.Pos()
+	}
+	if !p.IsValid() {
+		p = item.Assign
+	}
+	return configPos{Filename: d.filename, Line: p.Line, Column: p.Column}
+}
+
+// errorf reports an error at the node of the item, see pos.
+func (d *configDecoder) errorf(item *ast.ObjectItem, n ast.Node, format string, args ...interface{}) {
+	d.errs = append(d.errs, &ConfigError{
+		configPos: d.pos(item, n),
+		Err:       fmt.Errorf(format, args...),
+	})
+}
+
+// fields calls the field's function for each item of the object, reporting
+// unknown and duplicate keys. Keys in repeated may be repeated.
+func (d *configDecoder) fields(
+	block string, list *ast.ObjectList, fields map[string]func(*ast.ObjectItem),
+	repeated ...string,
+) {
+	seen := make(map[string]bool)
+	for _, item := range list.Items {
+		key := itemKey(item)
+		f, ok := fields[key]
+		switch {
+		case !ok:
+			d.errorf(item, nil, "%s: unknown key %q", block, key)
+			continue
+		case len(item.Keys) > 1:
+			d.errorf(item, item.Keys[1], "%s: unexpected label on %q", block, key)
+			continue
+		case seen[key] && !containsString(repeated, key):
+			d.errorf(item, nil, "%s: duplicate key %q", block, key)
+			continue
+		}
+		seen[key] = true
+		f(item)
+	}
+}
+
+func itemKey(item *ast.ObjectItem) string {
+	if len(item.Keys) == 0 {
+		return ""
+	}
+	if s, ok := item.Keys[0].Token.Value().(string); ok {
+		return s
+	}
+	return item.Keys[0].Token.Text
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// blocks returns the objects of a block, which is a list of objects in JSON.
+func (d *configDecoder) blocks(item *ast.ObjectItem) []*ast.ObjectList {
+	switch v := item.Val.(type) {
+	case *ast.ObjectType:
+		return []*ast.ObjectList{v.List}
+	case *ast.ListType:
+		var lists []*ast.ObjectList
+		for _, n := range v.List {
+			o, ok := n.(*ast.ObjectType)
+			if !ok {
+				d.errorf(item, n, "%s: expected a block", itemKey(item))
+				return nil
+			}
+			lists = append(lists, o.List)
+		}
+		return lists
+	}
+	d.errorf(item, item.Val, "%s: expected a block", itemKey(item))
+	return nil
+}
+
+// block calls f with the block's object, it must be a single one.
+func (d *configDecoder) block(item *ast.ObjectItem, f func(*ast.ObjectList)) {
+	lists := d.blocks(item)
+	if len(lists) > 1 {
+		d.errorf(item, nil, "%s: expected a single block", itemKey(item))
+		return
+	}
+	for _, l := range lists {
+		f(l)
+	}
+}
+
+// literal returns the item's value if it is a literal of one of the types.
+func (d *configDecoder) literal(item *ast.ObjectItem, what string, types ...token.Type) (interface{}, bool) {
+	if lit, ok := item.Val.(*ast.LiteralType); ok {
+		for _, t := range types {
+			if lit.Token.Type == t {
+				return lit.Token.Value(), true
+			}
+		}
+	}
+	d.errorf(item, item.Val, "%s: expected %s", itemKey(item), what)
+	return nil, false
+}
+
+func (d *configDecoder) str(dst *string) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		if v, ok := d.literal(item, "a string", token.STRING, token.HEREDOC); ok {
+			*dst = v.(string)
+		}
+	}
+}
+
+func (d *configDecoder) boolean(dst *bool) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		if v, ok := d.literal(item, "a boolean", token.BOOL); ok {
+			*dst = v.(bool)
+		}
+	}
+}
+
+func (d *configDecoder) integer(dst *int) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		v, ok := d.literal(item, "a number", token.NUMBER)
+		if !ok {
+			return
+		}
+		if n := v.(int64); n >= 0 {
+			*dst = int(n)
+			return
+		}
+		d.errorf(item, item.Val, "%s: expected a positive number", itemKey(item))
+	}
+}
+
+func (d *configDecoder) float(dst *float64) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		v, ok := d.literal(item, "a number", token.NUMBER, token.FLOAT)
+		if !ok {
+			return
+		}
+		switch n := v.(type) {
+		case int64:
+			*dst = float64(n)
+		case float64:
+			*dst = n
+		}
+		if *dst < 0 {
+			d.errorf(item, item.Val, "%s: expected a positive number", itemKey(item))
+		}
+	}
+}
+
+func (d *configDecoder) duration(dst *time.Duration) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		v, ok := d.literal(item, `a duration, eg. "5s"`, token.STRING)
+		if !ok {
+			return
+		}
+		dur, err := time.ParseDuration(v.(string))
+		switch {
+		case err != nil:
+			d.errorf(item, item.Val, "%s: invalid duration %q", itemKey(item), v)
+		case dur < 0:
+			d.errorf(item, item.Val, "%s: negative duration %q", itemKey(item), v)
+		default:
+			*dst = dur
+		}
+	}
+}
+
+// perms decodes a file mode, an octal string or a number.
+func (d *configDecoder) perms(dst *os.FileMode) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		v, ok := d.literal(item, `a file mode, eg. "0644"`, token.STRING, token.NUMBER)
+		if !ok {
+			return
+		}
+		var mode uint64
+		var err error
+		switch v := v.(type) {
+		case string:
+			mode, err = strconv.ParseUint(v, 8, 32)
+		case int64:
+			mode = uint64(v)
+		}
+		if err != nil || mode > uint64(os.ModePerm) {
+			d.errorf(item, item.Val, "perms: invalid file mode %v", v)
+			return
+		}
+		*dst = os.FileMode(mode)
+	}
+}
+
+func (d *configDecoder) config(root *ast.ObjectList) *Config {
+	c := &Config{}
+	d.fields("config", root, map[string]func(*ast.ObjectItem){
+		"consul": func(item *ast.ObjectItem) {
+			d.block(item, func(l *ast.ObjectList) { c.Consul = d.consul(l) })
+		},
+		"vault": func(item *ast.ObjectItem) {
+			d.block(item, func(l *ast.ObjectList) { c.Vault = d.vault(l) })
+		},
+		"stale_on_error_max_age": d.duration(&c.StaleOnErrorMaxAge),
+		"wait": func(item *ast.ObjectItem) {
+			d.block(item, func(l *ast.ObjectList) { c.Wait = d.wait(item, l) })
+		},
+		"template": func(item *ast.ObjectItem) {
+			for _, l := range d.blocks(item) {
+				c.Templates = append(c.Templates, d.template(item, l))
+			}
+		},
+	}, "template")
+	return c
+}
+
+func (d *configDecoder) consul(l *ast.ObjectList) *ConsulConfig {
+	c := &ConsulConfig{}
+	c.Transport.SSLVerify = true
+	d.fields("consul", l, map[string]func(*ast.ObjectItem){
+		"address":   d.str(&c.Address),
+		"namespace": d.str(&c.Namespace),
+		"token":     d.str(&c.Token),
+		"auth": func(item *ast.ObjectItem) {
+			d.block(item, func(l *ast.ObjectList) {
+				var enabled *bool
+				d.fields("auth", l, map[string]func(*ast.ObjectItem){
+					"enabled": func(item *ast.ObjectItem) {
+						enabled = new(bool)
+						d.boolean(enabled)(item)
+					},
+					"username": d.str(&c.AuthUsername),
+					"password": d.str(&c.AuthPassword),
+				})
+				c.AuthEnabled = c.AuthUsername != ""
+				if enabled != nil {
+					c.AuthEnabled = *enabled
+				}
+			})
+		},
+		"max_stale":             d.duration(&c.MaxStale),
+		"block_wait":            d.duration(&c.BlockWait),
+		"kv_coalesce_threshold": d.integer(&c.KVCoalesceThreshold),
+		"ssl":                   d.ssl(&c.Transport),
+		"transport":             d.transport(&c.Transport),
+		"rate_limit":            d.rateLimit(&c.RateLimit),
+		"retry":                 d.retry(&c.RetryFunc),
+	})
+	return c
+}
+
+func (d *configDecoder) vault(l *ast.ObjectList) *VaultConfig {
+	c := &VaultConfig{RenewToken: true}
+	c.Transport.SSLVerify = true
+	d.fields("vault", l, map[string]func(*ast.ObjectItem){
+		"address":                d.str(&c.Address),
+		"namespace":              d.str(&c.Namespace),
+		"token":                  d.str(&c.Token),
+		"unwrap_token":           d.boolean(&c.UnwrapToken),
+		"renew_token":            d.boolean(&c.RenewToken),
+		"default_lease_duration": d.duration(&c.DefaultLease),
+		"ssl":                    d.ssl(&c.Transport),
+		"transport":              d.transport(&c.Transport),
+		"rate_limit":             d.rateLimit(&c.RateLimit),
+		"retry":                  d.retry(&c.RetryFunc),
+	})
+	return c
+}
+
+func (d *configDecoder) ssl(t *TransportInput) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		d.block(item, func(l *ast.ObjectList) {
+			d.fields("ssl", l, map[string]func(*ast.ObjectItem){
+				"enabled":     d.boolean(&t.SSLEnabled),
+				"verify":      d.boolean(&t.SSLVerify),
+				"cert":        d.str(&t.SSLCert),
+				"key":         d.str(&t.SSLKey),
+				"ca_cert":     d.str(&t.SSLCACert),
+				"ca_path":     d.str(&t.SSLCAPath),
+				"server_name": d.str(&t.ServerName),
+			})
+		})
+	}
+}
+
+func (d *configDecoder) transport(t *TransportInput) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		d.block(item, func(l *ast.ObjectList) {
+			d.fields("transport", l, map[string]func(*ast.ObjectItem){
+				"dial_keep_alive":         d.duration(&t.DialKeepAlive),
+				"dial_timeout":            d.duration(&t.DialTimeout),
+				"disable_keep_alives":     d.boolean(&t.DisableKeepAlives),
+				"idle_conn_timeout":       d.duration(&t.IdleConnTimeout),
+				"max_idle_conns":          d.integer(&t.MaxIdleConns),
+				"max_idle_conns_per_host": d.integer(&t.MaxIdleConnsPerHost),
+				"tls_handshake_timeout":   d.duration(&t.TLSHandshakeTimeout),
+			})
+		})
+	}
+}
+
+func (d *configDecoder) rateLimit(r *RateLimitInput) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		d.block(item, func(l *ast.ObjectList) {
+			d.fields("rate_limit", l, map[string]func(*ast.ObjectItem){
+				"requests_per_second": d.float(&r.RequestsPerSecond),
+				"burst":               d.integer(&r.Burst),
+				"max_in_flight":       d.integer(&r.MaxInFlight),
+				"reconnect_jitter":    d.duration(&r.ReconnectJitter),
+			})
+		})
+	}
+}
+
+// retry decodes a retry block into exponential backoff, see RetryExponential.
+// Zero attempts retry forever.
+func (d *configDecoder) retry(f *ErrorRetryFunc) func(*ast.ObjectItem) {
+	return func(item *ast.ObjectItem) {
+		d.block(item, func(l *ast.ObjectList) {
+			enabled := true
+			attempts := DefaultRetryAttempts
+			base, max := DefaultRetryBase, DefaultRetryMax
+			d.fields("retry", l, map[string]func(*ast.ObjectItem){
+				"enabled":     d.boolean(&enabled),
+				"attempts":    d.integer(&attempts),
+				"backoff":     d.duration(&base),
+				"max_backoff": d.duration(&max),
+			})
+			switch {
+			case !enabled:
+				*f = NoRetry
+			case attempts == 0:
+				*f = RetryExponential(base, max)
+			default:
+				*f = RetryMaxAttempts(attempts, RetryExponential(base, max))
+			}
+		})
+	}
+}
+
+// wait decodes a buffer period. The max defaults to 4 times the min.
+func (d *configDecoder) wait(item *ast.ObjectItem, l *ast.ObjectList) *WaitConfig {
+	w := &WaitConfig{}
+	d.fields("wait", l, map[string]func(*ast.ObjectItem){
+		"min": d.duration(&w.Min),
+		"max": d.duration(&w.Max),
+	})
+	if w.Max == 0 {
+		w.Max = 4 * w.Min
+	}
+	if w.Max < w.Min {
+		d.errorf(item, nil, "wait: max %s is less than min %s", w.Max, w.Min)
+	}
+	return w
+}
+
+func (d *configDecoder) template(item *ast.ObjectItem, l *ast.ObjectList) *TemplateConfig {
+	t := &TemplateConfig{
+		Perms:          defaultFilePerms,
+		CreateDestDirs: true,
+		pos:            d.pos(item, nil),
+	}
+	d.fields("template", l, map[string]func(*ast.ObjectItem){
+		"source":               d.str(&t.Source),
+		"contents":             d.str(&t.Contents),
+		"destination":          d.str(&t.Destination),
+		"perms":                d.perms(&t.Perms),
+		"create_dest_dirs":     d.boolean(&t.CreateDestDirs),
+		"backup":               d.boolean(&t.Backup),
+		"left_delimiter":       d.str(&t.LeftDelim),
+		"right_delimiter":      d.str(&t.RightDelim),
+		"error_on_missing_key": d.boolean(&t.ErrMissingKey),
+		"sandbox_path":         d.str(&t.SandboxPath),
+		"decrypt_key_file":     d.str(&t.DecryptKeyFile),
+		"wait": func(wi *ast.ObjectItem) {
+			d.block(wi, func(l *ast.ObjectList) { t.Wait = d.wait(wi, l) })
+		},
+	})
+
+	switch {
+	case t.Source == "" && t.Contents == "":
+		d.errorf(item, nil, "template: one of source or contents is required")
+	case t.Source != "" && t.Contents != "":
+		d.errorf(item, nil, "template: only one of source or contents is allowed")
+	}
+	if t.Destination == "" {
+		d.errorf(item, nil, "template: destination is required")
+	}
+	if (t.LeftDelim == "") != (t.RightDelim == "") {
+		d.errorf(item, nil, "template: left_delimiter and right_delimiter must be set together")
+	}
+	return t
+}
@@ -0,0 +1,320 @@
+package hcat
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfigHCL = `
+consul {
+  address = "127.0.0.1:8500"
+  token   = "consul-token"
+  auth {
+    username = "user"
+    password = "pass"
+  }
+  block_wait            = "30s"
+  kv_coalesce_threshold = 5
+  ssl {
+    enabled = true
+    ca_cert = "ca.pem"
+  }
+  rate_limit {
+    requests_per_second = 2.5
+  }
+  retry {
+    attempts = 3
+    backoff  = "1s"
+  }
+}
+
+vault {
+  address     = "https://127.0.0.1:8200"
+  renew_token = false
+  transport {
+    dial_timeout = "5s"
+  }
+  retry {
+    enabled = false
+  }
+}
+
+wait {
+  min = "1s"
+}
+
+template {
+  source      = "in.tmpl"
+  destination = "out.txt"
+  perms       = "0600"
+}
+
+template {
+  contents         = "[[ key \"foo\" ]]"
+  destination      = "out2.txt"
+  left_delimiter   = "[["
+  right_delimiter  = "]]"
+  sandbox_path     = "/tmp"
+  backup           = true
+  decrypt_key_file = "keys.txt"
+  wait {
+    min = "2s"
+    max = "3s"
+  }
+}
+`
+
+const testConfigJSON = `{
+  "consul": {
+    "address": "127.0.0.1:8500",
+    "token": "consul-token",
+    "auth": {"username": "user", "password": "pass"},
+    "block_wait": "30s",
+    "kv_coalesce_threshold": 5,
+    "ssl": {"enabled": true, "ca_cert": "ca.pem"},
+    "rate_limit": {"requests_per_second": 2.5},
+    "retry": {"attempts": 3, "backoff": "1s"}
+  },
+  "vault": {
+    "address": "https://127.0.0.1:8200",
+    "renew_token": false,
+    "transport": {"dial_timeout": "5s"},
+    "retry": {"enabled": false}
+  },
+  "wait": {"min": "1s"},
+  "template": [
+    {"source": "in.tmpl", "destination": "out.txt", "perms": "0600"},
+    {
+      "contents": "[[ key \"foo\" ]]",
+      "destination": "out2.txt",
+      "left_delimiter": "[[",
+      "right_delimiter": "]]",
+      "sandbox_path": "/tmp",
+      "backup": true,
+      "decrypt_key_file": "keys.txt",
+      "wait": {"min": "2s", "max": "3s"}
+    }
+  ]
+}`
+
+func TestParseConfig(t *testing.T) {
+	for name, src := range map[string]string{
+		"hcl":  testConfigHCL,
+		"json": testConfigJSON,
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := ParseConfig("test."+name, []byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			consul := c.Consul.Input()
+			switch {
+			case consul.Address != "127.0.0.1:8500" || consul.Token != "consul-token":
+				t.Errorf("bad consul: %#v", consul)
+			case !consul.AuthEnabled || consul.AuthUsername != "user" ||
+				consul.AuthPassword != "pass":
+				t.Errorf("bad consul auth: %#v", consul)
+			case !consul.Transport.SSLEnabled || !consul.Transport.SSLVerify ||
+				consul.Transport.SSLCACert != "ca.pem":
+				t.Errorf("bad consul ssl: %#v", consul.Transport)
+			case c.Consul.BlockWait != 30*time.Second ||
+				c.Consul.KVCoalesceThreshold != 5 ||
+				c.Consul.RateLimit.RequestsPerSecond != 2.5:
+				t.Errorf("bad consul config: %#v", c.Consul)
+			}
+			if retry, _ := c.Consul.RetryFunc(Retry{Attempt: 2}); !retry {
+				t.Error("expected consul to retry")
+			}
+			if retry, _ := c.Consul.RetryFunc(Retry{Attempt: 3}); retry {
+				t.Error("expected consul to stop retrying after 3 attempts")
+			}
+
+			vault := c.Vault.Input()
+			switch {
+			case vault.Address != "https://127.0.0.1:8200" || c.Vault.RenewToken:
+				t.Errorf("bad vault: %#v", c.Vault)
+			case vault.Transport.DialTimeout != 5*time.Second:
+				t.Errorf("bad vault transport: %#v", vault.Transport)
+			}
+			if retry, _ := c.Vault.RetryFunc(Retry{}); retry {
+				t.Error("expected vault retries to be disabled")
+			}
+
+			if !reflect.DeepEqual(c.Wait, &WaitConfig{Min: time.Second, Max: 4 * time.Second}) {
+				t.Errorf("bad wait: %#v", c.Wait)
+			}
+			if len(c.Templates) != 2 {
+				t.Fatalf("expected 2 templates, got %d", len(c.Templates))
+			}
+			t1, t2 := c.Templates[0], c.Templates[1]
+			switch {
+			case t1.Source != "in.tmpl" || t1.Destination != "out.txt" ||
+				t1.Perms != 0600 || !t1.CreateDestDirs || t1.Wait != nil:
+				t.Errorf("bad first template: %#v", t1)
+			case t2.Contents != `[[ key "foo" ]]` || t2.LeftDelim != "[[" ||
+				t2.RightDelim != "]]" || t2.SandboxPath != "/tmp" ||
+				!t2.Backup || t2.Perms != defaultFilePerms ||
+				t2.DecryptKeyFile != "keys.txt":
+				t.Errorf("bad second template: %#v", t2)
+			case !reflect.DeepEqual(t2.Wait, &WaitConfig{Min: 2 * time.Second, Max: 3 * time.Second}):
+				t.Errorf("bad second template wait: %#v", t2.Wait)
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		errs []string
+	}{
+		{
+			"syntax",
+			"consul {\n  address = \n}",
+			[]string{"test.hcl:3:2: object expected closing RBRACE"},
+		},
+		{
+			"unknown-key",
+			"consul {\n  adress = \"x\"\n}",
+			[]string{`test.hcl:2:3: consul: unknown key "adress"`},
+		},
+		{
+			"bad-values",
+			"consul {\n  block_wait = \"soon\"\n  max_stale = 5\n  token = true\n}",
+			[]string{
+				`test.hcl:2:16: block_wait: invalid duration "soon"`,
+				`test.hcl:3:15: max_stale: expected a duration, eg. "5s"`,
+				`test.hcl:4:11: token: expected a string`,
+			},
+		},
+		{
+			"duplicate",
+			"vault {}\nvault {}",
+			[]string{`test.hcl:2:1: config: duplicate key "vault"`},
+		},
+		{
+			"template",
+			"template {\n  perms = \"rw\"\n}\n\ntemplate {\n  source = \"a\"\n  contents = \"b\"\n  destination = \"c\"\n  left_delimiter = \"[[\"\n}",
+			[]string{
+				`test.hcl:2:11: perms: invalid file mode rw`,
+				`test.hcl:1:1: template: one of source or contents is required`,
+				`test.hcl:1:1: template: destination is required`,
+				`test.hcl:5:1: template: only one of source or contents is allowed`,
+				`test.hcl:5:1: template: left_delimiter and right_delimiter must be set together`,
+			},
+		},
+		{
+			"wait",
+			"wait {\n  min = \"2s\"\n  max = \"1s\"\n}",
+			[]string{`test.hcl:1:1: wait: max 1s is less than min 2s`},
+		},
+		{
+			"json",
+			"{\n  \"consul\": {\n    \"adress\": \"x\"\n  }\n}",
+			[]string{`test.hcl:3:13: consul: unknown key "adress"`},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseConfig("test.hcl", []byte(tc.src))
+			errs, ok := err.(ConfigErrors)
+			if !ok {
+				t.Fatalf("expected ConfigErrors, got %#v", err)
+			}
+			if len(errs) != len(tc.errs) {
+				t.Fatalf("expected %d errors, got:\n%s", len(tc.errs), err)
+			}
+			for i, exp := range tc.errs {
+				if !strings.HasPrefix(errs[i].Error(), exp) {
+					t.Errorf("expected error %q, got %q", exp, errs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConfigBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hcat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "in.tmpl")
+	if err := ioutil.WriteFile(src, []byte(`{{ "from file" }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := filepath.Join(dir, "out", "out.txt")
+
+	c, err := ParseConfig("test.hcl", []byte(`
+template {
+  source      = "`+src+`"
+  destination = "`+dest+`"
+  perms       = "0600"
+  wait {
+    min = "1s"
+  }
+}
+template {
+  contents        = "<< \"inline\" >>"
+  destination     = "unused"
+  left_delimiter  = "<<"
+  right_delimiter = ">>"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Watcher.Close()
+
+	r := NewResolver()
+	for i, exp := range []string{"from file", "inline"} {
+		e, err := r.Run(b.Templates[i], b.Watcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(e.Contents) != exp {
+			t.Errorf("expected %q, got %q", exp, e.Contents)
+		}
+	}
+
+	if _, err := b.Templates[0].Render([]byte("rendered")); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("bad perms: %s", fi.Mode())
+	}
+
+	// the buffer period is set for the template with a wait
+	timers := b.Watcher.bufferTemplates.timers
+	if timers[b.Templates[0].ID()] == nil {
+		t.Error("expected a buffer period")
+	}
+	if timers[b.Templates[1].ID()] != nil {
+		t.Error("expected no buffer period")
+	}
+
+	t.Run("missing-source", func(t *testing.T) {
+		c, err := ParseConfig("test.hcl", []byte("\n\ntemplate {\n  source = \"/nope\"\n  destination = \"x\"\n}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.Build()
+		if err == nil || !strings.HasPrefix(err.Error(), "test.hcl:3:1: template: ") {
+			t.Fatal("expected the template's position in the error, got:", err)
+		}
+	})
+}
@@ -0,0 +1,408 @@
+package hcat
+
+import (
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultDedupPrefix = "hcat/dedup/"
+	defaultDedupTTL    = 15 * time.Second
+	// dedupRetryInterval is how long to wait to retry after election errors.
+	dedupRetryInterval = 5 * time.Second
+)
+
+// DedupManager implements de-duplication mode across multiple instances
+// rendering the same templates.
+//
+// For each template a leader is elected using a Consul session and lock. The
+// leader watches the template's dependencies as usual and publishes a
+// compressed snapshot of their data to a Consul KV key. Followers only watch
+// that key instead of all the dependencies. Dependencies that are not
+// shareable (Vault secrets, local files, etc.) are never published and are
+// always watched by each instance.
+//
+// Use the Watcherer returned by Watcherer(tmplID) in place of the Watcher
+// when running the template with the Resolver.
+type DedupManager struct {
+	watcher *Watcher
+	prefix  string
+	ttl     time.Duration
+
+	mux sync.Mutex
+	// session is the current Consul session, nil when there is none
+	session   *dedupSession
+	templates map[string]*dedupTemplate
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// DedupInput is used as input to the NewDedupManager function.
+type DedupInput struct {
+	// Watcher is the Watcher used for all dependencies and data snapshots.
+	// Its Looker must have a Consul client.
+	Watcher *Watcher
+	// Prefix is the Consul KV path under which the leader locks and data
+	// snapshots are stored. Defaults to "hcat/dedup/".
+	Prefix string
+	// TTL is the TTL of the Consul session used for leader election.
+	// Defaults to 15s.
+	TTL time.Duration
+}
+
+// dedupSession is a Consul session and the leader elections run on it.
+type dedupSession struct {
+	id string
+	// doneCh is closed when the session is invalidated or stopped, ending
+	// its elections.
+	doneCh    chan struct{}
+	elections sync.WaitGroup
+}
+
+// dedupTemplate is the de-duplication state of a template.
+type dedupTemplate struct {
+	id       string
+	leader   bool
+	snapshot *idep.DedupQuery
+	// published is the data last published while leader
+	published map[string]interface{}
+}
+
+// NewDedupManager creates a new DedupManager. Call Start to begin leader
+// elections.
+func NewDedupManager(i DedupInput) *DedupManager {
+	prefix := i.Prefix
+	if prefix == "" {
+		prefix = defaultDedupPrefix
+	}
+	ttl := i.TTL
+	if ttl == 0 {
+		ttl = defaultDedupTTL
+	}
+	return &DedupManager{
+		watcher:   i.Watcher,
+		prefix:    prefix,
+		ttl:       ttl,
+		templates: make(map[string]*dedupTemplate),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start creates the Consul session used for leader elections and starts the
+// elections for any templates already known. If the session is invalidated
+// later on, a new one is created and the elections restarted on it.
+func (m *DedupManager) Start() error {
+	id, err := m.createSession()
+	if err != nil {
+		return err
+	}
+	m.wg.Add(1)
+	go m.run(id)
+	return nil
+}
+
+// createSession creates a new Consul session for leader elections.
+func (m *DedupManager) createSession() (string, error) {
+	id, _, err := m.watcher.clients.Consul().Session().Create(
+		&consulapi.SessionEntry{
+			Name:     "hcat-dedup",
+			Behavior: consulapi.SessionBehaviorRelease,
+			TTL:      m.ttl.String(),
+		}, nil)
+	return id, errors.Wrap(err, "dedup: session create")
+}
+
+// run renews the session and runs the leader elections on it until stopped.
+// When the session is invalidated, its elections are ended and a new session
+// is created for them.
+func (m *DedupManager) run(id string) {
+	defer m.wg.Done()
+	for {
+		s := &dedupSession{id: id, doneCh: make(chan struct{})}
+		m.mux.Lock()
+		m.session = s
+		for _, t := range m.templates {
+			s.elections.Add(1)
+			go m.elect(t, s)
+		}
+		m.mux.Unlock()
+
+		// destroys the session when stopped
+		err := m.watcher.clients.Consul().Session().RenewPeriodic(
+			m.ttl.String(), id, nil, m.stopCh)
+
+		m.mux.Lock()
+		m.session = nil
+		close(s.doneCh)
+		m.mux.Unlock()
+		s.elections.Wait()
+
+		if isDone(m.stopCh) {
+			return
+		}
+		if err == nil {
+			err = consulapi.ErrSessionExpired
+		}
+		m.sendErr(errors.Wrap(err, "dedup: session renew"))
+
+		for {
+			if id, err = m.createSession(); err == nil {
+				break
+			}
+			m.sendErr(err)
+			select {
+			case <-time.After(dedupRetryInterval):
+			case <-m.stopCh:
+				return
+			}
+		}
+	}
+}
+
+// Stop halts all leader elections and destroys the session, releasing any
+// held leader locks.
+func (m *DedupManager) Stop() error {
+	m.mux.Lock()
+	select {
+	case <-m.stopCh:
+		m.mux.Unlock()
+		return nil
+	default:
+	}
+	close(m.stopCh)
+	session := m.session
+	m.mux.Unlock()
+
+	m.wg.Wait()
+	if session == nil {
+		return nil
+	}
+	_, err := m.watcher.clients.Consul().Session().Destroy(session.id, nil)
+	return errors.Wrap(err, "dedup: session destroy")
+}
+
+// IsLeader returns true if this instance is the leader for the template.
+func (m *DedupManager) IsLeader(tmplID string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	t, ok := m.templates[tmplID]
+	return ok && t.leader
+}
+
+// Watcherer returns the Watcherer to use with the Resolver for the template.
+// The template's leader election is started on the first call.
+func (m *DedupManager) Watcherer(tmplID string) Watcherer {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if _, ok := m.templates[tmplID]; !ok {
+		t := &dedupTemplate{
+			id:       tmplID,
+			snapshot: idep.NewDedupQuery(path.Join(m.prefix, tmplID, "data")),
+		}
+		m.templates[tmplID] = t
+		if s := m.session; s != nil {
+			s.elections.Add(1)
+			go m.elect(t, s)
+		}
+	}
+	return &dedupWatcher{manager: m, tmplID: tmplID}
+}
+
+// elect runs the leader election for the template on the session until the
+// session ends.
+func (m *DedupManager) elect(t *dedupTemplate, s *dedupSession) {
+	defer s.elections.Done()
+	key := path.Join(m.prefix, t.id, "leader")
+	for {
+		lock, err := m.watcher.clients.Consul().LockOpts(&consulapi.LockOptions{
+			Key:     key,
+			Session: s.id,
+		})
+		var lostCh <-chan struct{}
+		if err == nil {
+			lostCh, err = lock.Lock(s.doneCh)
+		}
+		if err != nil {
+			m.sendErr(errors.Wrap(err, "dedup: lock"))
+			select {
+			case <-time.After(dedupRetryInterval):
+				continue
+			case <-s.doneCh:
+				return
+			}
+		}
+		if lostCh == nil { // session ended
+			return
+		}
+
+		m.setLeader(t, true)
+		select {
+		case <-lostCh:
+			m.setLeader(t, false)
+		case <-s.doneCh:
+			lock.Unlock()
+			m.setLeader(t, false)
+			return
+		}
+	}
+}
+
+// setLeader updates the leader state of the template. The template is reset
+// in the Watcher so it will fully render on the next run.
+func (m *DedupManager) setLeader(t *dedupTemplate, leader bool) {
+	m.mux.Lock()
+	t.leader = leader
+	t.published = nil
+	m.mux.Unlock()
+
+	m.watcher.depTracker.forget(t.id)
+	// wake up Wait so the template is run again
+	select {
+	case m.watcher.bufferTrigger <- t.id:
+	default:
+	}
+}
+
+// publish writes the snapshot of the shareable dependencies' data to Consul,
+// if it changed since the last publish. The write is done in a transaction
+// checking the leader lock is still held by the session, so a deposed leader
+// can't overwrite the new leader's snapshot.
+func (m *DedupManager) publish(t *dedupTemplate, deps []dep.Dependency) {
+	data := make(map[string]interface{}, len(deps))
+	for _, d := range deps {
+		if !canShare(d) {
+			continue
+		}
+		if value, ok := m.watcher.Recall(d.String()); ok {
+			data[d.String()] = value
+		}
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !t.leader || m.session == nil || reflect.DeepEqual(data, t.published) {
+		return
+	}
+
+	b, err := idep.EncodeDedupSnapshot(&idep.DedupSnapshot{
+		Version: idep.DedupVersion,
+		Data:    data,
+	})
+	var ok bool
+	if err == nil {
+		ok, _, _, err = m.watcher.clients.Consul().Txn().Txn(consulapi.TxnOps{
+			{KV: &consulapi.KVTxnOp{
+				Verb:    consulapi.KVCheckSession,
+				Key:     path.Join(m.prefix, t.id, "leader"),
+				Session: m.session.id,
+			}},
+			{KV: &consulapi.KVTxnOp{
+				Verb:  consulapi.KVSet,
+				Key:   path.Join(m.prefix, t.id, "data"),
+				Value: b,
+			}},
+		}, nil)
+	}
+	if err != nil {
+		m.sendErr(errors.Wrap(err, "dedup: publish"))
+		return
+	}
+	if ok { // else no longer the leader, the election will notice
+		t.published = data
+	}
+}
+
+// sendErr pushes the error to the watcher, returning it from the next Wait.
+func (m *DedupManager) sendErr(err error) {
+	go func() {
+		select {
+		case m.watcher.errCh <- err:
+		case <-m.stopCh:
+		}
+	}()
+}
+
+// canShare returns true if the dependency's data can be shared with other
+// instances. Dependencies must explicitly allow it.
+func canShare(d dep.Dependency) bool {
+	s, ok := d.(interface{ CanShare() bool })
+	return ok && s.CanShare()
+}
+
+// dedupWatcher is the Watcherer for a template in de-duplication mode.
+type dedupWatcher struct {
+	manager *DedupManager
+	tmplID  string
+}
+
+// state returns whether this instance is the leader for the template and the
+// template's data snapshot dependency.
+func (d *dedupWatcher) state() (bool, *idep.DedupQuery) {
+	d.manager.mux.Lock()
+	defer d.manager.mux.Unlock()
+	t := d.manager.templates[d.tmplID]
+	return t.leader, t.snapshot
+}
+
+// Recall returns the data from the leader's snapshot when following.
+func (d *dedupWatcher) Recall(id string) (interface{}, bool) {
+	w := d.manager.watcher
+	if leader, snapshot := d.state(); !leader {
+		if s, ok := w.Recall(snapshot.String()); ok && s != nil {
+			if value, ok := s.(*idep.DedupSnapshot).Data[id]; ok {
+				return value, true
+			}
+		}
+	}
+	return w.Recall(id)
+}
+
+// Add watches the dependency, or the leader's snapshot in its place when
+// following.
+func (d *dedupWatcher) Add(dp dep.Dependency) bool {
+	w := d.manager.watcher
+	if leader, snapshot := d.state(); !leader && canShare(dp) {
+		return w.Add(snapshot)
+	}
+	return w.Add(dp)
+}
+
+func (d *dedupWatcher) Changed(tmplID string) bool {
+	return d.manager.watcher.Changed(tmplID)
+}
+
+func (d *dedupWatcher) Buffer(tmplID string) bool {
+	return d.manager.watcher.Buffer(tmplID)
+}
+
+// Register the dependencies with the watcher. When leading the data is
+// published, when following the shareable dependencies are replaced by the
+// leader's snapshot.
+func (d *dedupWatcher) Register(tmplID string, deps ...dep.Dependency) {
+	w := d.manager.watcher
+	leader, snapshot := d.state()
+	if leader {
+		w.Register(tmplID, deps...)
+		d.manager.mux.Lock()
+		t := d.manager.templates[d.tmplID]
+		d.manager.mux.Unlock()
+		d.manager.publish(t, deps)
+		return
+	}
+
+	local := []dep.Dependency{snapshot}
+	for _, dp := range deps {
+		if !canShare(dp) {
+			local = append(local, dp)
+		}
+	}
+	w.Register(tmplID, local...)
+}
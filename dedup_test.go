@@ -0,0 +1,261 @@
+package hcat
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestDedupManager(t *testing.T) {
+	tmpl := fooTemplate(t)
+	foo, err := idep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotKey := path.Join(defaultDedupPrefix, tmpl.ID(), "data")
+
+	newDedup := func(kv map[string]string) (*DedupManager, *Watcher, func()) {
+		srv := fakeConsulKV(t, kv)
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: srv.URL}); err != nil {
+			t.Fatal(err)
+		}
+		w := NewWatcher(WatcherInput{Clients: clients})
+		m := NewDedupManager(DedupInput{Watcher: w})
+		return m, w, func() { w.Close(); srv.Close() }
+	}
+	run := func(w *Watcher, ww Watcherer) ResolveEvent {
+		rv := NewResolver()
+		for {
+			r, err := rv.Run(tmpl, ww)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Complete {
+				return r
+			}
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("follower", func(t *testing.T) {
+		b, err := idep.EncodeDedupSnapshot(&idep.DedupSnapshot{
+			Version: idep.DedupVersion,
+			Data:    map[string]interface{}{foo.String(): "shared"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, w, done := newDedup(map[string]string{
+			"foo":       "direct",
+			snapshotKey: string(b),
+		})
+		defer done()
+
+		r := run(w, m.Watcherer(tmpl.ID()))
+		if string(r.Contents) != "shared" {
+			t.Fatalf("expected snapshot data, got: %q", r.Contents)
+		}
+		if m.IsLeader(tmpl.ID()) {
+			t.Fatal("should not be leader")
+		}
+		if w.Watching(foo.String()) {
+			t.Fatal("follower should not watch shared dependency")
+		}
+		snapshotID := idep.NewDedupQuery(snapshotKey).String()
+		if !w.Watching(snapshotID) {
+			t.Fatal("follower should watch snapshot")
+		}
+	})
+	t.Run("unshareable", func(t *testing.T) {
+		m, w, done := newDedup(map[string]string{})
+		defer done()
+		file, err := idep.NewFileQuery("/etc/hosts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Watcherer(tmpl.ID()).Register(tmpl.ID(), foo, file)
+		exp := []string{idep.NewDedupQuery(snapshotKey).String(), file.String()}
+		if deps := w.TemplateDependencies(tmpl.ID()); !reflect.DeepEqual(deps, exp) {
+			t.Fatalf("bad dependencies: %v", deps)
+		}
+		if canShare(file) || !canShare(foo) {
+			t.Fatal("bad shareable check")
+		}
+	})
+}
+
+// TestDedupManagerElection runs the leader elections against the Consul test
+// server, enabled with -egs.
+func TestDedupManagerElection(t *testing.T) {
+	if consuladdr == "" {
+		t.Skip("requires the Consul test server, run with -egs")
+	}
+	tmpl := fooTemplate(t)
+
+	newDedup := func(prefix string) (*DedupManager, *Watcher) {
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: consuladdr}); err != nil {
+			t.Fatal(err)
+		}
+		w := NewWatcher(WatcherInput{Clients: clients})
+		m := NewDedupManager(DedupInput{
+			Watcher: w,
+			Prefix:  prefix,
+			TTL:     10 * time.Second, // Consul's minimum
+		})
+		m.Watcherer(tmpl.ID())
+		if err := m.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return m, w
+	}
+	// leaders returns the managers leading the template
+	leaders := func(ms ...*DedupManager) []*DedupManager {
+		var result []*DedupManager
+		for _, m := range ms {
+			if m.IsLeader(tmpl.ID()) {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(30 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for", what)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	sessionID := func(m *DedupManager) string {
+		m.mux.Lock()
+		defer m.mux.Unlock()
+		if m.session == nil {
+			return ""
+		}
+		return m.session.id
+	}
+	snapshot := func(kv *consulapi.KV, key string) map[string]interface{} {
+		pair, _, err := kv.Get(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pair == nil {
+			return nil
+		}
+		s, err := idep.DecodeDedupSnapshot(pair.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.Data
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		prefix := "hcat/test/failover/"
+		m1, w1 := newDedup(prefix)
+		defer w1.Close()
+		defer m1.Stop()
+		m2, w2 := newDedup(prefix)
+		defer w2.Close()
+		defer m2.Stop()
+
+		waitFor("a leader", func() bool { return len(leaders(m1, m2)) == 1 })
+		leader, follower := m1, m2
+		if m2.IsLeader(tmpl.ID()) {
+			leader, follower = m2, m1
+		}
+		if err := leader.Stop(); err != nil {
+			t.Fatal(err)
+		}
+		waitFor("the follower to lead", func() bool {
+			return follower.IsLeader(tmpl.ID())
+		})
+	})
+	t.Run("session-invalidated", func(t *testing.T) {
+		m, w := newDedup("hcat/test/session/")
+		defer w.Close()
+		defer m.Stop()
+
+		waitFor("leadership", func() bool { return m.IsLeader(tmpl.ID()) })
+		id := sessionID(m)
+		_, err := w.clients.Consul().Session().Destroy(id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor("a new session", func() bool {
+			newID := sessionID(m)
+			return newID != "" && newID != id
+		})
+		waitFor("leadership on the new session", func() bool {
+			return m.IsLeader(tmpl.ID())
+		})
+	})
+	t.Run("publish", func(t *testing.T) {
+		prefix := "hcat/test/publish/"
+		dataKey := path.Join(prefix, tmpl.ID(), "data")
+		m, w := newDedup(prefix)
+		defer w.Close()
+		defer m.Stop()
+		kv := w.clients.Consul().KV()
+		if _, err := kv.Put(&consulapi.KVPair{
+			Key: "foo", Value: []byte("bar"),
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+		foo, err := idep.NewKVGetQuery("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor("leadership", func() bool { return m.IsLeader(tmpl.ID()) })
+		rv := NewResolver()
+		for {
+			r, err := rv.Run(tmpl, m.Watcherer(tmpl.ID()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Complete {
+				break
+			}
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		exp := map[string]interface{}{foo.String(): "bar"}
+		if data := snapshot(kv, dataKey); !reflect.DeepEqual(data, exp) {
+			t.Fatalf("bad snapshot: %#v", data)
+		}
+
+		// a deposed leader, whose session doesn't hold the lock, can't
+		// overwrite the snapshot
+		session := w.clients.Consul().Session()
+		id, _, err := session.Create(&consulapi.SessionEntry{TTL: "10s"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer session.Destroy(id, nil)
+		deposed := NewDedupManager(DedupInput{Watcher: w, Prefix: prefix})
+		deposed.Watcherer(tmpl.ID())
+		deposed.mux.Lock()
+		deposed.session = &dedupSession{id: id}
+		dt := deposed.templates[tmpl.ID()]
+		dt.leader = true
+		deposed.mux.Unlock()
+		w.cache.Save(foo.String(), "stale")
+		deposed.publish(dt, []dep.Dependency{foo})
+		if data := snapshot(kv, dataKey); !reflect.DeepEqual(data, exp) {
+			t.Fatalf("deposed leader overwrote snapshot: %#v", data)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package dep
 
 import (
+	"context"
 	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
@@ -14,6 +15,46 @@ type Dependency interface {
 	Stop()
 }
 
+// ContextDependency is a Dependency whose fetch can be canceled, or given a
+// deadline, with a context. Implementations should return promptly with the
+// context's error once it is done.
+type ContextDependency interface {
+	Dependency
+	FetchContext(context.Context, Clients) (interface{}, *ResponseMetadata, error)
+}
+
+// FetchContext fetches the dependency's data with the context. Dependencies
+// implementing ContextDependency, as all of hcat's own do, are passed the
+// context. For others, like third-party implementations, Fetch is run in the
+// background and FetchContext returns the context's error as soon as it is
+// done; the background Fetch returns on its own, usually when the dependency
+// is stopped, and its result is discarded.
+func FetchContext(ctx context.Context, d Dependency, c Clients) (interface{}, *ResponseMetadata, error) {
+	if cd, ok := d.(ContextDependency); ok {
+		return cd.FetchContext(ctx, c)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	type result struct {
+		data interface{}
+		rm   *ResponseMetadata
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		data, rm, err := d.Fetch(c)
+		resultCh <- result{data, rm, err}
+	}()
+	select {
+	case r := <-resultCh:
+		return r.data, r.rm, r.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
 // Clients interface for the API clients used for external dependency calls.
 type Clients interface {
 	Consul() *consulapi.Client
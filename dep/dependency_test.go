@@ -0,0 +1,72 @@
+package dep
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingDep's Fetch blocks until it is stopped.
+type blockingDep struct {
+	stopCh chan struct{}
+}
+
+func (d *blockingDep) Fetch(Clients) (interface{}, *ResponseMetadata, error) {
+	<-d.stopCh
+	return nil, nil, ErrStopped
+}
+func (d *blockingDep) String() string { return "blocking" }
+func (d *blockingDep) Stop()          { close(d.stopCh) }
+
+// contextDep's Fetch returns the context it was passed.
+type contextDep struct{ blockingDep }
+
+func (d *contextDep) FetchContext(ctx context.Context, c Clients) (interface{}, *ResponseMetadata, error) {
+	return ctx, &ResponseMetadata{}, nil
+}
+
+func TestFetchContext(t *testing.T) {
+	t.Run("adapter-canceled", func(t *testing.T) {
+		d := &blockingDep{stopCh: make(chan struct{})}
+		defer d.Stop()
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		_, _, err := FetchContext(ctx, d, nil)
+		if err != context.Canceled {
+			t.Fatal("expected canceled error, got:", err)
+		}
+	})
+	t.Run("adapter-deadline", func(t *testing.T) {
+		d := &blockingDep{stopCh: make(chan struct{})}
+		defer d.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(),
+			10*time.Millisecond)
+		defer cancel()
+		_, _, err := FetchContext(ctx, d, nil)
+		if err != context.DeadlineExceeded {
+			t.Fatal("expected deadline error, got:", err)
+		}
+	})
+	t.Run("adapter-fetch", func(t *testing.T) {
+		d := &blockingDep{stopCh: make(chan struct{})}
+		d.Stop()
+		_, _, err := FetchContext(context.Background(), d, nil)
+		if err != ErrStopped {
+			t.Fatal("expected fetch result, got:", err)
+		}
+	})
+	t.Run("context-dependency", func(t *testing.T) {
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "v")
+		data, _, err := FetchContext(ctx, &contextDep{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.(context.Context).Value(key{}) != "v" {
+			t.Fatal("context not passed to dependency")
+		}
+	})
+}
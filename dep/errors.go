@@ -1,6 +1,9 @@
 package dep
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // ErrStopped is a special error that is returned when a dependency is
 // prematurely stopped, usually due to a configuration reload or a process
@@ -11,3 +14,80 @@ var ErrStopped = errors.New("dependency stopped")
 var ErrContinue = errors.New("dependency continue")
 
 var ErrLeaseExpired = errors.New("lease expired or is not renewable")
+
+// ErrorClass classifies fetch errors, so they can be retried differently.
+type ErrorClass int
+
+const (
+	// ClassTransient errors, eg. a connection reset, are expected to go away
+	// by retrying. Unclassified errors are transient.
+	ClassTransient ErrorClass = iota
+	// ClassPermanent errors, eg. a missing Vault secret, won't go away by
+	// retrying the same request.
+	ClassPermanent
+	// ClassAuth errors, eg. a permission denied, might go away once the
+	// client re-authenticates.
+	ClassAuth
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassTransient:
+		return "transient"
+	case ClassPermanent:
+		return "permanent"
+	case ClassAuth:
+		return "auth"
+	}
+	return fmt.Sprintf("ErrorClass(%d)", int(c))
+}
+
+// ClassifiedError is an error with its class.
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the classified error.
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// Transient returns the error classified as transient. Returns nil if the
+// error is nil.
+func Transient(err error) error {
+	return classify(err, ClassTransient)
+}
+
+// Permanent returns the error classified as permanent. Returns nil if the
+// error is nil.
+func Permanent(err error) error {
+	return classify(err, ClassPermanent)
+}
+
+// AuthError returns the error classified as an auth error. Returns nil if
+// the error is nil.
+func AuthError(err error) error {
+	return classify(err, ClassAuth)
+}
+
+func classify(err error, class ErrorClass) error {
+	if err == nil {
+		return nil
+	}
+	return &ClassifiedError{Class: class, Err: err}
+}
+
+// ClassOf returns the class of the error, that of the first ClassifiedError
+// in its chain. Errors that aren't classified are transient.
+func ClassOf(err error) ErrorClass {
+	var ce *ClassifiedError
+	if errors.As(err, &ce) {
+		return ce.Class
+	}
+	return ClassTransient
+}
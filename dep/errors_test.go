@@ -0,0 +1,41 @@
+package dep
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestClassOf(t *testing.T) {
+	base := errors.New("failed")
+	cases := []struct {
+		name string
+		err  error
+		exp  ErrorClass
+	}{
+		{"unclassified", base, ClassTransient},
+		{"nil", nil, ClassTransient},
+		{"transient", Transient(base), ClassTransient},
+		{"permanent", Permanent(base), ClassPermanent},
+		{"auth", AuthError(base), ClassAuth},
+		{"wrapped", pkgerrors.Wrap(Permanent(base), "dep"), ClassPermanent},
+		{"fmt-wrapped", fmt.Errorf("dep: %w", AuthError(base)), ClassAuth},
+		{"outermost", Permanent(AuthError(base)), ClassPermanent},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if c := ClassOf(tc.err); c != tc.exp {
+				t.Fatalf("expected %s, got %s", tc.exp, c)
+			}
+		})
+	}
+	if Permanent(nil) != nil {
+		t.Fatal("expected nil error to stay nil")
+	}
+	if err := Permanent(base); err.Error() != base.Error() ||
+		!errors.Is(err, base) {
+		t.Fatal("expected the classified error to wrap the error:", err)
+	}
+}
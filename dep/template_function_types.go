@@ -124,3 +124,30 @@ type SecretWrapInfo struct {
 	CreationTime    time.Time
 	WrappedAccessor string
 }
+
+// Certificate is an X.509 certificate parsed from PEM, such as the
+// certificates of Connect CA roots and leaves or of Vault PKI secrets.
+type Certificate struct {
+	Subject    string
+	CommonName string
+	Issuer     string
+
+	// SerialNumber and the fingerprints are encoded in hex separated by :.
+	SerialNumber      string
+	SHA1Fingerprint   string
+	SHA256Fingerprint string
+
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// The subject alternative names
+	DNSNames       []string
+	IPAddresses    []string
+	EmailAddresses []string
+	URIs           []string
+
+	IsCA bool
+
+	// PEM is the PEM-encoded certificate.
+	PEM string
+}
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"sort"
 	"time"
 
@@ -34,9 +35,14 @@ func NewCatalogDatacentersQuery(ignoreFailing bool) (*CatalogDatacentersQuery, e
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client and returns a slice
-// of strings representing the datacenters
+// Fetch calls FetchContext with the background context.
 func (d *CatalogDatacentersQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client and returns a slice
+// of strings representing the datacenters
+func (d *CatalogDatacentersQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	opts := d.opts.Merge(&QueryOptions{})
 
 	//log.Printf("[TRACE] %s: GET %s", d, &url.URL{
@@ -55,10 +61,13 @@ func (d *CatalogDatacentersQuery) Fetch(clients dep.Clients) (interface{}, *dep.
 	// change, but is technically not edge-triggering.
 	if opts.WaitIndex != 0 {
 		//log.Printf("[TRACE] %s: long polling for %s", d, CatalogDatacentersQuerySleepTime)
+		waiting(ctx)
 
 		select {
 		case <-d.stopCh:
 			return nil, nil, ErrStopped
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
 		case <-time.After(CatalogDatacentersQuerySleepTime):
 		}
 	}
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"regexp"
@@ -48,9 +49,14 @@ func NewCatalogNodeQuery(s string) (*CatalogNodeQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client and returns a
-// of CatalogNode object.
+// Fetch calls FetchContext with the background context.
 func (d *CatalogNodeQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client and returns a
+// of CatalogNode object.
+func (d *CatalogNodeQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -77,9 +83,9 @@ func (d *CatalogNodeQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respons
 	//	Path:     "/v1/catalog/node/" + name,
 	//	RawQuery: opts.String(),
 	//})
-	node, qm, err := clients.Consul().Catalog().Node(name, opts.ToConsulOpts())
+	node, qm, err := clients.Consul().Catalog().Node(name, opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned response", d)
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"regexp"
@@ -47,9 +48,14 @@ func NewCatalogNodesQuery(s string) (*CatalogNodesQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client and returns a slice
-// of Node objects
+// Fetch calls FetchContext with the background context.
 func (d *CatalogNodesQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client and returns a slice
+// of Node objects
+func (d *CatalogNodesQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -65,9 +71,9 @@ func (d *CatalogNodesQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respon
 	//	Path:     "/v1/catalog/nodes",
 	//	RawQuery: opts.String(),
 	//})
-	n, qm, err := clients.Consul().Catalog().Nodes(opts.ToConsulOpts())
+	n, qm, err := clients.Consul().Catalog().Nodes(opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned %d results", d, len(n))
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"net/url"
@@ -68,9 +69,14 @@ func NewCatalogServiceQuery(s string) (*CatalogServiceQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client and returns a slice
-// of CatalogService objects.
+// Fetch calls FetchContext with the background context.
 func (d *CatalogServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client and returns a slice
+// of CatalogService objects.
+func (d *CatalogServiceQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -93,9 +99,9 @@ func (d *CatalogServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.Resp
 	}
 	//log.Printf("[TRACE] %s: GET %s", d, u)
 
-	entries, qm, err := clients.Consul().Catalog().Service(d.name, d.tag, opts.ToConsulOpts())
+	entries, qm, err := clients.Consul().Catalog().Service(d.name, d.tag, opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned %d results", d, len(entries))
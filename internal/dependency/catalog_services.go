@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"regexp"
@@ -45,9 +46,14 @@ func NewCatalogServicesQuery(s string) (*CatalogServicesQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client and returns a slice
-// of CatalogService objects.
+// Fetch calls FetchContext with the background context.
 func (d *CatalogServicesQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client and returns a slice
+// of CatalogService objects.
+func (d *CatalogServicesQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -63,9 +69,9 @@ func (d *CatalogServicesQuery) Fetch(clients dep.Clients) (interface{}, *dep.Res
 	//	RawQuery: opts.String(),
 	//})
 
-	entries, qm, err := clients.Consul().Catalog().Services(opts.ToConsulOpts())
+	entries, qm, err := clients.Consul().Catalog().Services(opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned %d results", d, len(entries))
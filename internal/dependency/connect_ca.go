@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"github.com/hashicorp/hcat/dep"
 	"github.com/pkg/errors"
 )
@@ -24,7 +25,12 @@ func NewConnectCAQuery() *ConnectCAQuery {
 	}
 }
 
-func (d *ConnectCAQuery) Fetch(clients dep.Clients) (
+// Fetch calls FetchContext with the background context.
+func (d *ConnectCAQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+func (d *ConnectCAQuery) FetchContext(ctx context.Context, clients dep.Clients) (
 	interface{}, *dep.ResponseMetadata, error,
 ) {
 	select {
@@ -40,9 +46,9 @@ func (d *ConnectCAQuery) Fetch(clients dep.Clients) (
 	//})
 
 	certs, md, err := clients.Consul().Agent().ConnectCARoots(
-		opts.ToConsulOpts())
+		opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned %d results", d, len(certs.Roots))
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/hashicorp/hcat/dep"
@@ -29,7 +30,12 @@ func NewConnectLeafQuery(service string) *ConnectLeafQuery {
 	}
 }
 
-func (d *ConnectLeafQuery) Fetch(clients dep.Clients) (
+// Fetch calls FetchContext with the background context.
+func (d *ConnectLeafQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+func (d *ConnectLeafQuery) FetchContext(ctx context.Context, clients dep.Clients) (
 	interface{}, *dep.ResponseMetadata, error,
 ) {
 	select {
@@ -44,9 +50,9 @@ func (d *ConnectLeafQuery) Fetch(clients dep.Clients) (
 	//})
 
 	cert, md, err := clients.Consul().Agent().ConnectCALeaf(d.service,
-		opts.ToConsulOpts())
+		opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned response", d)
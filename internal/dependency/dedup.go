@@ -0,0 +1,136 @@
+package dependency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ isDependency  = (*DedupQuery)(nil)
+	_ BlockingQuery = (*DedupQuery)(nil)
+)
+
+// DedupVersion is the version of the de-duplication snapshot format. Only
+// snapshots with a matching version are used.
+const DedupVersion = "1"
+
+// DedupSnapshot is the dependency data for a template published by the
+// de-duplication leader.
+type DedupSnapshot struct {
+	// Version is the format version, see DedupVersion.
+	Version string
+	// Data is the dependency data by dependency ID.
+	Data map[string]interface{}
+}
+
+// EncodeDedupSnapshot returns the gzip compressed, gob encoded snapshot.
+func EncodeDedupSnapshot(s *DedupSnapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := gob.NewEncoder(zw).Encode(s); err != nil {
+		return nil, errors.Wrap(err, "dedup: encode")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "dedup: compress")
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeDedupSnapshot decodes a snapshot encoded by EncodeDedupSnapshot.
+func DecodeDedupSnapshot(b []byte) (*DedupSnapshot, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "dedup: decompress")
+	}
+	defer zr.Close()
+	var s DedupSnapshot
+	if err := gob.NewDecoder(zr).Decode(&s); err != nil {
+		return nil, errors.Wrap(err, "dedup: decode")
+	}
+	return &s, nil
+}
+
+// DedupQuery watches the KV key where the de-duplication leader publishes
+// the snapshot of a template's dependency data.
+type DedupQuery struct {
+	isConsul
+	isBlocking
+	stopCh chan struct{}
+
+	key  string
+	opts QueryOptions
+}
+
+// NewDedupQuery returns a query for the snapshot stored at the given key.
+func NewDedupQuery(key string) *DedupQuery {
+	return &DedupQuery{
+		stopCh: make(chan struct{}, 1),
+		key:    key,
+	}
+}
+
+// Fetch calls FetchContext with the background context.
+func (d *DedupQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client. Returns nil data
+// if there is no snapshot or it is of a different version.
+func (d *DedupQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	pair, qm, err := clients.Consul().KV().Get(d.key, d.opts.ToConsulOpts().WithContext(ctx))
+	if err != nil {
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
+	}
+
+	rm := &dep.ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	if pair == nil || len(pair.Value) == 0 {
+		return nil, rm, nil
+	}
+
+	snapshot, err := DecodeDedupSnapshot(pair.Value)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	if snapshot.Version != DedupVersion {
+		//log.Printf("[WARN] %s: snapshot version %q, expected %q", d,
+		//	snapshot.Version, DedupVersion)
+		return nil, rm, nil
+	}
+	return snapshot, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *DedupQuery) CanShare() bool {
+	return false
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *DedupQuery) String() string {
+	return fmt.Sprintf("dedup(%s)", d.key)
+}
+
+// Stop halts the dependency's fetch function.
+func (d *DedupQuery) Stop() {
+	close(d.stopCh)
+}
+
+func (d *DedupQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
@@ -0,0 +1,27 @@
+package dependency
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupSnapshot(t *testing.T) {
+	s := &DedupSnapshot{
+		Version: DedupVersion,
+		Data:    map[string]interface{}{"kv.get(foo)": "bar"},
+	}
+	b, err := EncodeDedupSnapshot(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	act, err := DecodeDedupSnapshot(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, act) {
+		t.Fatalf("bad snapshot: %#v", act)
+	}
+	if _, err := DecodeDedupSnapshot([]byte("bad")); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"net/url"
 	"regexp"
 	"sort"
@@ -32,24 +33,26 @@ type BlockingQuery interface {
 	blockingQuery()
 }
 type VaultType interface {
-	isVault()
+	vaultType()
 }
 type ConsulType interface {
-	isConsul()
+	consulType()
 }
 type isConsul struct{}
 type isVault struct{}
 type isBlocking struct{}
 
-func (isConsul) isConsul()        {}
-func (isVault) isVault()          {}
+// The marker methods are not named after their types, as the embedded field
+// would shadow the method and it would never be promoted.
+func (isConsul) consulType()      {}
+func (isVault) vaultType()        {}
 func (isBlocking) blockingQuery() {}
 
 // This specifies all the fields internally required by dependencies.
 // The public ones + private ones used internally by hashicat.
 // Used to validate interface implementations in each dependency file.
 type isDependency interface {
-	dep.Dependency
+	dep.ContextDependency
 	QueryOptionsSetter
 }
 
@@ -129,6 +132,22 @@ func (q *QueryOptions) ToConsulOpts() *consulapi.QueryOptions {
 	}
 }
 
+type waitFuncKey struct{}
+
+// WithWaitFunc returns a context with a function that fetches call once
+// they start waiting, on a lease to renew or for a poll interval, after
+// their requests that return right away.
+func WithWaitFunc(ctx context.Context, f func()) context.Context {
+	return context.WithValue(ctx, waitFuncKey{}, f)
+}
+
+// waiting calls the context's wait function, if any.
+func waiting(ctx context.Context) {
+	if f, ok := ctx.Value(waitFuncKey{}).(func()); ok {
+		f()
+	}
+}
+
 func (q *QueryOptions) String() string {
 	u := &url.Values{}
 
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -167,7 +168,7 @@ func (v *vaultServer) CreateSecret(path string, data map[string]interface{},
 	if err != nil {
 		return err
 	}
-	_, err = q.writeSecret(testClients, &QueryOptions{})
+	_, err = q.writeSecret(context.Background(), testClients, &QueryOptions{})
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -1,6 +1,13 @@
 package dependency
 
-import "errors"
+import (
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/hashicorp/vault/api"
+)
 
 // ErrStopped is a special error that is returned when a dependency is
 // prematurely stopped, usually due to a configuration reload or a process
@@ -11,3 +18,30 @@ var ErrStopped = errors.New("dependency stopped")
 var ErrContinue = errors.New("dependency continue")
 
 var ErrLeaseExpired = errors.New("lease expired or is not renewable")
+
+// consulStatusRe matches the status code of Consul API errors, which are not
+// typed.
+var consulStatusRe = regexp.MustCompile(`^Unexpected response code: (\d+)`)
+
+// classifyError returns the error classified by the status code of the
+// Consul or Vault response it is from (see dep.ErrorClass). Other errors,
+// eg. network errors, are returned as is and so are transient.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var code int
+	var re *api.ResponseError
+	if errors.As(err, &re) {
+		code = re.StatusCode
+	} else if m := consulStatusRe.FindStringSubmatch(err.Error()); m != nil {
+		code, _ = strconv.Atoi(m[1])
+	}
+	switch code {
+	case 401, 403:
+		return dep.AuthError(err)
+	case 400, 404, 405:
+		return dep.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package dependency
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		exp  dep.ErrorClass
+	}{
+		{"network", errors.New("connection reset by peer"), dep.ClassTransient},
+		{"consul-403", errors.New("Unexpected response code: 403 " +
+			"(Permission denied)"), dep.ClassAuth},
+		{"consul-400", errors.New("Unexpected response code: 400 " +
+			"(bad request)"), dep.ClassPermanent},
+		{"consul-500", errors.New("Unexpected response code: 500"),
+			dep.ClassTransient},
+		{"vault-403", &api.ResponseError{StatusCode: 403}, dep.ClassAuth},
+		{"vault-404", fmt.Errorf("wrapped: %w",
+			&api.ResponseError{StatusCode: 404}), dep.ClassPermanent},
+		{"vault-503", &api.ResponseError{StatusCode: 503}, dep.ClassTransient},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if c := dep.ClassOf(classifyError(tc.err)); c != tc.exp {
+				t.Fatalf("expected %s, got %s", tc.exp, c)
+			}
+		})
+	}
+	if classifyError(nil) != nil {
+		t.Fatal("expected nil error to stay nil")
+	}
+}
@@ -116,7 +116,7 @@ func (d *FakeDepFetchError) Stop()                        {}
 func (d *FakeDepFetchError) SetOptions(opts QueryOptions) {}
 
 ////////////
-var _ isDependency = (*FakeDepSameIndex)(nil)
+var _ QueryOptionsSetter = (*FakeDepSameIndex)(nil)
 
 type FakeDepSameIndex struct{}
 
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -41,15 +42,22 @@ func NewFileQuery(s string) (*FileQuery, error) {
 	}, nil
 }
 
-// Fetch retrieves this dependency and returns the result or any errors that
-// occur in the process.
+// Fetch calls FetchContext with the background context.
 func (d *FileQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext retrieves this dependency and returns the result or any errors that
+// occur in the process.
+func (d *FileQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	//log.Printf("[TRACE] %s: READ %s", d, d.path)
 
 	select {
 	case <-d.stopCh:
 		//log.Printf("[TRACE] %s: stopped", d)
 		return "", nil, ErrStopped
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
 	case r := <-d.watch(d.stat):
 		if r.err != nil {
 			return "", nil, errors.Wrap(r.err, d.String())
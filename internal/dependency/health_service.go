@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"net/url"
@@ -100,9 +101,14 @@ func healthServiceQuery(s string, connect bool) (*HealthServiceQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client and returns a slice
-// of HealthService objects.
+// Fetch calls FetchContext with the background context.
 func (d *HealthServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client and returns a slice
+// of HealthService objects.
+func (d *HealthServiceQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -134,9 +140,9 @@ func (d *HealthServiceQuery) Fetch(clients dep.Clients) (interface{}, *dep.Respo
 	if d.connect {
 		nodes = clients.Consul().Health().Connect
 	}
-	entries, qm, err := nodes(d.name, d.tag, passingOnly, opts.ToConsulOpts())
+	entries, qm, err := nodes(d.name, d.tag, passingOnly, opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned %d results", d, len(entries))
@@ -1,8 +1,10 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/hashicorp/hcat/dep"
 	"github.com/pkg/errors"
@@ -69,8 +71,13 @@ func NewKVGetQuery(s string) (*KVGetQuery, error) {
 	return &KVGetQuery{KVExistsQuery: *q}, nil
 }
 
-// Fetch queries the Consul API defined by the given client.
+// Fetch calls FetchContext with the background context.
 func (d *KVGetQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client.
+func (d *KVGetQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -86,9 +93,9 @@ func (d *KVGetQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetad
 	//	RawQuery: opts.String(),
 	//})
 
-	pair, qm, err := clients.Consul().KV().Get(d.key, opts.ToConsulOpts())
+	pair, qm, err := clients.Consul().KV().Get(d.key, opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	rm := &dep.ResponseMetadata{
@@ -129,3 +136,38 @@ func (d *KVGetQuery) Stop() {
 func (d *KVGetQuery) SetOptions(opts QueryOptions) {
 	d.opts = opts
 }
+
+// ParentListQuery returns a KVListQuery for the parent "directory" of the
+// key, used to watch many keys with a single query. The prefix has a
+// trailing slash so the list is limited to the parent's own keys. Returns
+// nil if the key has no parent.
+func (d *KVGetQuery) ParentListQuery() *KVListQuery {
+	i := strings.LastIndex(d.key, "/")
+	if i <= 0 {
+		return nil
+	}
+	parent := strings.TrimRight(d.key[:i], "/")
+	if parent == "" {
+		return nil
+	}
+	parent += "/"
+	if d.dc != "" {
+		parent = parent + "@" + d.dc
+	}
+	list, err := NewKVListQuery(parent)
+	if err != nil {
+		return nil
+	}
+	return list
+}
+
+// FromList returns the key's value from the results of a KVListQuery
+// containing it. Returns false if the key is not in the list.
+func (d *KVGetQuery) FromList(pairs []*dep.KeyPair) (string, bool) {
+	for _, pair := range pairs {
+		if pair.Path == d.key {
+			return pair.Value, true
+		}
+	}
+	return "", false
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/hcat/dep"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -344,3 +345,58 @@ func TestKVGetQuery_String(t *testing.T) {
 		})
 	}
 }
+
+func TestKVGetQuery_ParentListQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		i    string
+		exp  string
+	}{
+		{"root", "key", ""},
+		{"leading_slash", "/key", ""},
+		{"parent", "app/key", "kv.list(app/)"},
+		{"nested", "app/nested/key", "kv.list(app/nested/)"},
+		{"double_slash", "app//key", "kv.list(app/)"},
+		{"dc", "app/key@dc1", "kv.list(app/@dc1)"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewKVGetQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list := d.ParentListQuery()
+			if tc.exp == "" {
+				assert.Nil(t, list)
+				return
+			}
+			assert.Equal(t, tc.exp, list.String())
+		})
+	}
+}
+
+func TestKVGetQuery_FromList(t *testing.T) {
+	t.Parallel()
+
+	pairs := []*dep.KeyPair{
+		{Path: "app/a", Key: "a", Value: "1"},
+		{Path: "app/nested/b", Key: "nested/b", Value: "2"},
+	}
+	d, err := NewKVGetQuery("app/nested/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := d.FromList(pairs)
+	assert.True(t, ok)
+	assert.Equal(t, "2", value)
+
+	d, err = NewKVGetQuery("app/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok = d.FromList(pairs)
+	assert.False(t, ok)
+}
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -41,8 +42,13 @@ func NewKVKeysQuery(s string) (*KVKeysQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client.
+// Fetch calls FetchContext with the background context.
 func (d *KVKeysQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client.
+func (d *KVKeysQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -58,9 +64,9 @@ func (d *KVKeysQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMeta
 	//	RawQuery: opts.String(),
 	//})
 
-	list, qm, err := clients.Consul().KV().Keys(d.prefix, "", opts.ToConsulOpts())
+	list, qm, err := clients.Consul().KV().Keys(d.prefix, "", opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	keys := make([]string, len(list))
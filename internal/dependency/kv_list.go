@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"regexp"
@@ -46,8 +47,13 @@ func NewKVListQuery(s string) (*KVListQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Consul API defined by the given client.
+// Fetch calls FetchContext with the background context.
 func (d *KVListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Consul API defined by the given client.
+func (d *KVListQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -63,9 +69,9 @@ func (d *KVListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMeta
 	//	RawQuery: opts.String(),
 	//})
 
-	list, qm, err := clients.Consul().KV().List(d.prefix, opts.ToConsulOpts())
+	list, qm, err := clients.Consul().KV().List(d.prefix, opts.ToConsulOpts().WithContext(ctx))
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, nil, errors.Wrap(classifyError(err), d.String())
 	}
 
 	//log.Printf("[TRACE] %s: returned %d pairs", d, len(list))
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -38,15 +39,22 @@ func NewVaultAgentTokenQuery(path string) (*VaultAgentTokenQuery, error) {
 	}, nil
 }
 
-// Fetch retrieves this dependency and returns the result or any errors that
-// occur in the process.
+// Fetch calls FetchContext with the background context.
 func (d *VaultAgentTokenQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext retrieves this dependency and returns the result or any errors that
+// occur in the process.
+func (d *VaultAgentTokenQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	//log.Printf("[TRACE] %s: READ %s", d, d.path)
 
 	select {
 	case <-d.stopCh:
 		//log.Printf("[TRACE] %s: stopped", d)
 		return "", nil, ErrStopped
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
 	case r := <-d.watch(d.stat):
 		if r.err != nil {
 			return "", nil, errors.Wrap(r.err, d.String())
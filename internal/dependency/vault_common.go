@@ -1,7 +1,10 @@
 package dependency
 
 import (
+	"context"
+	"io"
 	"math/rand"
+	"net/url"
 	"path"
 	"strings"
 	"time"
@@ -24,7 +27,7 @@ type renewer interface {
 	secrets() (*dep.Secret, *api.Secret)
 }
 
-func renewSecret(clients dep.Clients, d renewer) error {
+func renewSecret(ctx context.Context, clients dep.Clients, d renewer) error {
 	//log.Printf("[TRACE] %s: starting renewer", d)
 
 	secret, vaultSecret := d.secrets()
@@ -36,6 +39,7 @@ func renewSecret(clients dep.Clients, d renewer) error {
 	}
 	go renewer.Renew()
 	defer renewer.Stop()
+	waiting(ctx)
 
 	for {
 		select {
@@ -51,10 +55,60 @@ func renewSecret(clients dep.Clients, d renewer) error {
 			updateSecret(secret, renewal.Secret)
 		case <-d.stopChan():
 			return ErrStopped
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
 
+// vaultRequest performs a logical read ("GET"), list ("LIST") or write
+// ("PUT") request with the context. The vault api's Logical() methods don't
+// accept a context, so this mirrors them. Like them, a 404 without data
+// returns a nil secret for reads and lists and the error for writes.
+func vaultRequest(ctx context.Context, client *api.Client, method, path string,
+	params url.Values, data map[string]interface{}) (*api.Secret, error) {
+	r := client.NewRequest(method, "/v1/"+path)
+	if method == "LIST" {
+		// sent as a GET with the list parameter for broader compatibility,
+		// as the vault api does
+		r.Method = "GET"
+		r.Params.Set("list", "true")
+	}
+	for k, v := range params {
+		for _, val := range v {
+			r.Params.Add(k, val)
+		}
+	}
+	if data != nil {
+		if err := r.SetJSONBody(data); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 && method != "PUT" {
+		secret, parseErr := api.ParseSecret(resp.Body)
+		switch parseErr {
+		case nil:
+		case io.EOF:
+			return nil, nil
+		default:
+			return nil, err
+		}
+		if secret != nil && (len(secret.Warnings) > 0 || len(secret.Data) > 0) {
+			return secret, nil
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, classifyError(err)
+	}
+	return api.ParseSecret(resp.Body)
+}
+
 // leaseCheckWait accepts a secret and returns the recommended amount of
 // time to sleep.
 func leaseCheckWait(s *dep.Secret) time.Duration {
@@ -223,7 +277,7 @@ func updateSecret(ours *dep.Secret, theirs *api.Secret) {
 	}
 }
 
-func isKVv2(client *api.Client, path string) (string, bool, error) {
+func isKVv2(ctx context.Context, client *api.Client, path string) (string, bool, error) {
 	// We don't want to use a wrapping call here so save any custom value and
 	// restore after
 	currentWrappingLookupFunc := client.CurrentWrappingLookupFunc()
@@ -234,7 +288,7 @@ func isKVv2(client *api.Client, path string) (string, bool, error) {
 	defer client.SetOutputCurlString(currentOutputCurlString)
 
 	r := client.NewRequest("GET", "/v1/sys/internal/ui/mounts/"+path)
-	resp, err := client.RawRequest(r)
+	resp, err := client.RawRequestWithContext(ctx, r)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
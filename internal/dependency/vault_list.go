@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -38,8 +39,13 @@ func NewVaultListQuery(s string) (*VaultListQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Vault API
+// Fetch calls FetchContext with the background context.
 func (d *VaultListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Vault API
+func (d *VaultListQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -52,10 +58,13 @@ func (d *VaultListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	if opts.WaitIndex != 0 {
 		dur := VaultDefaultLeaseDuration
 		//log.Printf("[TRACE] %s: long polling for %s", d, dur)
+		waiting(ctx)
 
 		select {
 		case <-d.stopCh:
 			return nil, nil, ErrStopped
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
 		case <-time.After(dur):
 		}
 	}
@@ -66,7 +75,8 @@ func (d *VaultListQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	//	Path:     "/v1/" + d.path,
 	//	RawQuery: opts.String(),
 	//})
-	secret, err := clients.Vault().Logical().List(d.path)
+	secret, err := vaultRequest(ctx, clients.Vault(), "LIST",
+		d.path, nil, nil)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, d.String())
 	}
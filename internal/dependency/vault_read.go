@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -54,8 +55,13 @@ func NewVaultReadQuery(s string) (*VaultReadQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Vault API
+// Fetch calls FetchContext with the background context.
 func (d *VaultReadQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Vault API
+func (d *VaultReadQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -63,20 +69,27 @@ func (d *VaultReadQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	}
 	select {
 	case dur := <-d.sleepCh:
-		time.Sleep(dur)
+		waiting(ctx)
+		select {
+		case <-time.After(dur):
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
 	default:
 	}
 
 	firstRun := d.secret == nil
 
 	if !firstRun && vaultSecretRenewable(d.secret) {
-		err := renewSecret(clients, d)
+		err := renewSecret(ctx, clients, d)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, d.String())
 		}
 	}
 
-	err := d.fetchSecret(clients)
+	err := d.fetchSecret(ctx, clients)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, d.String())
 	}
@@ -90,9 +103,9 @@ func (d *VaultReadQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseM
 	return respWithMetadata(d.secret)
 }
 
-func (d *VaultReadQuery) fetchSecret(clients dep.Clients) error {
+func (d *VaultReadQuery) fetchSecret(ctx context.Context, clients dep.Clients) error {
 	opts := d.opts.Merge(&QueryOptions{})
-	vaultSecret, err := d.readSecret(clients, opts)
+	vaultSecret, err := d.readSecret(ctx, clients, opts)
 	if err == nil {
 		printVaultWarnings(d, vaultSecret.Warnings)
 		d.vaultSecret = vaultSecret
@@ -128,12 +141,12 @@ func (d *VaultReadQuery) String() string {
 	return fmt.Sprintf("vault.read(%s)", d.rawPath)
 }
 
-func (d *VaultReadQuery) readSecret(clients dep.Clients, opts *QueryOptions) (*api.Secret, error) {
+func (d *VaultReadQuery) readSecret(ctx context.Context, clients dep.Clients, opts *QueryOptions) (*api.Secret, error) {
 	vaultClient := clients.Vault()
 
 	// Check whether this secret refers to a KV v2 entry if we haven't yet.
 	if d.isKVv2 == nil {
-		mountPath, isKVv2, err := isKVv2(vaultClient, d.rawPath)
+		mountPath, isKVv2, err := isKVv2(ctx, vaultClient, d.rawPath)
 		if err != nil {
 			//log.Printf("[WARN] %s: failed to check if %s is KVv2, "+
 			//	"assume not: %s", d, d.rawPath, err)
@@ -152,14 +165,15 @@ func (d *VaultReadQuery) readSecret(clients dep.Clients, opts *QueryOptions) (*a
 	//	Path:     "/v1/" + d.secretPath,
 	//	RawQuery: queryString,
 	//})
-	vaultSecret, err := vaultClient.Logical().ReadWithData(d.secretPath,
-		d.queryValues)
+	vaultSecret, err := vaultRequest(ctx, vaultClient, "GET",
+		d.secretPath, d.queryValues, nil)
 
 	if err != nil {
 		return nil, errors.Wrap(err, d.String())
 	}
 	if vaultSecret == nil || deletedKVv2(vaultSecret) {
-		return nil, fmt.Errorf("no secret exists at %s", d.secretPath)
+		return nil, dep.Permanent(
+			fmt.Errorf("no secret exists at %s", d.secretPath))
 	}
 	return vaultSecret, nil
 }
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"github.com/hashicorp/hcat/dep"
 	"github.com/hashicorp/vault/api"
 	"github.com/pkg/errors"
@@ -17,6 +18,7 @@ type VaultTokenQuery struct {
 	stopCh      chan struct{}
 	secret      *dep.Secret
 	vaultSecret *api.Secret
+	opts        QueryOptions
 }
 
 // NewVaultTokenQuery creates a new dependency.
@@ -35,8 +37,13 @@ func NewVaultTokenQuery(token string) (*VaultTokenQuery, error) {
 	}, nil
 }
 
-// Fetch queries the Vault API
+// Fetch calls FetchContext with the background context.
 func (d *VaultTokenQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Vault API
+func (d *VaultTokenQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -44,7 +51,7 @@ func (d *VaultTokenQuery) Fetch(clients dep.Clients) (interface{}, *dep.Response
 	}
 
 	if vaultSecretRenewable(d.secret) {
-		err := renewSecret(clients, d)
+		err := renewSecret(ctx, clients, d)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, d.String())
 		}
@@ -76,4 +83,6 @@ func (d *VaultTokenQuery) String() string {
 	return "vault.token"
 }
 
-func (d *VaultTokenQuery) SetOptions(opts QueryOptions) {}
+func (d *VaultTokenQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
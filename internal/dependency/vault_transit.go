@@ -0,0 +1,179 @@
+package dependency
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcat/dep"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ isDependency = (*VaultTransitQuery)(nil)
+)
+
+// TransitOperation is an operation of the Vault Transit secrets engine.
+type TransitOperation string
+
+const (
+	TransitEncrypt TransitOperation = "encrypt"
+	TransitDecrypt TransitOperation = "decrypt"
+	TransitHMAC    TransitOperation = "hmac"
+	TransitSign    TransitOperation = "sign"
+)
+
+// transitIDKey is the key of the hashes of the inputs in the IDs of transit
+// queries. It's random, so the inputs can't be guessed from the IDs, as
+// they can be for VaultWriteQuery's, and only stable for the process.
+var transitIDKey = func() []byte {
+	k := make([]byte, sha256.Size)
+	if _, err := rand.Read(k); err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+// VaultTransitQuery is the dependency to an operation of Vault's Transit
+// secrets engine, eg. encrypting a value with a key. The result of an
+// operation doesn't change, so it is fetched once. Encryption in particular
+// gives a different ciphertext every time, which would re-render the
+// template.
+type VaultTransitQuery struct {
+	isVault
+	stopCh chan struct{}
+
+	op    TransitOperation
+	mount string
+	key   string
+	input string
+	// inputHash identifies the input in the ID, without exposing it
+	inputHash string
+
+	fetched bool
+	opts    QueryOptions
+}
+
+// NewVaultTransitQuery creates a new transit dependency, of the operation
+// with the key, "<mount>/<name>" or a name in the "transit" mount, on the
+// input. The input is the plaintext, or the ciphertext to decrypt.
+func NewVaultTransitQuery(op TransitOperation, key, input string) (*VaultTransitQuery, error) {
+	switch op {
+	case TransitEncrypt, TransitDecrypt, TransitHMAC, TransitSign:
+	default:
+		return nil, fmt.Errorf("vault.transit: invalid operation: %q", op)
+	}
+	key = strings.Trim(strings.TrimSpace(key), "/")
+	mount, name := "transit", key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		mount, name = key[:i], key[i+1:]
+	}
+	if name == "" {
+		return nil, fmt.Errorf("vault.transit: invalid key: %q", key)
+	}
+
+	h := hmac.New(sha256.New, transitIDKey)
+	h.Write([]byte(input))
+	return &VaultTransitQuery{
+		stopCh:    make(chan struct{}, 1),
+		op:        op,
+		mount:     mount,
+		key:       name,
+		input:     input,
+		inputHash: fmt.Sprintf("%.8x", h.Sum(nil)),
+	}, nil
+}
+
+// Fetch calls FetchContext with the background context.
+func (d *VaultTransitQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Vault API, the first time, and then blocks until the
+// query is stopped.
+func (d *VaultTransitQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	if d.fetched {
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	var body map[string]interface{}
+	switch d.op {
+	case TransitDecrypt:
+		body = map[string]interface{}{"ciphertext": d.input}
+	case TransitEncrypt:
+		body = map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString([]byte(d.input))}
+	default:
+		body = map[string]interface{}{
+			"input": base64.StdEncoding.EncodeToString([]byte(d.input))}
+	}
+	secret, err := vaultRequest(ctx, clients.Vault(), "PUT",
+		fmt.Sprintf("%s/%s/%s", d.mount, d.op, d.key), nil, body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	if secret == nil {
+		return nil, nil, errors.Wrap(dep.Permanent(errors.New("no response")), d.String())
+	}
+	printVaultWarnings(d, secret.Warnings)
+
+	field := map[TransitOperation]string{
+		TransitEncrypt: "ciphertext",
+		TransitDecrypt: "plaintext",
+		TransitHMAC:    "hmac",
+		TransitSign:    "signature",
+	}[d.op]
+	result, ok := secret.Data[field].(string)
+	if !ok {
+		return nil, nil, errors.Wrap(dep.Permanent(
+			fmt.Errorf("no %s in response", field)), d.String())
+	}
+	if d.op == TransitDecrypt {
+		plain, err := base64.StdEncoding.DecodeString(result)
+		if err != nil {
+			return nil, nil, errors.Wrap(dep.Permanent(
+				errors.New("invalid plaintext in response")), d.String())
+		}
+		result = string(plain)
+	}
+
+	d.fetched = true
+	return respWithMetadata(result)
+}
+
+// CanShare returns if this dependency is shareable. It isn't, as the result
+// of decrypting is sensitive.
+func (d *VaultTransitQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultTransitQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency. The input
+// is only identified by its keyed hash.
+func (d *VaultTransitQuery) String() string {
+	return fmt.Sprintf("vault.transit(%s %s/%s -> %s)", d.op, d.mount, d.key, d.inputHash)
+}
+
+func (d *VaultTransitQuery) SetOptions(opts QueryOptions) {
+	d.opts = opts
+}
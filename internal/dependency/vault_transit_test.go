@@ -0,0 +1,55 @@
+package dependency
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVaultTransitQuery(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		op    TransitOperation
+		key   string
+		mount string
+		kname string
+		err   bool
+	}{
+		{"name", TransitEncrypt, "app", "transit", "app", false},
+		{"mount", TransitDecrypt, "/keys/transit/app/", "keys/transit", "app", false},
+		{"empty_key", TransitHMAC, "", "", "", true},
+		{"slash", TransitSign, "/", "", "", true},
+		{"invalid_op", TransitOperation("rewrap"), "app", "", "", true},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewVaultTransitQuery(tc.op, tc.key, "input")
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if tc.err {
+				return
+			}
+			assert.Equal(t, tc.mount, act.mount)
+			assert.Equal(t, tc.kname, act.key)
+		})
+	}
+}
+
+func TestVaultTransitQuery_String(t *testing.T) {
+	t.Parallel()
+
+	a, _ := NewVaultTransitQuery(TransitEncrypt, "app", "s3cr3t")
+	b, _ := NewVaultTransitQuery(TransitEncrypt, "app", "s3cr3t")
+	c, _ := NewVaultTransitQuery(TransitEncrypt, "app", "other")
+
+	assert.True(t, strings.HasPrefix(a.String(), "vault.transit(encrypt transit/app -> "))
+	assert.Equal(t, a.String(), b.String())
+	assert.NotEqual(t, a.String(), c.String())
+	assert.NotContains(t, a.String(), "s3cr3t")
+}
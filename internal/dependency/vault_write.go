@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"crypto/sha1"
 	"fmt"
 	"io"
@@ -51,8 +52,13 @@ func NewVaultWriteQuery(s string, d map[string]interface{}) (*VaultWriteQuery, e
 	}, nil
 }
 
-// Fetch queries the Vault API
+// Fetch calls FetchContext with the background context.
 func (d *VaultWriteQuery) Fetch(clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), clients)
+}
+
+// FetchContext queries the Vault API
+func (d *VaultWriteQuery) FetchContext(ctx context.Context, clients dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
 	select {
 	case <-d.stopCh:
 		return nil, nil, ErrStopped
@@ -60,21 +66,28 @@ func (d *VaultWriteQuery) Fetch(clients dep.Clients) (interface{}, *dep.Response
 	}
 	select {
 	case dur := <-d.sleepCh:
-		time.Sleep(dur)
+		waiting(ctx)
+		select {
+		case <-time.After(dur):
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
 	default:
 	}
 
 	firstRun := d.secret == nil
 
 	if !firstRun && vaultSecretRenewable(d.secret) {
-		err := renewSecret(clients, d)
+		err := renewSecret(ctx, clients, d)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, d.String())
 		}
 	}
 
 	opts := d.opts.Merge(&QueryOptions{})
-	vaultSecret, err := d.writeSecret(clients, opts)
+	vaultSecret, err := d.writeSecret(ctx, clients, opts)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, d.String())
 	}
@@ -146,7 +159,7 @@ func (d *VaultWriteQuery) printWarnings(warnings []string) {
 	//	}
 }
 
-func (d *VaultWriteQuery) writeSecret(clients dep.Clients, opts *QueryOptions) (*api.Secret, error) {
+func (d *VaultWriteQuery) writeSecret(ctx context.Context, clients dep.Clients, opts *QueryOptions) (*api.Secret, error) {
 	//log.Printf("[TRACE] %s: PUT %s", d, &url.URL{
 	//	Path:     "/v1/" + d.path,
 	//	RawQuery: opts.String(),
@@ -154,12 +167,13 @@ func (d *VaultWriteQuery) writeSecret(clients dep.Clients, opts *QueryOptions) (
 
 	data := d.data
 
-	_, isv2, _ := isKVv2(clients.Vault(), d.path)
+	_, isv2, _ := isKVv2(ctx, clients.Vault(), d.path)
 	if isv2 {
 		data = map[string]interface{}{"data": d.data}
 	}
 
-	vaultSecret, err := clients.Vault().Logical().Write(d.path, data)
+	vaultSecret, err := vaultRequest(ctx, clients.Vault(), "PUT",
+		d.path, nil, data)
 	if err != nil {
 		return nil, errors.Wrap(err, d.String())
 	}
@@ -1,6 +1,7 @@
 package dependency
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"testing"
@@ -102,7 +103,7 @@ func TestVaultWriteSecretKV_Fetch(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		act, err := rq.readSecret(clients, nil)
+		act, err := rq.readSecret(context.Background(), clients, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -136,7 +137,7 @@ func TestVaultWriteSecretKV_Fetch(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		act, err := rq.readSecret(clients, nil)
+		act, err := rq.readSecret(context.Background(), clients, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
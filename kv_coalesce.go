@@ -0,0 +1,171 @@
+package hcat
+
+import (
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// KV key coalescing.
+//
+// Templates that look up many keys under a common path (eg. `key "app/a"`,
+// `key "app/b"`, ...) would start one view and one blocking query per key.
+// When the number of keys under a parent path reaches the configured
+// threshold, the Watcher instead watches the parent path with a single KV
+// list query and fans out the results to the cache entries of the
+// individual keys. This is transparent to the template functions which keep
+// looking up the individual keys in the cache.
+//
+// Only the lookups of single keys (`key`, `keyExists` and `keyOrDefault`,
+// which all use a KVGetQuery) are coalesced. The parent path is listed with
+// a trailing slash, so the list doesn't include the keys of its siblings
+// sharing its name as a prefix (eg. `apple/` for `app`). A template's `ls`
+// or `tree` of the parent with a trailing slash shares the same view.
+
+// kvGroup is the set of KV key lookups under a common parent path.
+type kvGroup struct {
+	list *idep.KVListQuery
+	// keys are the key lookups in the group, by dependency ID. Until the
+	// group is active they are the candidates for coalescing.
+	keys map[string]*idep.KVGetQuery
+	// view is the view of the list query, nil until the group is active.
+	view *view
+}
+
+// coalesceKV adds the key lookup to its group, activating the group if it
+// reached the threshold. Returns true if the key is watched by the group and
+// doesn't need its own view. The caller must hold the depViewMapMx lock.
+func (w *Watcher) coalesceKV(kv *idep.KVGetQuery) bool {
+	if w.kvCoalesceThreshold <= 0 {
+		return false
+	}
+	list := kv.ParentListQuery()
+	if list == nil {
+		return false
+	}
+
+	g, ok := w.kvGroups[list.String()]
+	if !ok {
+		g = &kvGroup{list: list, keys: make(map[string]*idep.KVGetQuery)}
+		w.kvGroups[list.String()] = g
+	}
+	g.keys[kv.String()] = kv
+
+	if g.view != nil {
+		w.kvKeys[kv.String()] = g
+		w.own(kv)
+		// Republish the group's current data so the new key gets its value
+		// fanned out on the next Wait. A view without data will publish its
+		// own once it has some.
+		w.republish(g.view)
+		return true
+	}
+
+	if len(g.keys) < w.kvCoalesceThreshold {
+		return false
+	}
+
+	// Activate the group, re-using the list query's view if a template
+	// already watches it.
+	if v, ok := w.depViewMap[list.String()]; ok {
+		g.view = v
+		w.republish(v)
+	} else {
+		g.view = w.startView(list)
+	}
+	for id := range g.keys {
+		if v, ok := w.depViewMap[id]; ok {
+			v.stop()
+			delete(w.depViewMap, id)
+		}
+		w.kvKeys[id] = g
+	}
+	return true
+}
+
+// republish sends the view's data for the watcher to process again, if the
+// view has any.
+func (w *Watcher) republish(v *view) {
+	if !v.received() {
+		return
+	}
+	select {
+	case w.dataCh <- v:
+	default:
+	}
+}
+
+// fanOutKV updates the cache entries of the keys coalesced into the list
+// query with the given ID. Only keys whose values changed are marked as
+// changed. Keys missing from the list are left as they are, as a key lookup
+// view skips the empty results of its blocking query: a key that never
+// existed stays uncached and a deleted key keeps its previous value.
+func (w *Watcher) fanOutKV(listID string, data interface{}, index uint64) {
+	pairs, ok := data.([]*dep.KeyPair)
+	if !ok {
+		return
+	}
+
+	w.depViewMapMx.Lock()
+	defer w.depViewMapMx.Unlock()
+
+	g, ok := w.kvGroups[listID]
+	if !ok || g.view == nil {
+		return
+	}
+	for id, kv := range g.keys {
+		value, ok := kv.FromList(pairs)
+		if !ok {
+			continue
+		}
+		if old, found := w.cache.Recall(id); found && old == value {
+			continue
+		}
+		w.cache.Save(id, value)
+		w.changed.Add(id)
+		w.recordChange(id, index)
+		w.notify(id, value, index)
+	}
+}
+
+// removeKV removes the key lookup from its group. Returns true if the key
+// was coalesced, ie. it had no view of its own, and so is fully removed.
+// The caller must hold the depViewMapMx lock.
+func (w *Watcher) removeKV(id string) bool {
+	if g, ok := w.kvKeys[id]; ok {
+		delete(w.kvKeys, id)
+		delete(g.keys, id)
+		w.dropCache(id)
+		w.forgetIndex(id)
+		return true
+	}
+
+	// remove candidate for coalescing
+	if v, ok := w.depViewMap[id]; ok {
+		if kv, ok := v.Dependency().(*idep.KVGetQuery); ok {
+			if list := kv.ParentListQuery(); list != nil {
+				if g, ok := w.kvGroups[list.String()]; ok {
+					delete(g.keys, id)
+					if len(g.keys) == 0 && g.view == nil {
+						delete(w.kvGroups, list.String())
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// kvInUse returns true if the ID is of a list query view that is serving
+// coalesced key lookups. If the view is no longer serving any, its group is
+// dropped. The caller must hold the depViewMapMx lock.
+func (w *Watcher) kvInUse(id string) bool {
+	g, ok := w.kvGroups[id]
+	if !ok || g.view == nil {
+		return false
+	}
+	if len(g.keys) > 0 {
+		return true
+	}
+	delete(w.kvGroups, id)
+	return false
+}
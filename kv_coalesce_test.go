@@ -0,0 +1,245 @@
+package hcat
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestWatcherKVCoalesce(t *testing.T) {
+	kv := map[string]string{
+		"app/a":   "1",
+		"app/b":   "2",
+		"app/c":   "3",
+		"apple/a": "4",
+		"foo":     "bar",
+	}
+	srv := fakeConsulKV(t, kv)
+	defer srv.Close()
+
+	newKVWatcher := func() *Watcher {
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: srv.URL}); err != nil {
+			t.Fatal(err)
+		}
+		return NewWatcher(WatcherInput{
+			Clients:                   clients,
+			ConsulKVCoalesceThreshold: 2,
+		})
+	}
+	kvDep := func(key string) *idep.KVGetQuery {
+		d, err := idep.NewKVGetQuery(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	recall := func(w *Watcher, d *idep.KVGetQuery) string {
+		v, ok := w.Recall(d.String())
+		if !ok {
+			t.Fatalf("%s not in cache", d)
+		}
+		return v.(string)
+	}
+
+	t.Run("coalesce", func(t *testing.T) {
+		w := newKVWatcher()
+		defer w.Close()
+		a, b, c := kvDep("app/a"), kvDep("app/b"), kvDep("app/c")
+		w.Register("tmpl", a, b, c)
+
+		w.Add(a)
+		if w.Size() != 1 {
+			t.Fatal("expected 1 view, got:", w.Size())
+		}
+		if !w.Add(b) {
+			t.Fatal("expected add to return true")
+		}
+		// a and b are now watched via the app/ prefix
+		if w.Size() != 1 {
+			t.Fatal("expected 1 view, got:", w.Size())
+		}
+		if !w.Watching(a.String()) || !w.Watching(b.String()) {
+			t.Fatal("expected keys to be watched")
+		}
+		if w.Add(b) {
+			t.Fatal("expected add to return false")
+		}
+		for !changedHas(w, b.String()) {
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v := recall(w, a); v != "1" {
+			t.Fatal("bad value:", v)
+		}
+		if v := recall(w, b); v != "2" {
+			t.Fatal("bad value:", v)
+		}
+
+		// added to the active group
+		w.Add(c)
+		if w.Size() != 1 {
+			t.Fatal("expected 1 view, got:", w.Size())
+		}
+		for !changedHas(w, c.String()) {
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v := recall(w, c); v != "3" {
+			t.Fatal("bad value:", v)
+		}
+		if st := w.DependencyStatus(c.String()); !st.Watching {
+			t.Fatalf("bad status: %#v", st)
+		}
+	})
+	t.Run("list-view", func(t *testing.T) {
+		w := newKVWatcher()
+		defer w.Close()
+		// as used by `ls "app/"` in a template
+		list, err := idep.NewKVListQuery("app/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Register("tmpl", list)
+		w.Add(list)
+		w.Add(kvDep("app/a"))
+		w.Add(kvDep("app/b"))
+		// the keys are watched by the list's view
+		if w.Size() != 1 {
+			t.Fatal("expected 1 view, got:", w.Size())
+		}
+		if !w.Watching(list.String()) {
+			t.Fatal("expected the list to be watched")
+		}
+		for !changedHas(w, list.String()) {
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// keys of siblings sharing the parent's name aren't listed
+		v, _ := w.Recall(list.String())
+		for _, pair := range v.([]*dep.KeyPair) {
+			if !strings.HasPrefix(pair.Path, "app/") {
+				t.Fatal("unexpected key in list:", pair.Path)
+			}
+		}
+	})
+	t.Run("missing-key", func(t *testing.T) {
+		w := newKVWatcher()
+		defer w.Close()
+		a, missing := kvDep("app/a"), kvDep("app/missing")
+		w.Register("tmpl", a, missing)
+		w.Add(a)
+		w.Add(missing)
+		if w.Size() != 1 {
+			t.Fatal("expected 1 view, got:", w.Size())
+		}
+		for !changedHas(w, a.String()) {
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// left uncached, as with a view of its own, so it is still missing
+		if changedHas(w, missing.String()) {
+			t.Fatal("missing key should not be changed")
+		}
+		if v, ok := w.Recall(missing.String()); ok {
+			t.Fatal("missing key should not be cached, got:", v)
+		}
+	})
+	t.Run("root-key", func(t *testing.T) {
+		w := newKVWatcher()
+		defer w.Close()
+		w.Add(kvDep("foo"))
+		w.Add(kvDep("app/a"))
+		if w.Size() != 2 {
+			t.Fatal("expected 2 views, got:", w.Size())
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		w.Add(kvDep("app/a"))
+		w.Add(kvDep("app/b"))
+		if w.Size() != 2 {
+			t.Fatal("expected 2 views, got:", w.Size())
+		}
+	})
+	t.Run("clean", func(t *testing.T) {
+		w := newKVWatcher()
+		defer w.Close()
+		a, b := kvDep("app/a"), kvDep("app/b")
+		w.Register("tmpl", a, b)
+		w.Add(a)
+		w.Add(b)
+
+		w.Register("tmpl", a)
+		w.cleanDeps(nil)
+		if w.Watching(b.String()) {
+			t.Fatal("expected key to be removed")
+		}
+		if !w.Watching(a.String()) || w.Size() != 1 {
+			t.Fatal("expected key to still be watched")
+		}
+
+		w.Register("tmpl", kvDep("foo"))
+		w.cleanDeps(nil)
+		w.cleanDeps(nil)
+		if w.Watching(a.String()) || w.Size() != 0 {
+			t.Fatal("expected all to be removed, views:", w.Size())
+		}
+	})
+}
+
+func changedHas(w *Watcher, id string) bool {
+	_, ok := w.changed.Map()[id]
+	return ok
+}
+
+// fakeConsulKV serves the KV get, list and put endpoints from the map, along
+// with the leader status required to create the client.
+func fakeConsulKV(t *testing.T, kv map[string]string) *httptest.Server {
+	var mux sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/v1/status/leader" {
+				rw.Write([]byte(`"127.0.0.1:8300"`))
+				return
+			}
+			mux.Lock()
+			defer mux.Unlock()
+			path := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+			if req.Method == http.MethodPut {
+				b, _ := ioutil.ReadAll(req.Body)
+				kv[path] = string(b)
+				rw.Write([]byte("true"))
+				return
+			}
+			_, recurse := req.URL.Query()["recurse"]
+			pairs := consulapi.KVPairs{}
+			for k, v := range kv {
+				if k == path || (recurse && strings.HasPrefix(k, path)) {
+					pairs = append(pairs, &consulapi.KVPair{
+						Key: k, Value: []byte(v), ModifyIndex: 1,
+					})
+				}
+			}
+			rw.Header().Set("X-Consul-Index", "1")
+			if len(pairs) == 0 {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(rw).Encode(pairs)
+		}))
+}
@@ -0,0 +1,174 @@
+package hcat
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestWatcherLeaks(t *testing.T) {
+	t.Run("new-watcher", func(t *testing.T) {
+		defer checkLeaks(t)()
+		w := newWatcher(t)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("views", func(t *testing.T) {
+		defer checkLeaks(t)()
+		w := newWatcher(t)
+		for _, name := range []string{"a", "b", "c"} {
+			d := &idep.FakeDep{Name: name}
+			w.Register("tmpl", d)
+			w.Add(d)
+		}
+		if err := w.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("buffer-period", func(t *testing.T) {
+		defer checkLeaks(t)()
+		w := newWatcher(t)
+		w.SetBufferPeriod(time.Hour, time.Hour, "tmpl")
+		w.Register("tmpl", &idep.FakeDep{Name: "a"})
+		if w.Buffer("tmpl") {
+			t.Fatal("buffer should not be active yet")
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("blocking-query", func(t *testing.T) {
+		defer checkLeaks(t)()
+		requestCh := make(chan struct{}, 1)
+		srv := httptest.NewServer(http.HandlerFunc(
+			func(rw http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v1/status/leader" {
+					rw.Write([]byte(`"127.0.0.1:8300"`))
+					return
+				}
+				requestCh <- struct{}{}
+				<-req.Context().Done()
+			}))
+		defer srv.Close()
+
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: srv.URL}); err != nil {
+			t.Fatal(err)
+		}
+		w := NewWatcher(WatcherInput{
+			Clients:         clients,
+			ConsulBlockWait: time.Minute,
+		})
+		d, err := idep.NewKVGetQuery("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Add(d)
+		<-requestCh
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("wait-channel", func(t *testing.T) {
+		defer checkLeaks(t)()
+		w := newWatcher(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		w.WaitCh(ctx) // result never read
+		cancel()
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("restart", func(t *testing.T) {
+		defer checkLeaks(t)()
+		w := newWatcher(t)
+		w.SetBufferPeriod(time.Hour, time.Hour, "tmpl")
+		w.Add(&idep.FakeDep{Name: "a"})
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		w.SetBufferPeriod(time.Hour, time.Hour, "tmpl")
+		w.Add(&idep.FakeDep{Name: "a"})
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("stop-timeout", func(t *testing.T) {
+		defer checkLeaks(t)()
+		w := newWatcher(t)
+		d := &stuckDep{
+			startedCh: make(chan struct{}, 1),
+			releaseCh: make(chan struct{}),
+		}
+		w.Add(d)
+		<-d.startedCh
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			10*time.Millisecond)
+		defer cancel()
+		err := w.Stop(ctx)
+		if err == nil || !strings.Contains(err.Error(), d.String()) {
+			t.Fatal("expected error naming the running view, got:", err)
+		}
+
+		close(d.releaseCh)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// stuckDep is a dependency that ignores both Stop and its context until it
+// is released.
+type stuckDep struct {
+	startedCh chan struct{}
+	releaseCh chan struct{}
+}
+
+func (d *stuckDep) Fetch(dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	return d.FetchContext(context.Background(), nil)
+}
+
+func (d *stuckDep) FetchContext(context.Context, dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	select {
+	case d.startedCh <- struct{}{}:
+	default:
+	}
+	<-d.releaseCh
+	return nil, nil, dep.ErrStopped
+}
+
+func (d *stuckDep) String() string { return "stuck" }
+func (d *stuckDep) Stop()          {}
+
+// checkLeaks records the number of running goroutines and returns a func
+// that fails the test if there are more when it is called. Goroutines are
+// given a short grace period to finish exiting.
+func checkLeaks(t *testing.T) func() {
+	before := runtime.NumGoroutine()
+	return func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if after := runtime.NumGoroutine(); after > before {
+			var buf bytes.Buffer
+			pprof.Lookup("goroutine").WriteTo(&buf, 1)
+			t.Fatalf("goroutine leak: %d before, %d after\n%s",
+				before, after, buf.String())
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package hcat
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimitInput configures the limits on requests made to an upstream
+// service (Consul or Vault). The limits are shared by all views using that
+// service to prevent a thundering herd of re-queries, for example after a
+// Consul leader election.
+type RateLimitInput struct {
+	// RequestsPerSecond is the sustained rate of requests allowed.
+	// Zero means no limit.
+	RequestsPerSecond float64
+	// Burst is the maximum number of requests allowed at once above the
+	// sustained rate. Defaults to 1 if RequestsPerSecond is set.
+	Burst int
+	// MaxInFlight caps the number of concurrent requests of the views that
+	// have no data yet or are reconnecting after an error. Blocking queries
+	// aren't capped, and a request frees its slot once it waits, for example
+	// on a Vault lease to renew, so waiting views don't starve the others.
+	// Zero means no limit.
+	MaxInFlight int
+	// ReconnectJitter is the maximum random delay added to the retry wait
+	// after an error, to spread out reconnects.
+	ReconnectJitter time.Duration
+}
+
+// RequestStats are statistics on the requests to an upstream service.
+type RequestStats struct {
+	// Requests is the total number of requests made.
+	Requests uint64 `json:"requests"`
+	// Throttled is the number of requests delayed by the limits.
+	Throttled uint64 `json:"throttled"`
+	// InFlight is the number of requests currently in progress.
+	InFlight int64 `json:"in_flight"`
+	// Waiting is the number of requests currently delayed by the limits.
+	Waiting int64 `json:"waiting"`
+}
+
+// limiter enforces the RateLimitInput limits. A nil limiter has no limits
+// and keeps no stats.
+type limiter struct {
+	// stats, accessed atomically (first for 64-bit alignment)
+	requests  uint64
+	throttled uint64
+	inFlight  int64
+	waiting   int64
+
+	rate   *rate.Limiter
+	sem    chan struct{}
+	jitter time.Duration
+}
+
+func newLimiter(i RateLimitInput) *limiter {
+	l := &limiter{jitter: i.ReconnectJitter}
+	if i.RequestsPerSecond > 0 {
+		burst := i.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		l.rate = rate.NewLimiter(rate.Limit(i.RequestsPerSecond), burst)
+	}
+	if i.MaxInFlight > 0 {
+		l.sem = make(chan struct{}, i.MaxInFlight)
+	}
+	return l
+}
+
+// acquire blocks until a request is allowed by the limits, taking an
+// in-flight slot if slot is true. It returns false if stopCh was closed
+// first, in which case neither freeSlot nor release must be called.
+func (l *limiter) acquire(stopCh <-chan struct{}, slot bool) bool {
+	if l == nil {
+		return true
+	}
+	atomic.AddUint64(&l.requests, 1)
+
+	var throttled bool
+	if l.rate != nil {
+		r := l.rate.Reserve()
+		if delay := r.Delay(); delay > 0 {
+			throttled = true
+			atomic.AddInt64(&l.waiting, 1)
+			select {
+			case <-time.After(delay):
+				atomic.AddInt64(&l.waiting, -1)
+			case <-stopCh:
+				atomic.AddInt64(&l.waiting, -1)
+				r.Cancel()
+				return false
+			}
+		}
+	}
+
+	if slot && l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			throttled = true
+			atomic.AddInt64(&l.waiting, 1)
+			select {
+			case l.sem <- struct{}{}:
+				atomic.AddInt64(&l.waiting, -1)
+			case <-stopCh:
+				atomic.AddInt64(&l.waiting, -1)
+				return false
+			}
+		}
+	}
+
+	if throttled {
+		atomic.AddUint64(&l.throttled, 1)
+	}
+	atomic.AddInt64(&l.inFlight, 1)
+	return true
+}
+
+// freeSlot frees the in-flight slot taken by acquire.
+func (l *limiter) freeSlot() {
+	if l == nil || l.sem == nil {
+		return
+	}
+	<-l.sem
+}
+
+// release ends the request.
+func (l *limiter) release() {
+	if l == nil {
+		return
+	}
+	atomic.AddInt64(&l.inFlight, -1)
+}
+
+// reconnectJitter returns a random duration to add to retries.
+func (l *limiter) reconnectJitter() time.Duration {
+	if l == nil || l.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(l.jitter)))
+}
+
+func (l *limiter) stats() RequestStats {
+	if l == nil {
+		return RequestStats{}
+	}
+	return RequestStats{
+		Requests:  atomic.LoadUint64(&l.requests),
+		Throttled: atomic.LoadUint64(&l.throttled),
+		InFlight:  atomic.LoadInt64(&l.inFlight),
+		Waiting:   atomic.LoadInt64(&l.waiting),
+	}
+}
@@ -0,0 +1,350 @@
+package hcat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var l *limiter
+		if !l.acquire(nil, true) {
+			t.Fatal("nil limiter should not block")
+		}
+		l.freeSlot()
+		l.release()
+		if l.reconnectJitter() != 0 {
+			t.Fatal("nil limiter should have no jitter")
+		}
+		if l.stats() != (RequestStats{}) {
+			t.Fatal("nil limiter should have empty stats")
+		}
+	})
+	t.Run("rate", func(t *testing.T) {
+		l := newLimiter(RateLimitInput{RequestsPerSecond: 100, Burst: 1})
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if !l.acquire(nil, false) {
+				t.Fatal("acquire failed")
+			}
+			l.release()
+		}
+		// 1 burst + 2 at 10ms intervals
+		if dur := time.Since(start); dur < 15*time.Millisecond {
+			t.Fatal("requests not rate limited:", dur)
+		}
+		stats := l.stats()
+		if stats.Requests != 3 || stats.Throttled != 2 || stats.InFlight != 0 {
+			t.Fatalf("bad stats: %#v", stats)
+		}
+	})
+	t.Run("max-in-flight", func(t *testing.T) {
+		l := newLimiter(RateLimitInput{MaxInFlight: 1})
+		if !l.acquire(nil, true) {
+			t.Fatal("acquire failed")
+		}
+		// requests without a slot aren't capped
+		if !l.acquire(nil, false) {
+			t.Fatal("acquire failed")
+		}
+		l.release()
+		acquired := make(chan bool)
+		go func() { acquired <- l.acquire(nil, true) }()
+		select {
+		case <-acquired:
+			t.Fatal("in-flight limit exceeded")
+		case <-time.After(10 * time.Millisecond):
+		}
+		if stats := l.stats(); stats.InFlight != 1 || stats.Waiting != 1 {
+			t.Fatalf("bad stats: %#v", stats)
+		}
+		l.freeSlot()
+		if !<-acquired {
+			t.Fatal("acquire failed")
+		}
+		if stats := l.stats(); stats.InFlight != 2 || stats.Waiting != 0 {
+			t.Fatalf("bad stats: %#v", stats)
+		}
+		l.freeSlot()
+		l.release()
+		l.release()
+	})
+	t.Run("stop", func(t *testing.T) {
+		l := newLimiter(RateLimitInput{MaxInFlight: 1})
+		l.acquire(nil, true)
+		stopCh := make(chan struct{})
+		close(stopCh)
+		if l.acquire(stopCh, true) {
+			t.Fatal("acquire should fail when stopped")
+		}
+		if stats := l.stats(); stats.Waiting != 0 || stats.InFlight != 1 {
+			t.Fatalf("bad stats: %#v", stats)
+		}
+	})
+	t.Run("jitter", func(t *testing.T) {
+		l := newLimiter(RateLimitInput{ReconnectJitter: time.Millisecond})
+		for i := 0; i < 10; i++ {
+			if j := l.reconnectJitter(); j < 0 || j >= time.Millisecond {
+				t.Fatal("bad jitter:", j)
+			}
+		}
+	})
+	t.Run("view", func(t *testing.T) {
+		l := newLimiter(RateLimitInput{MaxInFlight: 1})
+		vw := newView(&newViewInput{
+			Dependency: &idep.FakeDep{},
+			Limiter:    l,
+		})
+		viewCh := make(chan *view)
+		errCh := make(chan error)
+		go vw.poll(viewCh, errCh)
+		defer vw.stop()
+
+		select {
+		case <-viewCh:
+		case err := <-errCh:
+			t.Fatal(err)
+		}
+		if stats := l.stats(); stats.Requests < 1 {
+			t.Fatalf("bad stats: %#v", stats)
+		}
+	})
+	t.Run("watcher", func(t *testing.T) {
+		// fails all requests but the leader check done on client creation,
+		// vault's with statuses its client doesn't retry
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v1/status/leader":
+					fmt.Fprint(w, `"127.0.0.1:8300"`)
+				case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/"):
+					w.WriteHeader(http.StatusNotFound)
+				case strings.HasPrefix(r.URL.Path, "/v1/secret/"):
+					w.WriteHeader(http.StatusForbidden)
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+		defer ts.Close()
+
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: ts.URL}); err != nil {
+			t.Fatal(err)
+		}
+		if err := clients.AddVault(VaultInput{Address: ts.URL}); err != nil {
+			t.Fatal(err)
+		}
+		// the retry funcs are picked by the same dependency types
+		retried := func(ch chan struct{}) RetryFunc {
+			return func(int) (bool, time.Duration) {
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+				return false, 0
+			}
+		}
+		consulRetried := make(chan struct{}, 1)
+		vaultRetried := make(chan struct{}, 1)
+		w := NewWatcher(WatcherInput{
+			Clients:         clients,
+			Cache:           NewStore(),
+			ConsulRateLimit: RateLimitInput{MaxInFlight: 1},
+			VaultRateLimit:  RateLimitInput{MaxInFlight: 1},
+			ConsulRetryFunc: retried(consulRetried),
+			VaultRetryFunc:  retried(vaultRetried),
+		})
+		defer w.Close()
+
+		kv, err := idep.NewKVGetQuery("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret, err := idep.NewVaultReadQuery("secret/foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Add(kv)
+		w.Add(secret)
+
+		w.depViewMapMx.Lock()
+		kvLimiter := w.depViewMap[kv.String()].limiter
+		secretLimiter := w.depViewMap[secret.String()].limiter
+		w.depViewMapMx.Unlock()
+		if kvLimiter != w.limiterConsul {
+			t.Fatal("consul dependency should use the consul limiter")
+		}
+		if secretLimiter != w.limiterVault {
+			t.Fatal("vault dependency should use the vault limiter")
+		}
+		for name, ch := range map[string]chan struct{}{
+			"consul": consulRetried, "vault": vaultRetried,
+		} {
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s retry func not called", name)
+			}
+		}
+	})
+	t.Run("blocking-views", func(t *testing.T) {
+		ts, update := fakeBlockingConsulKV(map[string]string{"a": "1", "b": "2", "c": "3"})
+		defer ts.Close()
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: ts.URL}); err != nil {
+			t.Fatal(err)
+		}
+
+		// more views than slots, all blocking once they have data
+		l := newLimiter(RateLimitInput{MaxInFlight: 1})
+		viewCh := make(chan *view)
+		errCh := make(chan error)
+		for _, key := range []string{"a", "b", "c"} {
+			d, err := idep.NewKVGetQuery(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vw := newView(&newViewInput{
+				Dependency:    d,
+				Clients:       clients,
+				BlockWaitTime: time.Minute,
+				Limiter:       l,
+			})
+			go vw.poll(viewCh, errCh)
+			defer vw.stop()
+		}
+		receive := func() *view {
+			select {
+			case vw := <-viewCh:
+				return vw
+			case err := <-errCh:
+				t.Fatal(err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("views starved: %#v", l.stats())
+			}
+			return nil
+		}
+		for i := 0; i < 3; i++ {
+			receive()
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for stats := l.stats(); stats.InFlight != 3 || stats.Waiting != 0; stats = l.stats() {
+			if time.Now().After(deadline) {
+				t.Fatalf("blocking queries not all in flight: %#v", stats)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		update("c", "4")
+		vw := receive()
+		if data, _ := vw.DataAndLastIndex(); data != "4" {
+			t.Fatalf("bad data: %#v", data)
+		}
+	})
+	t.Run("waiting-frees-slot", func(t *testing.T) {
+		var mux sync.Mutex
+		var renewals int
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/auth/token/renew-self" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				mux.Lock()
+				renewals++
+				mux.Unlock()
+				fmt.Fprint(w, `{"auth": {"client_token": "token", "renewable": true,
+					"lease_duration": 3600}}`)
+			}))
+		defer ts.Close()
+		clients := NewClientSet()
+		if err := clients.AddVault(VaultInput{Address: ts.URL}); err != nil {
+			t.Fatal(err)
+		}
+
+		// the token views wait on their renewal from the first request
+		l := newLimiter(RateLimitInput{MaxInFlight: 1})
+		for i := 0; i < 2; i++ {
+			d, err := idep.NewVaultTokenQuery("token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			vw := newView(&newViewInput{
+				Dependency: d,
+				Clients:    clients,
+				Limiter:    l,
+			})
+			go vw.poll(make(chan *view), make(chan error))
+			defer vw.stop()
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mux.Lock()
+			n := renewals
+			mux.Unlock()
+			if n == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected 2 renewals, got %d: %#v", n, l.stats())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if stats := l.stats(); stats.Waiting != 0 {
+			t.Fatalf("bad stats: %#v", stats)
+		}
+	})
+}
+
+// fakeBlockingConsulKV serves KV gets from the map as blocking queries,
+// returning once the index is past the wait index. update sets a key and
+// increments the index.
+func fakeBlockingConsulKV(kv map[string]string) (*httptest.Server, func(k, v string)) {
+	var mux sync.Mutex
+	index := uint64(1)
+	changed := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/status/leader" {
+				fmt.Fprint(w, `"127.0.0.1:8300"`)
+				return
+			}
+			wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+			mux.Lock()
+			for wait >= index {
+				ch := changed
+				mux.Unlock()
+				select {
+				case <-ch:
+				case <-r.Context().Done():
+					return
+				}
+				mux.Lock()
+			}
+			defer mux.Unlock()
+			key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+			w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+			json.NewEncoder(w).Encode(consulapi.KVPairs{{
+				Key: key, Value: []byte(kv[key]), ModifyIndex: index,
+			}})
+		}))
+	return ts, func(k, v string) {
+		mux.Lock()
+		defer mux.Unlock()
+		kv[k] = v
+		index++
+		close(changed)
+		changed = make(chan struct{})
+	}
+}
@@ -0,0 +1,62 @@
+package hcat
+
+import (
+	"context"
+	"sync"
+)
+
+// ReauthFunc re-authenticates the clients after a fetch failed with an auth
+// error (see dep.ClassAuth), eg. by logging in to Vault again and setting the
+// client's new token. The fetch is retried once it returns.
+type ReauthFunc func(ctx context.Context, clients Looker, err error) error
+
+// reauther runs the ReauthFunc of an upstream. Views failing together share
+// a single call, so the clients re-authenticate once.
+type reauther struct {
+	fn   ReauthFunc
+	mux  sync.Mutex
+	call *reauthCall
+}
+
+// reauthCall is an in-flight call of the ReauthFunc.
+type reauthCall struct {
+	doneCh chan struct{}
+	err    error
+}
+
+func newReauther(fn ReauthFunc) *reauther {
+	if fn == nil {
+		return nil
+	}
+	return &reauther{fn: fn}
+}
+
+// reauth calls the ReauthFunc, or waits for the call in-flight to return.
+// It is a no-op on a nil reauther.
+func (r *reauther) reauth(ctx context.Context, clients Looker, err error) error {
+	if r == nil {
+		return nil
+	}
+	r.mux.Lock()
+	c := r.call
+	if c == nil {
+		c = &reauthCall{doneCh: make(chan struct{})}
+		r.call = c
+		r.mux.Unlock()
+
+		c.err = r.fn(ctx, clients, err)
+		r.mux.Lock()
+		r.call = nil
+		r.mux.Unlock()
+		close(c.doneCh)
+		return c.err
+	}
+	r.mux.Unlock()
+
+	select {
+	case <-c.doneCh:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,186 @@
+package hcat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestReauther(t *testing.T) {
+	t.Run("shared", func(t *testing.T) {
+		var calls int32
+		releaseCh := make(chan struct{})
+		r := newReauther(func(context.Context, Looker, error) error {
+			atomic.AddInt32(&calls, 1)
+			<-releaseCh
+			return errors.New("denied")
+		})
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = r.reauth(context.Background(), nil, nil)
+			}(i)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(releaseCh)
+		wg.Wait()
+		if calls != 1 {
+			t.Fatal("expected a single call, got:", calls)
+		}
+		for _, err := range errs {
+			if err == nil || err.Error() != "denied" {
+				t.Fatal("expected the call's error, got:", err)
+			}
+		}
+		// the next failure calls it again
+		r.reauth(context.Background(), nil, nil)
+		if calls != 2 {
+			t.Fatal("expected a second call, got:", calls)
+		}
+	})
+	t.Run("nil", func(t *testing.T) {
+		if err := newReauther(nil).reauth(context.Background(), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestWatcherErrorClasses(t *testing.T) {
+	// fakeConsul fails KV requests with the status code, if any
+	fakeConsul := func(status *int32, requests *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(
+			func(rw http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/v1/status/leader" {
+					rw.Write([]byte(`"127.0.0.1:8300"`))
+					return
+				}
+				atomic.AddInt32(requests, 1)
+				if code := atomic.LoadInt32(status); code != 0 {
+					rw.WriteHeader(int(code))
+					rw.Write([]byte("Permission denied"))
+					return
+				}
+				rw.Header().Set("X-Consul-Index", "1")
+				rw.Write([]byte(`[{"Key":"foo","Value":"YmFy","ModifyIndex":1}]`))
+			}))
+	}
+	fooDep := func() *idep.KVGetQuery {
+		d, err := idep.NewKVGetQuery("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	fooID := fooDep().String()
+	newWatcher := func(url string, i WatcherInput) *Watcher {
+		clients := NewClientSet()
+		if err := clients.AddConsul(ConsulInput{Address: url}); err != nil {
+			t.Fatal(err)
+		}
+		i.Clients = clients
+		w := NewWatcher(i)
+		d := fooDep()
+		w.Register("tmpl", d)
+		w.Add(d)
+		return w
+	}
+	alwaysRetry := func(int) (bool, time.Duration) {
+		return true, time.Millisecond
+	}
+
+	t.Run("auth", func(t *testing.T) {
+		var status, requests, reauths int32 = 403, 0, 0
+		srv := fakeConsul(&status, &requests)
+		defer srv.Close()
+		w := newWatcher(srv.URL, WatcherInput{
+			ConsulErrorRetryFunc: NoRetry,
+			ConsulReauthFunc: func(context.Context, Looker, error) error {
+				atomic.AddInt32(&reauths, 1)
+				atomic.StoreInt32(&status, 0)
+				return nil
+			},
+			AuthErrorRetryFunc: RetryMaxAttempts(1, RetryConstant(time.Millisecond)),
+		})
+		defer w.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := w.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := w.Recall(fooID); !ok || v != "bar" {
+			t.Fatal("expected data after re-authenticating, got:", v)
+		}
+		if reauths != 1 {
+			t.Fatal("expected 1 re-authentication, got:", reauths)
+		}
+	})
+	t.Run("permanent", func(t *testing.T) {
+		var status, requests int32 = 400, 0
+		srv := fakeConsul(&status, &requests)
+		defer srv.Close()
+		w := newWatcher(srv.URL, WatcherInput{ConsulRetryFunc: alwaysRetry})
+		defer w.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := w.Wait(ctx); err == nil {
+			t.Fatal("expected the permanent error")
+		}
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Fatal("expected no retries, got requests:", n)
+		}
+	})
+	t.Run("permanent-retry", func(t *testing.T) {
+		var status, requests int32 = 400, 0
+		srv := fakeConsul(&status, &requests)
+		defer srv.Close()
+		w := newWatcher(srv.URL, WatcherInput{
+			ConsulRetryFunc:         alwaysRetry,
+			PermanentErrorRetryFunc: RetryMaxAttempts(2, RetryConstant(time.Millisecond)),
+		})
+		defer w.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := w.Wait(ctx); err == nil {
+			t.Fatal("expected the permanent error")
+		}
+		if n := atomic.LoadInt32(&requests); n != 3 {
+			t.Fatal("expected 2 retries, got requests:", n)
+		}
+	})
+	t.Run("transient", func(t *testing.T) {
+		var status, requests int32 = 500, 0
+		srv := fakeConsul(&status, &requests)
+		defer srv.Close()
+		w := newWatcher(srv.URL, WatcherInput{
+			ConsulRetryFunc: func(retry int) (bool, time.Duration) {
+				if retry == 1 {
+					atomic.StoreInt32(&status, 0)
+				}
+				return true, time.Millisecond
+			},
+		})
+		defer w.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := w.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := w.Recall(fooID); !ok {
+			t.Fatal("expected data after retrying")
+		}
+	})
+}
@@ -1,10 +1,76 @@
 package hcat
 
-import "github.com/hashicorp/hcat/dep"
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+)
 
 // Resolver is responsible rendering Templates and invoking Commands.
-// Empty but reserving the space for future use.
-type Resolver struct{}
+// It tracks the templates' missing dependencies between runs to report on
+// how long they have been outstanding.
+type Resolver struct {
+	mux sync.Mutex
+
+	// deadlines are the per-template initial render deadlines.
+	deadlines map[string]time.Duration
+	// started is when each template was first run, it is removed once the
+	// template has completed its initial render.
+	started map[string]time.Time
+	// rendered is the set of templates that have completed a render.
+	rendered map[string]struct{}
+	// missing is per template the dependencies that were missing on the last
+	// run along with when they were first found to be missing.
+	missing map[string]map[string]missingDep
+	// results are the results of the last run that executed each template.
+	results map[string]runResult
+}
+
+// runResult records the result of a template run for introspection.
+type runResult struct {
+	event ResolveEvent
+	err   error
+	at    time.Time
+}
+
+type missingDep struct {
+	dep   dep.Dependency
+	since time.Time
+}
+
+// ResolveReason is the reason a template was, or was not, rendered by a
+// Resolver run.
+type ResolveReason int
+
+const (
+	// ReasonUnchanged means none of the template's dependencies have changed
+	// since the last run so it was not rendered.
+	ReasonUnchanged ResolveReason = iota
+	// ReasonBuffering means the template is in an active buffer period.
+	ReasonBuffering
+	// ReasonMissing means the template is waiting on data for some of its
+	// dependencies.
+	ReasonMissing
+	// ReasonComplete means the template was fully rendered.
+	ReasonComplete
+)
+
+func (r ResolveReason) String() string {
+	switch r {
+	case ReasonUnchanged:
+		return "unchanged"
+	case ReasonBuffering:
+		return "buffering"
+	case ReasonMissing:
+		return "missing"
+	case ReasonComplete:
+		return "complete"
+	}
+	return fmt.Sprintf("ResolveReason(%d)", int(r))
+}
 
 // ResolveEvent captures the whether the template dependencies have all been
 // resolved and rendered in memory.
@@ -17,8 +83,42 @@ type ResolveEvent struct {
 	// Only returned when Complete is true.
 	Contents []byte
 
-	// for testing, need way to test for missing dependencies case
-	missing bool
+	// Reason explains the state of the template after the run.
+	Reason ResolveReason
+
+	// Missing are the dependencies the template is waiting on, sorted by ID.
+	// It is kept between runs, so a template that is unchanged or buffering
+	// will still report what it is waiting on.
+	Missing []MissingDependency
+
+	// Version is the version of the data the template was run against by
+	// RunBatch, zero for Run or if the watcher's cache doesn't support
+	// snapshots (see Store).
+	Version uint64
+}
+
+// MissingDependency is a dependency that a template is waiting on for data.
+type MissingDependency struct {
+	Dependency dep.Dependency
+	// Outstanding is how long the dependency has been missing.
+	Outstanding time.Duration
+}
+
+// RenderDeadlineError is returned by Run when a template has not completed
+// its initial render within the deadline set by SetInitialRenderDeadline.
+type RenderDeadlineError struct {
+	TemplateID string
+	Deadline   time.Duration
+	Missing    []MissingDependency
+}
+
+func (e *RenderDeadlineError) Error() string {
+	ids := make([]string, len(e.Missing))
+	for i, m := range e.Missing {
+		ids[i] = m.Dependency.String()
+	}
+	return fmt.Sprintf("template %s not rendered within %s, missing: %v",
+		e.TemplateID, e.Deadline, ids)
 }
 
 // Basic constructor, here for consistency and future flexibility.
@@ -26,6 +126,31 @@ func NewResolver() *Resolver {
 	return &Resolver{}
 }
 
+// lock locks the Resolver, initializing its maps on first use so the zero
+// value is ready to use.
+func (r *Resolver) lock() {
+	r.mux.Lock()
+	if r.results == nil {
+		r.deadlines = make(map[string]time.Duration)
+		r.started = make(map[string]time.Time)
+		r.rendered = make(map[string]struct{})
+		r.missing = make(map[string]map[string]missingDep)
+		r.results = make(map[string]runResult)
+	}
+}
+
+// SetInitialRenderDeadline sets the maximum time the templates have to
+// complete their first render, measured from their first Run. Once it passes
+// Run returns a *RenderDeadlineError for the template. A zero deadline
+// disables the check.
+func (r *Resolver) SetInitialRenderDeadline(deadline time.Duration, tmplIDs ...string) {
+	r.lock()
+	defer r.mux.Unlock()
+	for _, id := range tmplIDs {
+		r.deadlines[id] = deadline
+	}
+}
+
 // Watcherer is the subset of the Watcher's API that the resolver needs.
 // The interface is used to make the used/required API explicit.
 type Watcherer interface {
@@ -36,6 +161,37 @@ type Watcherer interface {
 	Register(tmplID string, deps ...dep.Dependency)
 }
 
+// snapshotWatcher is a Watcherer recalling data from a snapshot.
+type snapshotWatcher struct {
+	Watcherer
+	snap *Snapshot
+}
+
+func (w snapshotWatcher) Recall(id string) (interface{}, bool) {
+	return w.snap.Recall(id)
+}
+
+// DataAge forwards to the watcher, as the data's age isn't in the snapshot.
+func (w snapshotWatcher) DataAge(id string) time.Duration {
+	if a, ok := w.Watcherer.(dataAger); ok {
+		return a.DataAge(id)
+	}
+	return 0
+}
+
+// snapshotOf returns the Watcherer reading from a snapshot of its data, if
+// it supports them.
+func snapshotOf(w Watcherer) Watcherer {
+	s, ok := w.(snapshotter)
+	if !ok {
+		return w
+	}
+	if snap := s.Snapshot(); snap != nil {
+		return snapshotWatcher{Watcherer: w, snap: snap}
+	}
+	return w
+}
+
 // Templater the interface the Template provides.
 // The interface is used to make the used/required API explicit.
 type Templater interface {
@@ -46,15 +202,61 @@ type Templater interface {
 // Run the template Execute once. You should repeat calling this until
 // output returns Complete as true. It uses the watcher for dependency
 // lookup state. The content will be updated each pass until complete.
+//
+// The template reads the watcher's current data. Use RunBatch to run
+// templates against a snapshot, consistent with each other.
 func (r *Resolver) Run(tmpl Templater, w Watcherer) (ResolveEvent, error) {
+	return r.runSnapshot(tmpl, w)
+}
+
+// RunBatch runs each template once, as Run, all against the same snapshot of
+// the watcher's data. Templates rendered together, eg. a list of upstreams
+// and a matching ACL file, are so always consistent with each other even as
+// new data arrives. If the watcher's cache doesn't support snapshots they
+// read the current data, as with Run. Taking a snapshot makes the next change
+// to the Store copy its data, so prefer Run for templates rendered alone.
+//
+// The events are returned in the order of the templates. On error the
+// events of the templates already run are returned along with it.
+func (r *Resolver) RunBatch(tmpls []Templater, w Watcherer) ([]ResolveEvent, error) {
+	sw := snapshotOf(w)
+	events := make([]ResolveEvent, 0, len(tmpls))
+	for _, tmpl := range tmpls {
+		event, err := r.runSnapshot(tmpl, sw)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (r *Resolver) runSnapshot(tmpl Templater, w Watcherer) (ResolveEvent, error) {
+	event, err := r.run(tmpl, w)
+	if sw, ok := w.(snapshotWatcher); ok {
+		event.Version = sw.snap.Version()
+	}
+	// record the results of actual template executions (and errors)
+	if err != nil || event.Reason == ReasonMissing ||
+		event.Reason == ReasonComplete {
+		r.lock()
+		r.results[tmpl.ID()] = runResult{event: event, err: err, at: time.Now()}
+		r.mux.Unlock()
+	}
+	return event, err
+}
+
+func (r *Resolver) run(tmpl Templater, w Watcherer) (ResolveEvent, error) {
+	r.start(tmpl.ID())
+
 	// Check if this dependency has any dependencies that have been change and
 	// if not, don't waste time re-rendering it.
 	if !w.Changed(tmpl.ID()) {
-		return ResolveEvent{}, nil
+		return r.incomplete(tmpl.ID(), ReasonUnchanged)
 	}
 
 	if w.Buffer(tmpl.ID()) {
-		return ResolveEvent{Complete: false}, nil
+		return r.incomplete(tmpl.ID(), ReasonBuffering)
 	}
 
 	// Attempt to render the template, returning any missing dependencies and
@@ -75,10 +277,86 @@ func (r *Resolver) Run(tmpl Templater, w Watcherer) (ResolveEvent, error) {
 		for _, d := range result.Missing.List() {
 			w.Add(d)
 		}
+		r.setMissing(tmpl.ID(), result.Missing.List())
 		// If the template is missing data for some dependencies then we are
 		// not ready to render and need to move on to the next one.
-		return ResolveEvent{missing: true}, nil
+		return r.incomplete(tmpl.ID(), ReasonMissing)
 	}
 
-	return ResolveEvent{Complete: true, Contents: result.Output}, nil
+	r.complete(tmpl.ID())
+	return ResolveEvent{
+		Complete: true,
+		Contents: result.Output,
+		Reason:   ReasonComplete,
+	}, nil
+}
+
+// start records the time of the template's first run.
+func (r *Resolver) start(tmplID string) {
+	r.lock()
+	defer r.mux.Unlock()
+	if _, ok := r.rendered[tmplID]; ok {
+		return
+	}
+	if _, ok := r.started[tmplID]; !ok {
+		r.started[tmplID] = time.Now()
+	}
+}
+
+// setMissing replaces the template's missing dependencies, keeping the time
+// they were first missing for those that still are.
+func (r *Resolver) setMissing(tmplID string, deps []dep.Dependency) {
+	r.lock()
+	defer r.mux.Unlock()
+	now := time.Now()
+	prev := r.missing[tmplID]
+	missing := make(map[string]missingDep, len(deps))
+	for _, d := range deps {
+		if m, ok := prev[d.String()]; ok {
+			missing[d.String()] = m
+			continue
+		}
+		missing[d.String()] = missingDep{dep: d, since: now}
+	}
+	r.missing[tmplID] = missing
+}
+
+// complete clears the template's missing state after it was rendered.
+func (r *Resolver) complete(tmplID string) {
+	r.lock()
+	defer r.mux.Unlock()
+	delete(r.missing, tmplID)
+	delete(r.started, tmplID)
+	r.rendered[tmplID] = struct{}{}
+}
+
+// incomplete returns the event for a template that was not rendered, along
+// with an error if the template has exceeded its initial render deadline.
+func (r *Resolver) incomplete(tmplID string, reason ResolveReason) (ResolveEvent, error) {
+	r.lock()
+	defer r.mux.Unlock()
+
+	now := time.Now()
+	var missing []MissingDependency
+	for _, m := range r.missing[tmplID] {
+		missing = append(missing, MissingDependency{
+			Dependency:  m.dep,
+			Outstanding: now.Sub(m.since),
+		})
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Dependency.String() < missing[j].Dependency.String()
+	})
+	event := ResolveEvent{Reason: reason, Missing: missing}
+
+	deadline := r.deadlines[tmplID]
+	started, pending := r.started[tmplID]
+	if deadline > 0 && pending && now.Sub(started) > deadline {
+		return event, &RenderDeadlineError{
+			TemplateID: tmplID,
+			Deadline:   deadline,
+			Missing:    missing,
+		}
+	}
+	return event, nil
 }
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	dep "github.com/hashicorp/hcat/internal/dependency"
 )
@@ -15,13 +16,28 @@ func TestResolverRun(t *testing.T) {
 		rv := NewResolver()
 		tt := fooTemplate(t)
 		w := blindWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		r, err := rv.Run(tt, w)
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == false {
+		if r.Reason != ReasonMissing {
+			t.Fatal("missing should be true")
+		}
+	})
+
+	t.Run("zero-value", func(t *testing.T) {
+		var rv Resolver
+		tt := fooTemplate(t)
+		w := blindWatcher(t)
+		defer w.Close()
+
+		r, err := rv.Run(tt, w)
+		if err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		if r.Reason != ReasonMissing {
 			t.Fatal("missing should be true")
 		}
 	})
@@ -30,7 +46,7 @@ func TestResolverRun(t *testing.T) {
 		rv := NewResolver()
 		tt := fooTemplate(t)
 		w := blindWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		// seed the dependency tracking
 		// otherwise it will trigger first run
@@ -47,7 +63,7 @@ func TestResolverRun(t *testing.T) {
 		if string(r.Contents) != "" {
 			t.Fatal("bad contents")
 		}
-		if r.missing == true {
+		if r.Reason == ReasonMissing {
 			t.Fatal("missing should be false")
 		}
 	})
@@ -56,7 +72,7 @@ func TestResolverRun(t *testing.T) {
 		rv := NewResolver()
 		tt := fooTemplate(t)
 		w := blindWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		d, _ := dep.NewKVGetQuery("foo")
 		// seed the cache and the dependency tracking
@@ -72,7 +88,7 @@ func TestResolverRun(t *testing.T) {
 		if string(r.Contents) != "bar" {
 			t.Fatal("bad contents")
 		}
-		if r.missing == true {
+		if r.Reason == ReasonMissing {
 			t.Fatal("missing should be false")
 		}
 	})
@@ -83,13 +99,13 @@ func TestResolverRun(t *testing.T) {
 		rv := NewResolver()
 		tt := echoTemplate(t, "foo")
 		w := blindWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		r, err := rv.Run(tt, w)
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == false {
+		if r.Reason != ReasonMissing {
 			t.Fatal("missing should be true")
 		}
 		ctx := context.Background()
@@ -99,7 +115,7 @@ func TestResolverRun(t *testing.T) {
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == true {
+		if r.Reason == ReasonMissing {
 			t.Fatal("missing should be false")
 		}
 		if r.Complete == false {
@@ -116,14 +132,14 @@ func TestResolverRun(t *testing.T) {
 		rv := NewResolver()
 		tt := echoListTemplate(t, "foo", "bar")
 		w := blindWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		// Run 1, 'words' is missing
 		r, err := rv.Run(tt, w)
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == false {
+		if r.Reason != ReasonMissing {
 			t.Fatal("missing should be true")
 		}
 		ctx := context.Background()
@@ -134,7 +150,7 @@ func TestResolverRun(t *testing.T) {
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == false {
+		if r.Reason != ReasonMissing {
 			t.Fatal("missing should be true")
 		}
 		w.Wait(ctx)
@@ -144,7 +160,7 @@ func TestResolverRun(t *testing.T) {
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == false {
+		if r.Reason != ReasonMissing {
 			t.Fatal("missing should be true")
 		}
 		w.Wait(ctx)
@@ -154,7 +170,7 @@ func TestResolverRun(t *testing.T) {
 		if err != nil {
 			t.Fatal("Run() error:", err)
 		}
-		if r.missing == true {
+		if r.Reason == ReasonMissing {
 			t.Fatal("missing should be false")
 		}
 		if r.Complete == false {
@@ -164,11 +180,206 @@ func TestResolverRun(t *testing.T) {
 			t.Fatal("Wrong contents:", string(r.Contents))
 		}
 	})
+
+	t.Run("missing-reported", func(t *testing.T) {
+		rv := NewResolver()
+		tt := echoTemplate(t, "foo")
+		w := blindWatcher(t)
+		defer w.Close()
+
+		r, err := rv.Run(tt, w)
+		if err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		if len(r.Missing) != 1 {
+			t.Fatal("expected 1 missing dependency, got:", len(r.Missing))
+		}
+		d := &dep.FakeDep{Name: "foo"}
+		if r.Missing[0].Dependency.String() != d.String() {
+			t.Fatal("wrong missing dependency:", r.Missing[0].Dependency)
+		}
+		time.Sleep(time.Millisecond)
+
+		// unchanged, but still waiting on the same dependency
+		r, err = rv.Run(tt, w)
+		if err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		if r.Reason != ReasonUnchanged {
+			t.Fatal("bad reason:", r.Reason)
+		}
+		if len(r.Missing) != 1 || r.Missing[0].Outstanding < time.Millisecond {
+			t.Fatalf("bad missing: %#v", r.Missing)
+		}
+
+		w.Wait(context.Background())
+		r, err = rv.Run(tt, w)
+		if err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		if r.Reason != ReasonComplete || len(r.Missing) != 0 {
+			t.Fatalf("bad event: %#v", r)
+		}
+	})
+
+	t.Run("buffering", func(t *testing.T) {
+		rv := NewResolver()
+		tt := echoTemplate(t, "foo")
+		w := blindWatcher(t)
+		defer w.Close()
+		w.SetBufferPeriod(time.Minute, time.Minute, tt.ID())
+
+		rv.Run(tt, w)
+		w.Wait(context.Background())
+		// first render skips buffering
+		if r, _ := rv.Run(tt, w); r.Reason != ReasonComplete {
+			t.Fatal("bad reason:", r.Reason)
+		}
+		w.changed.Add((&dep.FakeDep{Name: "foo"}).String())
+		r, err := rv.Run(tt, w)
+		if err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		if r.Reason != ReasonBuffering {
+			t.Fatal("bad reason:", r.Reason)
+		}
+	})
+
+	t.Run("initial-render-deadline", func(t *testing.T) {
+		rv := NewResolver()
+		tt := echoTemplate(t, "foo")
+		w := blindWatcher(t)
+		defer w.Close()
+		rv.SetInitialRenderDeadline(time.Millisecond, tt.ID())
+
+		if _, err := rv.Run(tt, w); err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+		r, err := rv.Run(tt, w)
+		derr, ok := err.(*RenderDeadlineError)
+		if !ok {
+			t.Fatal("expected a deadline error, got:", err)
+		}
+		if derr.TemplateID != tt.ID() || len(derr.Missing) != 1 {
+			t.Fatalf("bad error: %#v", derr)
+		}
+		if r.Reason != ReasonUnchanged || len(r.Missing) != 1 {
+			t.Fatalf("bad event: %#v", r)
+		}
+	})
+
+	t.Run("initial-render-deadline-met", func(t *testing.T) {
+		rv := NewResolver()
+		tt := echoTemplate(t, "foo")
+		w := blindWatcher(t)
+		defer w.Close()
+		rv.SetInitialRenderDeadline(time.Millisecond, tt.ID())
+
+		rv.Run(tt, w)
+		w.Wait(context.Background())
+		if r, err := rv.Run(tt, w); err != nil || !r.Complete {
+			t.Fatal("expected completed render:", r, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+		if _, err := rv.Run(tt, w); err != nil {
+			t.Fatal("deadline should not apply after render:", err)
+		}
+	})
 }
 
 //////////////////////////
 // Helpers
 
+func TestResolverRunBatch(t *testing.T) {
+	t.Parallel()
+	t.Run("consistent", func(t *testing.T) {
+		rv := NewResolver()
+		w := blindWatcher(t)
+		defer w.Close()
+		id := (&dep.FakeDep{Name: "foo"}).String()
+		w.cache.Save(id, "v1")
+
+		// new data saved while the batch is running isn't seen by it
+		first := &savingTemplate{Templater: echoTemplate(t, "foo"),
+			save: func() { w.cache.Save(id, "v2") }}
+		second := NewTemplate(TemplateInput{
+			Contents:     `acl {{echo "foo"}}`,
+			FuncMapMerge: template.FuncMap{"echo": echoFunc},
+		})
+		events, err := rv.RunBatch([]Templater{first, second}, w)
+		if err != nil {
+			t.Fatal("RunBatch() error:", err)
+		}
+		if len(events) != 2 {
+			t.Fatal("expected 2 events, got:", len(events))
+		}
+		if string(events[0].Contents) != "v1" ||
+			string(events[1].Contents) != "acl v1" {
+			t.Fatalf("inconsistent contents: %q, %q", events[0].Contents,
+				events[1].Contents)
+		}
+		if events[0].Version == 0 || events[0].Version != events[1].Version {
+			t.Fatalf("bad versions: %d, %d", events[0].Version,
+				events[1].Version)
+		}
+
+		// the next batch sees it
+		w.changed.Add(id)
+		next, err := rv.RunBatch([]Templater{second}, w)
+		if err != nil {
+			t.Fatal("RunBatch() error:", err)
+		}
+		if e := next[0]; string(e.Contents) != "acl v2" ||
+			e.Version <= events[1].Version {
+			t.Fatalf("bad event: %#v", e)
+		}
+	})
+	t.Run("run-no-snapshot", func(t *testing.T) {
+		rv := NewResolver()
+		w := blindWatcher(t)
+		defer w.Close()
+		w.cache.Save((&dep.FakeDep{Name: "foo"}).String(), "foo")
+
+		e, err := rv.Run(echoTemplate(t, "foo"), w)
+		if err != nil {
+			t.Fatal("Run() error:", err)
+		}
+		if !e.Complete || e.Version != 0 {
+			t.Fatalf("bad event: %#v", e)
+		}
+		// Run reads the live data, the Store's maps aren't shared
+		if w.cache.(*Store).shared {
+			t.Fatal("Run should not take a snapshot")
+		}
+	})
+	t.Run("no-snapshots", func(t *testing.T) {
+		rv := NewResolver()
+		w := NewWatcher(WatcherInput{Cache: NewBoundedStore(BoundedStoreInput{})})
+		defer w.Close()
+		w.cache.Save((&dep.FakeDep{Name: "foo"}).String(), "foo")
+
+		events, err := rv.RunBatch([]Templater{echoTemplate(t, "foo")}, w)
+		if err != nil {
+			t.Fatal("RunBatch() error:", err)
+		}
+		if !events[0].Complete || events[0].Version != 0 {
+			t.Fatalf("bad event: %#v", events[0])
+		}
+	})
+}
+
+// savingTemplate calls save after executing the template.
+type savingTemplate struct {
+	Templater
+	save func()
+}
+
+func (t *savingTemplate) Execute(r Recaller) (*ExecuteResult, error) {
+	defer t.save()
+	return t.Templater.Execute(r)
+}
+
 func fooTemplate(t *testing.T) *Template {
 	return NewTemplate(
 		TemplateInput{
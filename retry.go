@@ -0,0 +1,160 @@
+package hcat
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Retry describes the retry of a failed fetch for an ErrorRetryFunc.
+type Retry struct {
+	// Attempt is the number of retries so far, zero on the first failure.
+	Attempt int
+	// Err is the error of the failed fetch.
+	Err error
+	// Elapsed is the time since the first failure.
+	Elapsed time.Duration
+	// Previous is the previous sleep, zero on the first failure.
+	Previous time.Duration
+}
+
+// ErrorRetryFunc is a RetryFunc that is also given the error and the time
+// spent retrying. It returns whether to retry and how long to sleep first.
+//
+// ErrorRetryFuncs must be safe for concurrent use, as they are shared by the
+// views of an upstream. The constructors below, prefixed with Retry, build
+// stateless ones that can be composed, eg.
+//
+//	RetryMaxElapsed(5*time.Minute, RetryExponential(time.Second, time.Minute))
+type ErrorRetryFunc func(Retry) (bool, time.Duration)
+
+// ErrorRetryFunc returns the RetryFunc as an ErrorRetryFunc. A nil RetryFunc
+// returns nil.
+func (f RetryFunc) ErrorRetryFunc() ErrorRetryFunc {
+	if f == nil {
+		return nil
+	}
+	return func(r Retry) (bool, time.Duration) {
+		return f(r.Attempt)
+	}
+}
+
+// Default retry parameters, see DefaultRetryFunc.
+const (
+	DefaultRetryAttempts = 12
+	DefaultRetryBase     = 250 * time.Millisecond
+	DefaultRetryMax      = time.Minute
+)
+
+// DefaultRetryFunc returns the ErrorRetryFunc used for upstreams configured
+// without one: exponential backoff with full jitter from DefaultRetryBase up
+// to DefaultRetryMax, for at most DefaultRetryAttempts retries.
+func DefaultRetryFunc() ErrorRetryFunc {
+	return RetryMaxAttempts(DefaultRetryAttempts,
+		RetryExponential(DefaultRetryBase, DefaultRetryMax))
+}
+
+// NoRetry never retries. Use it to disable the default retries.
+func NoRetry(Retry) (bool, time.Duration) {
+	return false, 0
+}
+
+// RetryConstant always retries after the same sleep.
+func RetryConstant(sleep time.Duration) ErrorRetryFunc {
+	return func(Retry) (bool, time.Duration) {
+		return true, sleep
+	}
+}
+
+// RetryExponential always retries, with exponential backoff and full jitter:
+// the sleep is random, up to base doubled on each attempt and capped at max.
+func RetryExponential(base, max time.Duration) ErrorRetryFunc {
+	return func(r Retry) (bool, time.Duration) {
+		return true, jitter(backoff(base, max, r.Attempt))
+	}
+}
+
+// RetryDecorrelated always retries, with decorrelated jitter: the sleep is
+// random, between base and three times the previous sleep, capped at max.
+func RetryDecorrelated(base, max time.Duration) ErrorRetryFunc {
+	return func(r Retry) (bool, time.Duration) {
+		upper := r.Previous * 3
+		if upper < base {
+			upper = base
+		}
+		sleep := base + jitter(upper-base)
+		if sleep > max {
+			sleep = max
+		}
+		return true, sleep
+	}
+}
+
+// RetryMaxAttempts retries as f does, for at most the number of attempts.
+func RetryMaxAttempts(attempts int, f ErrorRetryFunc) ErrorRetryFunc {
+	return func(r Retry) (bool, time.Duration) {
+		if r.Attempt >= attempts {
+			return false, 0
+		}
+		return f(r)
+	}
+}
+
+// RetryMaxElapsed retries as f does, as long as the time since the first
+// failure, including the next sleep, is under max. The last sleep is
+// shortened to fit.
+func RetryMaxElapsed(max time.Duration, f ErrorRetryFunc) ErrorRetryFunc {
+	return func(r Retry) (bool, time.Duration) {
+		remaining := max - r.Elapsed
+		if remaining <= 0 {
+			return false, 0
+		}
+		retry, sleep := f(r)
+		if sleep > remaining {
+			sleep = remaining
+		}
+		return retry, sleep
+	}
+}
+
+// RetryIf retries as f does, only for the errors matching the condition,
+// eg. using dep.ClassOf.
+func RetryIf(cond func(error) bool, f ErrorRetryFunc) ErrorRetryFunc {
+	return func(r Retry) (bool, time.Duration) {
+		if !cond(r.Err) {
+			return false, 0
+		}
+		return f(r)
+	}
+}
+
+// backoff returns base doubled for each attempt, capped at max.
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max || d <= 0 { // d <= 0 on overflow
+		return max
+	}
+	return d
+}
+
+// jitter returns a random duration in [0, d).
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// retryFuncOf returns the ErrorRetryFunc to use for an upstream: ef if set,
+// else f, else the default.
+func retryFuncOf(ef ErrorRetryFunc, f RetryFunc) ErrorRetryFunc {
+	switch {
+	case ef != nil:
+		return ef
+	case f != nil:
+		return f.ErrorRetryFunc()
+	}
+	return DefaultRetryFunc()
+}
@@ -0,0 +1,101 @@
+package hcat
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+func TestRetryFuncs(t *testing.T) {
+	t.Parallel()
+	errPerm := dep.Permanent(errors.New("permanent"))
+	legacy := RetryFunc(func(retry int) (bool, time.Duration) {
+		return retry < 2, time.Duration(retry) * time.Second
+	})
+
+	cases := []struct {
+		name  string
+		f     ErrorRetryFunc
+		r     Retry
+		retry bool
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"no-retry", NoRetry, Retry{}, false, 0, 0},
+		{"constant", RetryConstant(time.Second), Retry{Attempt: 5},
+			true, time.Second, time.Second},
+		{"exponential-first", RetryExponential(time.Second, time.Minute),
+			Retry{}, true, 0, time.Second},
+		{"exponential-grows", RetryExponential(time.Second, time.Minute),
+			Retry{Attempt: 3}, true, 0, 8 * time.Second},
+		{"exponential-capped", RetryExponential(time.Second, time.Minute),
+			Retry{Attempt: math.MaxInt32}, true, 0, time.Minute},
+		{"decorrelated-first", RetryDecorrelated(time.Second, time.Minute),
+			Retry{}, true, time.Second, time.Second},
+		{"decorrelated-grows", RetryDecorrelated(time.Second, time.Minute),
+			Retry{Previous: 2 * time.Second}, true, time.Second, 6 * time.Second},
+		{"decorrelated-capped", RetryDecorrelated(time.Second, time.Minute),
+			Retry{Previous: time.Hour}, true, time.Second, time.Minute},
+		{"max-attempts-under", RetryMaxAttempts(2, RetryConstant(time.Second)),
+			Retry{Attempt: 1}, true, time.Second, time.Second},
+		{"max-attempts-reached", RetryMaxAttempts(2, RetryConstant(time.Second)),
+			Retry{Attempt: 2}, false, 0, 0},
+		{"max-elapsed-under", RetryMaxElapsed(time.Minute, RetryConstant(time.Second)),
+			Retry{Elapsed: 30 * time.Second}, true, time.Second, time.Second},
+		{"max-elapsed-shortened", RetryMaxElapsed(time.Minute, RetryConstant(time.Second)),
+			Retry{Elapsed: 59900 * time.Millisecond}, true,
+			100 * time.Millisecond, 100 * time.Millisecond},
+		{"max-elapsed-reached", RetryMaxElapsed(time.Minute, RetryConstant(time.Second)),
+			Retry{Elapsed: time.Minute}, false, 0, 0},
+		{"if-match", RetryIf(isTransient, RetryConstant(time.Second)),
+			Retry{Err: errors.New("transient")}, true, time.Second, time.Second},
+		{"if-no-match", RetryIf(isTransient, RetryConstant(time.Second)),
+			Retry{Err: errPerm}, false, 0, 0},
+		{"legacy", legacy.ErrorRetryFunc(), Retry{Attempt: 1},
+			true, time.Second, time.Second},
+		{"legacy-done", legacy.ErrorRetryFunc(), Retry{Attempt: 2},
+			false, 2 * time.Second, 2 * time.Second},
+		{"default", DefaultRetryFunc(), Retry{Attempt: DefaultRetryAttempts - 1},
+			true, 0, DefaultRetryMax},
+		{"default-done", DefaultRetryFunc(), Retry{Attempt: DefaultRetryAttempts},
+			false, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ { // for the random ones
+				retry, sleep := tc.f(tc.r)
+				if retry != tc.retry {
+					t.Fatalf("expected retry %v, got %v", tc.retry, retry)
+				}
+				if sleep < tc.min || sleep > tc.max {
+					t.Fatalf("sleep %s not in [%s, %s]", sleep, tc.min, tc.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryFuncOf(t *testing.T) {
+	t.Parallel()
+	legacy := RetryFunc(func(int) (bool, time.Duration) { return true, time.Hour })
+
+	if _, sleep := retryFuncOf(RetryConstant(time.Second), legacy)(Retry{}); sleep != time.Second {
+		t.Fatal("expected the ErrorRetryFunc to take precedence")
+	}
+	if _, sleep := retryFuncOf(nil, legacy)(Retry{}); sleep != time.Hour {
+		t.Fatal("expected the RetryFunc")
+	}
+	if retry, _ := retryFuncOf(nil, nil)(Retry{Attempt: DefaultRetryAttempts}); retry {
+		t.Fatal("expected the default to give up after its attempts")
+	}
+	if retry, _ := retryFuncOf(NoRetry, nil)(Retry{}); retry {
+		t.Fatal("expected NoRetry to disable retries")
+	}
+}
+
+func isTransient(err error) bool {
+	return dep.ClassOf(err) == dep.ClassTransient
+}
@@ -2,6 +2,7 @@ package hcat
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/hashicorp/hcat/dep"
@@ -58,6 +59,16 @@ func (s stringSet) Clear() {
 	s.clear()
 }
 
+// sortedKeys returns the keys of the set-like map in sorted order.
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // DepSet is a set (type) of Dependencies and is used with public template
 // rendering interface. Relative ordering is preserved.
 type DepSet struct {
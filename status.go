@@ -0,0 +1,250 @@
+package hcat
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/pprof"
+	"sort"
+	"time"
+)
+
+// NewStatusHandler returns an http.Handler that serves JSON describing the
+// state of the Watcher and, if not nil, the Resolver. It is meant for
+// debugging and operations and never includes any fetched data.
+//
+// The endpoints are relative to the handler's root, so to serve it under a
+// path strip the path prefix:
+//
+//	mux.Handle("/status/", http.StripPrefix("/status", hcat.NewStatusHandler(w, r)))
+//
+// Endpoints:
+//
+//	/            all of the below JSON documents combined
+//	/views       active views with their last index, contact and retry counts
+//	/buffers     templates with buffer periods and their state
+//	/cache       keys of the data in the cache
+//	/cache/stats statistics of the cache, if it keeps any (see BoundedStore)
+//	/requests    statistics on the requests to Consul and Vault
+//	/templates   the result of the last render of each template
+//	/goroutines  goroutine dump (text) to help find stuck views
+func NewStatusHandler(w *Watcher, r *Resolver) http.Handler {
+	h := &statusHandler{watcher: w, resolver: r}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", h.all)
+	mux.HandleFunc("/views", h.views)
+	mux.HandleFunc("/buffers", h.buffers)
+	mux.HandleFunc("/cache", h.cache)
+	mux.HandleFunc("/cache/stats", h.cacheStats)
+	mux.HandleFunc("/requests", h.requests)
+	mux.HandleFunc("/templates", h.templates)
+	mux.HandleFunc("/goroutines", h.goroutines)
+	return mux
+}
+
+type statusHandler struct {
+	watcher  *Watcher
+	resolver *Resolver
+}
+
+type viewJSON struct {
+	ID          string    `json:"id"`
+	Templates   []string  `json:"templates"`
+	LastIndex   uint64    `json:"last_index"`
+	LastUpdated time.Time `json:"last_updated"`
+	LastContact time.Time `json:"last_contact"`
+	Retries     int       `json:"retries"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type bufferJSON struct {
+	TemplateID string    `json:"template_id"`
+	Active     bool      `json:"active"`
+	Deadline   time.Time `json:"deadline"`
+	Buffered   bool      `json:"buffered"`
+}
+
+type missingJSON struct {
+	ID          string `json:"id"`
+	Outstanding string `json:"outstanding"`
+}
+
+type templateJSON struct {
+	ID       string        `json:"id"`
+	Reason   string        `json:"reason"`
+	Complete bool          `json:"complete"`
+	At       time.Time     `json:"at"`
+	Missing  []missingJSON `json:"missing,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+type requestsJSON struct {
+	Consul RequestStats `json:"consul"`
+	Vault  RequestStats `json:"vault"`
+}
+
+type statusJSON struct {
+	Views      []viewJSON     `json:"views"`
+	Buffers    []bufferJSON   `json:"buffers"`
+	Cache      []string       `json:"cache"`
+	CacheStats *CacheStats    `json:"cache_stats,omitempty"`
+	Requests   requestsJSON   `json:"requests"`
+	Templates  []templateJSON `json:"templates"`
+}
+
+func (h *statusHandler) all(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(rw, req)
+		return
+	}
+	writeJSON(rw, statusJSON{
+		Views:      h.viewList(),
+		Buffers:    h.bufferList(),
+		Cache:      h.cacheList(),
+		CacheStats: h.cacheStatsData(),
+		Requests:   h.requestStats(),
+		Templates:  h.templateList(),
+	})
+}
+
+func (h *statusHandler) views(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, h.viewList())
+}
+
+func (h *statusHandler) buffers(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, h.bufferList())
+}
+
+func (h *statusHandler) cache(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, h.cacheList())
+}
+
+func (h *statusHandler) cacheStats(rw http.ResponseWriter, req *http.Request) {
+	stats := h.cacheStatsData()
+	if stats == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	writeJSON(rw, stats)
+}
+
+func (h *statusHandler) requests(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, h.requestStats())
+}
+
+func (h *statusHandler) templates(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, h.templateList())
+}
+
+func (h *statusHandler) goroutines(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pprof.Lookup("goroutine").WriteTo(rw, 2)
+}
+
+func (h *statusHandler) viewList() []viewJSON {
+	result := []viewJSON{}
+	for _, s := range h.watcher.Dependencies() {
+		if !s.Watching {
+			continue
+		}
+		v := viewJSON{
+			ID:          s.ID,
+			Templates:   s.Templates,
+			LastIndex:   s.LastIndex,
+			LastUpdated: s.LastUpdated,
+			LastContact: s.LastContact,
+			Retries:     s.Retries,
+		}
+		if s.Err != nil {
+			v.Error = s.Err.Error()
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+func (h *statusHandler) bufferList() []bufferJSON {
+	result := []bufferJSON{}
+	for _, s := range h.watcher.bufferTemplates.status() {
+		result = append(result, bufferJSON{
+			TemplateID: s.id,
+			Active:     s.active,
+			Deadline:   s.deadline,
+			Buffered:   s.buffered,
+		})
+	}
+	return result
+}
+
+// keyser is implemented by Cachers that can list their keys, like Store.
+type keyser interface {
+	Keys() []string
+}
+
+func (h *statusHandler) cacheList() []string {
+	if k, ok := h.watcher.cache.(keyser); ok {
+		return k.Keys()
+	}
+	return []string{}
+}
+
+// cacheStatser is implemented by Cachers keeping statistics, like
+// BoundedStore.
+type cacheStatser interface {
+	Stats() CacheStats
+}
+
+func (h *statusHandler) cacheStatsData() *CacheStats {
+	if c, ok := h.watcher.cache.(cacheStatser); ok {
+		stats := c.Stats()
+		return &stats
+	}
+	return nil
+}
+
+func (h *statusHandler) requestStats() requestsJSON {
+	return requestsJSON{
+		Consul: h.watcher.ConsulStats(),
+		Vault:  h.watcher.VaultStats(),
+	}
+}
+
+func (h *statusHandler) templateList() []templateJSON {
+	result := []templateJSON{}
+	if h.resolver == nil {
+		return result
+	}
+
+	h.resolver.mux.Lock()
+	defer h.resolver.mux.Unlock()
+	for id, res := range h.resolver.results {
+		t := templateJSON{
+			ID:       id,
+			Reason:   res.event.Reason.String(),
+			Complete: res.event.Complete,
+			At:       res.at,
+		}
+		for _, m := range res.event.Missing {
+			t.Missing = append(t.Missing, missingJSON{
+				ID:          m.Dependency.String(),
+				Outstanding: m.Outstanding.String(),
+			})
+		}
+		if res.err != nil {
+			t.Error = res.err.Error()
+		}
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,138 @@
+package hcat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestStatusHandler(t *testing.T) {
+	w := newWatcher(t)
+	defer w.Close()
+	r := NewResolver()
+
+	tmpl := echoTemplate(t, "foo")
+	w.SetBufferPeriod(time.Minute, time.Minute, tmpl.ID())
+	if _, err := r.Run(tmpl, w); err != nil {
+		t.Fatal("Run() error:", err)
+	}
+	w.Wait(context.Background())
+
+	h := NewStatusHandler(w, r)
+	get := func(path string, v interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("bad status code for %s: %d", path, rec.Code)
+		}
+		if v != nil {
+			if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+				t.Fatalf("bad json for %s: %v", path, err)
+			}
+		}
+		return rec
+	}
+	fooID := (&idep.FakeDep{Name: "foo"}).String()
+
+	t.Run("views", func(t *testing.T) {
+		var views []viewJSON
+		get("/views", &views)
+		if len(views) != 1 {
+			t.Fatal("expected 1 view, got:", len(views))
+		}
+		v := views[0]
+		if v.ID != fooID || v.LastIndex != 1 || v.LastContact.IsZero() {
+			t.Fatalf("bad view: %#v", v)
+		}
+		if len(v.Templates) != 1 || v.Templates[0] != tmpl.ID() {
+			t.Fatal("bad templates:", v.Templates)
+		}
+	})
+	t.Run("buffers", func(t *testing.T) {
+		var buffers []bufferJSON
+		get("/buffers", &buffers)
+		if len(buffers) != 1 || buffers[0].TemplateID != tmpl.ID() {
+			t.Fatalf("bad buffers: %#v", buffers)
+		}
+	})
+	t.Run("cache", func(t *testing.T) {
+		var keys []string
+		rec := get("/cache", &keys)
+		if len(keys) != 1 || keys[0] != fooID {
+			t.Fatal("bad cache keys:", keys)
+		}
+		// only the keys, never the values
+		if strings.Contains(rec.Body.String(), `"foo"`) {
+			t.Fatal("cache values exposed:", rec.Body.String())
+		}
+	})
+	t.Run("cache-stats", func(t *testing.T) {
+		// Store keeps no statistics
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/cache/stats", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatal("expected not found, got:", rec.Code)
+		}
+
+		st := NewBoundedStore(BoundedStoreInput{})
+		st.Save(fooID, "foo")
+		var stats CacheStats
+		rec = httptest.NewRecorder()
+		NewStatusHandler(NewWatcher(WatcherInput{Cache: st}), nil).ServeHTTP(
+			rec, httptest.NewRequest("GET", "/cache/stats", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+		if stats.Entries != 1 || stats.Bytes == 0 {
+			t.Fatalf("bad cache stats: %#v", stats)
+		}
+	})
+	t.Run("templates", func(t *testing.T) {
+		var tmpls []templateJSON
+		get("/templates", &tmpls)
+		if len(tmpls) != 1 {
+			t.Fatal("expected 1 template, got:", len(tmpls))
+		}
+		if tmpls[0].Reason != "missing" || len(tmpls[0].Missing) != 1 {
+			t.Fatalf("bad template: %#v", tmpls[0])
+		}
+	})
+	t.Run("all", func(t *testing.T) {
+		var all statusJSON
+		get("/", &all)
+		if len(all.Views) != 1 || len(all.Cache) != 1 ||
+			len(all.Buffers) != 1 || len(all.Templates) != 1 {
+			t.Fatalf("bad status: %#v", all)
+		}
+	})
+	t.Run("goroutines", func(t *testing.T) {
+		rec := get("/goroutines", nil)
+		if !strings.Contains(rec.Body.String(), "goroutine") {
+			t.Fatal("bad goroutine dump")
+		}
+	})
+	t.Run("mounted", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.Handle("/status/", http.StripPrefix("/status", h))
+		for _, path := range []string{"/status/", "/status/views"} {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("bad status code for %s: %d", path, rec.Code)
+			}
+		}
+	})
+	t.Run("not-found", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/nope", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Fatal("expected not found, got:", rec.Code)
+		}
+	})
+}
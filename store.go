@@ -1,11 +1,17 @@
 package hcat
 
 import (
+	"sort"
 	"sync"
 )
 
 // Store is what Template uses to determine the values that are
 // available for template parsing.
+//
+// Store is versioned, each change creating a new version of its data, and
+// Snapshot returns an immutable view of the current version. The maps are
+// copied on the first change after a snapshot, so snapshots are cheap and
+// never see later changes.
 type Store struct {
 	sync.RWMutex
 
@@ -16,6 +22,11 @@ type Store struct {
 	// receivedData is an internal tracker of which dependencies have stored
 	// data in the Store.
 	receivedData map[string]struct{}
+
+	// version is incremented by each change, shared is true if the maps are
+	// referenced by a snapshot and must be copied before being changed.
+	version uint64
+	shared  bool
 }
 
 // NewStore creates a new Store with empty values for each
@@ -34,8 +45,10 @@ func (s *Store) Save(id string, data interface{}) {
 	s.Lock()
 	defer s.Unlock()
 
+	s.unshare()
 	s.data[id] = data
 	s.receivedData[id] = struct{}{}
+	s.version++
 }
 
 // Recall gets the current value for the given dependency in the Store.
@@ -51,14 +64,32 @@ func (s *Store) Recall(id string) (interface{}, bool) {
 	return s.data[id], true
 }
 
+// Keys returns the sorted IDs of all dependencies with data in the Store.
+func (s *Store) Keys() []string {
+	s.RLock()
+	defer s.RUnlock()
+
+	keys := make([]string, 0, len(s.receivedData))
+	for k := range s.receivedData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Forget accepts a dependency and removes all associated data with this
 // dependency. It also resets the "receivedData" internal map.
 func (s *Store) Delete(id string) {
 	s.Lock()
 	defer s.Unlock()
 
+	if _, ok := s.receivedData[id]; !ok {
+		return
+	}
+	s.unshare()
 	delete(s.data, id)
 	delete(s.receivedData, id)
+	s.version++
 }
 
 // Reset clears all stored data.
@@ -66,12 +97,69 @@ func (s *Store) Reset() {
 	s.Lock()
 	defer s.Unlock()
 
-	for k := range s.data {
-		delete(s.data, k)
+	s.data = make(map[string]interface{})
+	s.receivedData = make(map[string]struct{})
+	s.shared = false
+	s.version++
+}
+
+// Version returns the version of the data, incremented by each change.
+func (s *Store) Version() uint64 {
+	s.RLock()
+	defer s.RUnlock()
+	return s.version
+}
+
+// Snapshot returns an immutable view of the current version of the data.
+func (s *Store) Snapshot() *Snapshot {
+	s.Lock()
+	defer s.Unlock()
+
+	s.shared = true
+	return &Snapshot{
+		version:      s.version,
+		data:         s.data,
+		receivedData: s.receivedData,
+	}
+}
+
+// unshare copies the maps if they are referenced by a snapshot, so they can
+// be changed. The caller must hold the lock.
+func (s *Store) unshare() {
+	if !s.shared {
+		return
 	}
+	data := make(map[string]interface{}, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	received := make(map[string]struct{}, len(s.receivedData))
 	for k := range s.receivedData {
-		delete(s.receivedData, k)
+		received[k] = struct{}{}
 	}
+	s.data, s.receivedData = data, received
+	s.shared = false
+}
+
+// Snapshot is an immutable view of a version of a Store's data. It is safe
+// for concurrent use.
+type Snapshot struct {
+	version      uint64
+	data         map[string]interface{}
+	receivedData map[string]struct{}
+}
+
+// Recall gets the value for the given dependency in the snapshot.
+func (s *Snapshot) Recall(id string) (interface{}, bool) {
+	if _, ok := s.receivedData[id]; !ok {
+		return nil, false
+	}
+	return s.data[id], true
+}
+
+// Version returns the version of the Store's data in the snapshot.
+func (s *Snapshot) Version() uint64 {
+	return s.version
 }
 
 // forceSet is used to force set the value of a dependency for a given hash
@@ -80,6 +168,8 @@ func (s *Store) forceSet(hashCode string, data interface{}) {
 	s.Lock()
 	defer s.Unlock()
 
+	s.unshare()
 	s.data[hashCode] = data
 	s.receivedData[hashCode] = struct{}{}
+	s.version++
 }
@@ -129,3 +129,49 @@ func TestReset(t *testing.T) {
 		t.Errorf("expected %#v to not be forgotten", d)
 	}
 }
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+	st := NewStore()
+
+	st.Save("b", "data")
+	st.Save("a", nil)
+	keys := st.Keys()
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("bad keys: %v", keys)
+	}
+}
+
+func TestStoreSnapshot(t *testing.T) {
+	t.Parallel()
+	st := NewStore()
+	st.Save("foo", "v1")
+	st.Save("bar", "v1")
+	version := st.Version()
+
+	snap := st.Snapshot()
+	st.Save("foo", "v2")
+	st.Delete("bar")
+	st.Save("baz", "v1")
+
+	if snap.Version() != version || st.Version() != version+3 {
+		t.Fatalf("bad versions: %d, %d", snap.Version(), st.Version())
+	}
+	if v, ok := snap.Recall("foo"); !ok || v != "v1" {
+		t.Errorf("expected v1 in snapshot, got %v", v)
+	}
+	if _, ok := snap.Recall("bar"); !ok {
+		t.Error("expected deleted data in snapshot")
+	}
+	if _, ok := snap.Recall("baz"); ok {
+		t.Error("expected no new data in snapshot")
+	}
+	if v, _ := st.Recall("foo"); v != "v2" {
+		t.Errorf("expected v2 in store, got %v", v)
+	}
+
+	st.Reset()
+	if v, ok := snap.Recall("foo"); !ok || v != "v1" {
+		t.Errorf("expected reset to keep snapshot, got %v", v)
+	}
+}
@@ -0,0 +1,126 @@
+package hcat
+
+import (
+	"sync"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+// Update is a data update for a subscribed dependency.
+type Update struct {
+	// ID is the dependency's ID (its String() value).
+	ID string
+	// Data is the dependency's data, as saved to the cache.
+	Data interface{}
+	// LastIndex is the index of the data reported by the upstream, zero if
+	// the data was already cached when subscribing.
+	LastIndex uint64
+}
+
+// subscription is a single subscriber to a dependency's updates.
+type subscription struct {
+	ch     chan Update
+	mux    sync.Mutex
+	closed bool
+}
+
+// send delivers the update, replacing any update not yet received so a slow
+// subscriber never blocks the watcher and always gets the latest data.
+func (s *subscription) send(u Update) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case <-s.ch:
+	default:
+	}
+	s.ch <- u
+}
+
+func (s *subscription) close() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// Subscribe watches the dependency without a template. Its data updates are
+// sent to the returned channel as they are processed by Wait, so Wait must
+// be running for updates to be delivered. If the dependency's data is
+// already cached, it is sent right away.
+//
+// The channel holds only the latest update; an update not yet received when
+// a new one arrives is replaced. A dependency can have any number of
+// subscribers and is watched until all of them are canceled and no template
+// uses it. Call cancel to unsubscribe, which closes the channel. Stop closes
+// all channels.
+func (w *Watcher) Subscribe(d dep.Dependency) (<-chan Update, func()) {
+	id := d.String()
+	s := &subscription{ch: make(chan Update, 1)}
+
+	w.subsMx.Lock()
+	if w.subs[id] == nil {
+		w.subs[id] = make(map[*subscription]struct{})
+	}
+	w.subs[id][s] = struct{}{}
+	w.subsMx.Unlock()
+
+	w.Add(d)
+	if data, ok := w.cache.Recall(id); ok {
+		s.send(Update{ID: id, Data: data})
+	}
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() { w.unsubscribe(id, s) })
+	}
+}
+
+// unsubscribe removes the subscriber and stops watching the dependency if it
+// is no longer used.
+func (w *Watcher) unsubscribe(id string, s *subscription) {
+	w.subsMx.Lock()
+	delete(w.subs[id], s)
+	unused := len(w.subs[id]) == 0
+	if unused {
+		delete(w.subs, id)
+	}
+	w.subsMx.Unlock()
+	s.close()
+
+	if unused && len(w.depTracker.depTemplates(id)) == 0 {
+		w.remove(id)
+	}
+}
+
+// subscribed returns true if the dependency has any subscribers.
+func (w *Watcher) subscribed(id string) bool {
+	w.subsMx.Lock()
+	defer w.subsMx.Unlock()
+	return len(w.subs[id]) > 0
+}
+
+// notify sends the update to the dependency's subscribers.
+func (w *Watcher) notify(id string, data interface{}, index uint64) {
+	w.subsMx.Lock()
+	defer w.subsMx.Unlock()
+	for s := range w.subs[id] {
+		s.send(Update{ID: id, Data: data, LastIndex: index})
+	}
+}
+
+// closeSubscriptions closes and removes all subscriptions.
+func (w *Watcher) closeSubscriptions() {
+	w.subsMx.Lock()
+	defer w.subsMx.Unlock()
+	for _, subs := range w.subs {
+		for s := range subs {
+			s.close()
+		}
+	}
+	w.subs = make(map[string]map[*subscription]struct{})
+}
@@ -0,0 +1,141 @@
+package hcat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+func TestWatcherSubscribe(t *testing.T) {
+	receive := func(t *testing.T, ch <-chan Update) Update {
+		select {
+		case u, ok := <-ch:
+			if !ok {
+				t.Fatal("channel closed")
+			}
+			return u
+		case <-time.After(time.Second):
+			t.Fatal("no update received")
+		}
+		return Update{}
+	}
+	waitFor := func(t *testing.T, w *Watcher, id string) {
+		for !changedHas(w, id) {
+			if err := w.Wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("updates", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		ch, cancel := w.Subscribe(d)
+		defer cancel()
+		waitFor(t, w, d.String())
+		u := receive(t, ch)
+		if u.ID != d.String() || u.Data != "foo" || u.LastIndex != 1 {
+			t.Fatalf("bad update: %#v", u)
+		}
+	})
+	t.Run("multiple-subscribers", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		ch1, cancel1 := w.Subscribe(d)
+		defer cancel1()
+		ch2, cancel2 := w.Subscribe(d)
+		defer cancel2()
+		if w.Size() != 1 {
+			t.Fatal("expected 1 view, got:", w.Size())
+		}
+		waitFor(t, w, d.String())
+		if u := receive(t, ch1); u.Data != "foo" {
+			t.Fatalf("bad update: %#v", u)
+		}
+		if u := receive(t, ch2); u.Data != "foo" {
+			t.Fatalf("bad update: %#v", u)
+		}
+	})
+	t.Run("cached", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		w.cache.Save(d.String(), "cached")
+		ch, cancel := w.Subscribe(d)
+		defer cancel()
+		if u := receive(t, ch); u.Data != "cached" {
+			t.Fatalf("bad update: %#v", u)
+		}
+	})
+	t.Run("latest", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		ch, cancel := w.Subscribe(d)
+		defer cancel()
+		w.notify(d.String(), "old", 1)
+		w.notify(d.String(), "new", 2)
+		if u := receive(t, ch); u.Data != "new" || u.LastIndex != 2 {
+			t.Fatalf("expected latest update, got: %#v", u)
+		}
+	})
+	t.Run("not-cleaned", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		_, cancel := w.Subscribe(d)
+		defer cancel()
+		w.cleanDeps(make(chan struct{}))
+		if !w.Watching(d.String()) {
+			t.Fatal("subscribed dependency should not have been cleaned")
+		}
+		if ids := w.TemplateIDs(); len(ids) != 0 {
+			t.Fatal("subscription should not be a template:", ids)
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		ch1, cancel1 := w.Subscribe(d)
+		_, cancel2 := w.Subscribe(d)
+
+		cancel1()
+		cancel1() // no-op
+		if _, ok := <-ch1; ok {
+			t.Fatal("expected channel to be closed")
+		}
+		if !w.Watching(d.String()) {
+			t.Fatal("dependency still has a subscriber")
+		}
+		cancel2()
+		if w.Watching(d.String()) {
+			t.Fatal("dependency should no longer be watched")
+		}
+	})
+	t.Run("cancel-template-use", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+		d := &idep.FakeDep{Name: "foo"}
+		w.Register("tmpl", d)
+		_, cancel := w.Subscribe(d)
+		cancel()
+		if !w.Watching(d.String()) {
+			t.Fatal("dependency used by template should still be watched")
+		}
+	})
+	t.Run("stop", func(t *testing.T) {
+		w := newWatcher(t)
+		ch, cancel := w.Subscribe(&idep.FakeDep{Name: "foo"})
+		defer cancel()
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for range ch {
+		}
+	})
+}
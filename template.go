@@ -41,6 +41,12 @@ type Template struct {
 	// prefix.
 	sandboxPath string
 
+	// decryptKeyFile is the age identity file of the decrypt functions.
+	decryptKeyFile string
+
+	// hashes memoizes the password hash functions across executions.
+	hashes hashCache
+
 	// Renderer is the default renderer used for this template
 	renderer Renderer
 }
@@ -86,6 +92,11 @@ type TemplateInput struct {
 	// prefix.
 	SandboxPath string
 
+	// DecryptKeyFile is the path of the age identity file that the
+	// decryptAge and decryptSOPS functions decrypt with. The keys are read
+	// when the functions are called and are never exposed to the template.
+	DecryptKeyFile string
+
 	// Renderer is the default renderer used for this template
 	Renderer Renderer
 }
@@ -102,6 +113,7 @@ func NewTemplate(i TemplateInput) *Template {
 	t.rightDelim = i.RightDelim
 	t.errMissingKey = i.ErrMissingKey
 	t.sandboxPath = i.SandboxPath
+	t.decryptKeyFile = i.DecryptKeyFile
 	t.funcMapMerge = i.FuncMapMerge
 	t.renderer = i.Renderer
 
@@ -137,6 +149,7 @@ type ExecuteResult struct {
 // Execute evaluates this template in the provided context.
 func (t *Template) Execute(r Recaller) (*ExecuteResult, error) {
 	var used, missing = NewDepSet(), NewDepSet()
+	t.hashes.rotate()
 
 	tmpl := template.New(t.ID())
 	tmpl.Delims(t.leftDelim, t.rightDelim)
@@ -148,6 +161,12 @@ func (t *Template) Execute(r Recaller) (*ExecuteResult, error) {
 		missing:      missing,
 		funcMapMerge: t.funcMapMerge,
 		sandboxPath:  t.sandboxPath,
+		decrypter: &decrypter{
+			r:       r,
+			used:    used,
+			keyFile: t.decryptKeyFile,
+		},
+		hashes: &t.hashes,
 	}))
 
 	if t.errMissingKey {
@@ -181,6 +200,8 @@ type funcMapInput struct {
 	env          []string
 	funcMapMerge template.FuncMap
 	sandboxPath  string
+	decrypter    *decrypter
+	hashes       *hashCache
 	used         *DepSet
 	missing      *DepSet
 }
@@ -191,68 +212,124 @@ func funcMap(i *funcMapInput) template.FuncMap {
 
 	r := template.FuncMap{
 		// API functions
-		"datacenters":  datacentersFunc(i.store, i.used, i.missing),
-		"file":         fileFunc(i.store, i.used, i.missing, i.sandboxPath),
-		"key":          keyFunc(i.store, i.used, i.missing),
-		"keyExists":    keyExistsFunc(i.store, i.used, i.missing),
-		"keyOrDefault": keyWithDefaultFunc(i.store, i.used, i.missing),
-		"ls":           lsFunc(i.store, i.used, i.missing, true),
-		"safeLs":       safeLsFunc(i.store, i.used, i.missing),
-		"node":         nodeFunc(i.store, i.used, i.missing),
-		"nodes":        nodesFunc(i.store, i.used, i.missing),
-		"secret":       secretFunc(i.store, i.used, i.missing),
-		"secrets":      secretsFunc(i.store, i.used, i.missing),
-		"service":      serviceFunc(i.store, i.used, i.missing),
-		"connect":      connectFunc(i.store, i.used, i.missing),
-		"services":     servicesFunc(i.store, i.used, i.missing),
-		"tree":         treeFunc(i.store, i.used, i.missing, true),
-		"safeTree":     safeTreeFunc(i.store, i.used, i.missing),
-		"caRoots":      connectCARootsFunc(i.store, i.used, i.missing),
-		"caLeaf":       connectLeafFunc(i.store, i.used, i.missing),
+		"datacenters":    datacentersFunc(i.store, i.used, i.missing),
+		"file":           fileFunc(i.store, i.used, i.missing, i.sandboxPath),
+		"key":            keyFunc(i.store, i.used, i.missing),
+		"keyExists":      keyExistsFunc(i.store, i.used, i.missing),
+		"keyOrDefault":   keyWithDefaultFunc(i.store, i.used, i.missing),
+		"ls":             lsFunc(i.store, i.used, i.missing, true),
+		"safeLs":         safeLsFunc(i.store, i.used, i.missing),
+		"node":           nodeFunc(i.store, i.used, i.missing),
+		"nodes":          nodesFunc(i.store, i.used, i.missing),
+		"secret":         secretFunc(i.store, i.used, i.missing),
+		"secrets":        secretsFunc(i.store, i.used, i.missing),
+		"service":        serviceFunc(i.store, i.used, i.missing),
+		"connect":        connectFunc(i.store, i.used, i.missing),
+		"services":       servicesFunc(i.store, i.used, i.missing),
+		"tree":           treeFunc(i.store, i.used, i.missing, true),
+		"safeTree":       safeTreeFunc(i.store, i.used, i.missing),
+		"caRoots":        connectCARootsFunc(i.store, i.used, i.missing),
+		"caLeaf":         connectLeafFunc(i.store, i.used, i.missing),
+		"dataAge":        dataAgeFunc(i.store, i.used, i.missing),
+		"transitEncrypt": transitFunc(i.store, i.used, i.missing, "encrypt"),
+		"transitDecrypt": transitFunc(i.store, i.used, i.missing, "decrypt"),
+		"transitHMAC":    transitFunc(i.store, i.used, i.missing, "hmac"),
+		"transitSign":    transitFunc(i.store, i.used, i.missing, "sign"),
 
 		// scratch
 		"scratch": func() *scratch { return &scrat },
 
 		// Helper functions
+		"append":          appendFunc,
+		"argon2id":        argon2Func(i.hashes),
 		"base64Decode":    base64Decode,
 		"base64Encode":    base64Encode,
 		"base64URLDecode": base64URLDecode,
 		"base64URLEncode": base64URLEncode,
+		"bcrypt":          bcryptFunc(i.hashes),
 		"byKey":           byKey,
 		"byTag":           byTag,
+		"certChain":       certChain,
+		"cidrContains":    cidrContains,
+		"cidrHost":        cidrHost,
+		"cidrMerge":       cidrMerge,
+		"cidrNetmask":     cidrNetmask,
+		"cidrSubnet":      cidrSubnet,
+		"coalesce":        coalesce,
 		"contains":        contains,
 		"containsAll":     containsSomeFunc(true, true),
 		"containsAny":     containsSomeFunc(false, false),
 		"containsNone":    containsSomeFunc(true, false),
 		"containsNotAll":  containsSomeFunc(false, true),
+		"decryptAge":      decryptAgeFunc(i.decrypter),
+		"decryptSOPS":     decryptSOPSFunc(i.decrypter),
+		"default":         defaultFunc,
+		"deriveKey":       deriveKey,
+		"derivePassword":  derivePassword,
+		"dict":            dict,
 		"env":             envFunc(i.env),
 		"executeTemplate": executeTemplateFunc(i.t),
 		"explode":         explode,
 		"explodeMap":      explodeMap,
+		"first":           first,
+		"hmacSHA256Hex":   hmacSHA256Hex,
 		"in":              in,
 		"indent":          indent,
+		"isIPv4":          isIPv4,
+		"isIPv6":          isIPv6,
+		"keys":            keys,
+		"last":            last,
+		"list":            listFunc,
 		"loop":            loop,
 		"join":            join,
 		"trimSpace":       trimSpace,
 		"parseBool":       parseBool,
+		"parseCert":       parseCert,
+		"parseCerts":      parseCerts,
+		"parseCSV":        parseCSV,
+		"parseDotenv":     parseDotenv,
 		"parseFloat":      parseFloat,
+		"parseHCL":        parseHCL,
+		"parseINI":        parseINI,
 		"parseInt":        parseInt,
 		"parseJSON":       parseJSON,
+		"parseProperties": parseProperties,
+		"parseTOML":       parseTOML,
 		"parseUint":       parseUint,
 		"parseYAML":       parseYAML,
+		"pemToBase64":     pemToBase64,
+		"pemToDER":        pemToDER,
+		"pluck":           pluck,
 		"plugin":          plugin,
+		"query":           query,
 		"regexReplaceAll": regexReplaceAll,
 		"regexMatch":      regexMatch,
+		"repeat":          repeat,
 		"replaceAll":      replaceAll,
+		"scrypt":          scryptFunc(i.hashes),
 		"sha256Hex":       sha256Hex,
+		"sortBy":          sortBy,
+		"sortIPs":         sortIPs,
+		"splitPEM":        splitPEM,
+		"sublist":         sublist,
+		"ternary":         ternary,
 		"timestamp":       timestamp,
+		"toCSV":           toCSV,
+		"toDotenv":        toDotenv,
+		"toHCL":           toHCL,
+		"toINI":           toINI,
 		"toLower":         toLower,
 		"toJSON":          toJSON,
 		"toJSONPretty":    toJSONPretty,
+		"toProperties":    toProperties,
 		"toTitle":         toTitle,
 		"toTOML":          toTOML,
 		"toUpper":         toUpper,
 		"toYAML":          toYAML,
+		"trimPrefix":      trimPrefix,
+		"trimSuffix":      trimSuffix,
+		"uniq":            uniq,
+		"values":          values,
 		"split":           split,
 		"byMeta":          byMeta,
 		"sockaddr":        sockaddr,
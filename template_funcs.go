@@ -363,6 +363,41 @@ func secretFunc(r Recaller, used, missing *DepSet) func(...string) (*dep.Secret,
 	}
 }
 
+// transitFunc returns or accumulates Vault Transit dependencies, of the
+// operation with the key on the input. The key is "<mount>/<name>" or a name
+// in the "transit" mount. Empty inputs, such as values not yet fetched,
+// return an empty string.
+//
+// 		{{ key "app/password" | transitEncrypt "app" }}
+//
+func transitFunc(r Recaller, used, missing *DepSet,
+	op string) func(string, string) (string, error) {
+	return func(key, input string) (string, error) {
+		if len(input) == 0 {
+			return "", nil
+		}
+
+		d, err := idep.NewVaultTransitQuery(idep.TransitOperation(op), key, input)
+		if err != nil {
+			return "", err
+		}
+
+		used.Add(d)
+
+		if value, ok := r.Recall(d.String()); ok {
+			result, ok := value.(string)
+			if !ok {
+				return "", fmt.Errorf("%s: unexpected result %T", d, value)
+			}
+			return result, nil
+		}
+
+		missing.Add(d)
+
+		return "", nil
+	}
+}
+
 // secretsFunc returns or accumulates a list of secret dependencies from Vault.
 func secretsFunc(r Recaller, used, missing *DepSet) func(string) ([]string, error) {
 	return func(s string) ([]string, error) {
@@ -537,6 +572,31 @@ func connectLeafFunc(r Recaller, used, missing *DepSet,
 	}
 }
 
+// dataAger is implemented by Recallers that know how stale their data is,
+// like the Watcher.
+type dataAger interface {
+	DataAge(id string) time.Duration
+}
+
+// dataAgeFunc returns how long the oldest data used so far in the template
+// has been stale, zero if it is all up to date. It only sees the data used
+// before it is called, so is best used at the end of the template.
+func dataAgeFunc(r Recaller, used, missing *DepSet) func() time.Duration {
+	return func() time.Duration {
+		a, ok := r.(dataAger)
+		if !ok {
+			return 0
+		}
+		var age time.Duration
+		for _, d := range used.List() {
+			if da := a.DataAge(d.String()); da > age {
+				age = da
+			}
+		}
+		return age
+	}
+}
+
 func safeTreeFunc(r Recaller, used, missing *DepSet) func(string) ([]*dep.KeyPair, error) {
 	// call treeFunc but explicitly mark that empty data set returned on
 	// monitored KV prefix is NOT safe
@@ -1548,3 +1608,411 @@ func sha256Hex(item string) (string, error) {
 	output := hex.EncodeToString(h.Sum(nil))
 	return output, nil
 }
+
+// dict creates a map from a list of key/value pairs. Keys must be strings.
+//
+// 		{{ $m := dict "a" 1 "b" 2 }}
+//
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments (%d)", len(pairs))
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		k, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is %T, not a string",
+				pairs[i], pairs[i])
+		}
+		m[k] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// listFunc creates a list from its arguments.
+func listFunc(items ...interface{}) ([]interface{}, error) {
+	if items == nil {
+		return []interface{}{}, nil
+	}
+	return items, nil
+}
+
+// appendFunc returns a copy of the list with the value appended. It takes the
+// list last so it can be piped:
+//
+// 		{{ list "a" "b" | append "c" }}
+//
+func appendFunc(v, l interface{}) ([]interface{}, error) {
+	items, err := listItems("append", l)
+	if err != nil {
+		return nil, err
+	}
+	return append(items, v), nil
+}
+
+// keys returns the sorted keys of a map.
+func keys(m interface{}) ([]string, error) {
+	mv, err := mapValue("keys", m)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, mv.Len())
+	for _, k := range sortedMapKeys(mv) {
+		result = append(result, fmt.Sprint(k.Interface()))
+	}
+	return result, nil
+}
+
+// values returns the values of a map, in the order of their sorted keys.
+func values(m interface{}) ([]interface{}, error) {
+	mv, err := mapValue("values", m)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, mv.Len())
+	for _, k := range sortedMapKeys(mv) {
+		result = append(result, mv.MapIndex(k).Interface())
+	}
+	return result, nil
+}
+
+// pluck returns the value of the key from each element of the list. Elements
+// can be maps or structs, for structs the key is the field name. Elements
+// without the key are skipped.
+//
+// 		{{ service "web" | pluck "Address" }}
+//
+func pluck(key string, l interface{}) ([]interface{}, error) {
+	items, err := listItems("pluck", l)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if v, ok := lookupField(item, key); ok {
+			result = append(result, v.Interface())
+		}
+	}
+	return result, nil
+}
+
+// uniq returns the list with duplicates removed, keeping the first of each.
+func uniq(l interface{}) ([]interface{}, error) {
+	items, err := listItems("uniq", l)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		found := false
+		for _, r := range result {
+			if reflect.DeepEqual(r, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// sortBy sorts a list of maps or structs by the value of the key, which must
+// be strings, numbers or bools. The sort is stable and elements without the
+// key are sorted last.
+//
+// 		{{ service "web" | sortBy "Node" }}
+//
+func sortBy(key string, l interface{}) ([]interface{}, error) {
+	items, err := listItems("sortBy", l)
+	if err != nil {
+		return nil, err
+	}
+	var sortErr error
+	sort.SliceStable(items, func(i, j int) bool {
+		a, aok := lookupField(items[i], key)
+		b, bok := lookupField(items[j], key)
+		if !aok || !bok {
+			return aok && !bok
+		}
+		c, err := compareValues(a, b)
+		if err != nil && sortErr == nil {
+			sortErr = fmt.Errorf("sortBy: %q: %s", key, err)
+		}
+		return c < 0
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	return items, nil
+}
+
+// defaultFunc returns the default when the value is empty (see isEmpty). It
+// takes the value last so it can be piped:
+//
+// 		{{ key "port" | default "8080" }}
+//
+func defaultFunc(d, v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return d, nil
+	}
+	return v, nil
+}
+
+// coalesce returns the first of its arguments that is not empty, or nil.
+func coalesce(vs ...interface{}) (interface{}, error) {
+	for _, v := range vs {
+		if !isEmpty(v) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// ternary returns t if the condition is true and f otherwise. It takes the
+// condition last so it can be piped:
+//
+// 		{{ keyExists "maintenance" | ternary "down" "up" }}
+//
+func ternary(t, f interface{}, cond bool) (interface{}, error) {
+	if cond {
+		return t, nil
+	}
+	return f, nil
+}
+
+// first returns the first element of the list, or nil if it is empty.
+func first(l interface{}) (interface{}, error) {
+	items, err := listItems("first", l)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// last returns the last element of the list, or nil if it is empty.
+func last(l interface{}) (interface{}, error) {
+	items, err := listItems("last", l)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// sublist returns part of a list or string. Unlike the builtin slice, the
+// indexes are clamped to its bounds and the list comes last so it can be
+// piped:
+//
+// 		{{ list 1 2 3 4 | sublist 1 3 }}
+//
+func sublist(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("sublist: wrong number of arguments (%d)", len(args))
+	}
+	subject, indexes := args[len(args)-1], args[:len(args)-1]
+
+	sv := reflect.Indirect(reflect.ValueOf(subject))
+	switch sv.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Array, reflect.Slice, reflect.String:
+	default:
+		return nil, fmt.Errorf("sublist: wrong argument type %T", subject)
+	}
+
+	start, end := 0, sv.Len()
+	for i, idx := range indexes {
+		n, err := toInt(idx)
+		if err != nil {
+			return nil, fmt.Errorf("sublist: %s", err)
+		}
+		switch {
+		case n < 0:
+			n = 0
+		case n > sv.Len():
+			n = sv.Len()
+		}
+		if i == 0 {
+			start = n
+		} else {
+			end = n
+		}
+	}
+	if start > end {
+		start = end
+	}
+	if sv.Kind() == reflect.Array && !sv.CanAddr() {
+		// arrays passed by value can't be sliced
+		c := reflect.New(sv.Type()).Elem()
+		c.Set(sv)
+		sv = c
+	}
+	return sv.Slice(start, end).Interface(), nil
+}
+
+// trimPrefix is a version of strings.TrimPrefix that can be piped
+func trimPrefix(p, s string) (string, error) {
+	return strings.TrimPrefix(s, p), nil
+}
+
+// trimSuffix is a version of strings.TrimSuffix that can be piped
+func trimSuffix(p, s string) (string, error) {
+	return strings.TrimSuffix(s, p), nil
+}
+
+// repeat is a version of strings.Repeat that can be piped
+func repeat(n int, s string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("repeat: negative count %d", n)
+	}
+	return strings.Repeat(s, n), nil
+}
+
+// listItems returns the elements of a slice or array as a new list. Nil
+// becomes an empty list.
+func listItems(name string, l interface{}) ([]interface{}, error) {
+	lv := reflect.Indirect(reflect.ValueOf(l))
+	switch lv.Kind() {
+	case reflect.Invalid:
+		return []interface{}{}, nil
+	case reflect.Array, reflect.Slice:
+		items := make([]interface{}, lv.Len())
+		for i := range items {
+			items[i] = lv.Index(i).Interface()
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("%s: wrong argument type %T", name, l)
+	}
+}
+
+// mapValue returns the map's value. Nil becomes an empty map.
+func mapValue(name string, m interface{}) (reflect.Value, error) {
+	mv := reflect.Indirect(reflect.ValueOf(m))
+	switch mv.Kind() {
+	case reflect.Invalid:
+		return reflect.ValueOf(map[string]interface{}{}), nil
+	case reflect.Map:
+		return mv, nil
+	default:
+		return reflect.Value{}, fmt.Errorf("%s: wrong argument type %T", name, m)
+	}
+}
+
+// sortedMapKeys returns the map's keys sorted by their string form.
+func sortedMapKeys(mv reflect.Value) []reflect.Value {
+	ks := mv.MapKeys()
+	sort.Slice(ks, func(i, j int) bool {
+		return fmt.Sprint(ks[i].Interface()) < fmt.Sprint(ks[j].Interface())
+	})
+	return ks
+}
+
+// lookupField returns the value of a map's key or a struct's exported field.
+func lookupField(item interface{}, key string) (reflect.Value, bool) {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		f := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !f.IsValid() {
+			return reflect.Value{}, false
+		}
+		return f, true
+	case reflect.Struct:
+		sf, ok := v.Type().FieldByName(key)
+		if !ok || sf.PkgPath != "" {
+			return reflect.Value{}, false
+		}
+		return v.FieldByIndex(sf.Index), true
+	}
+	return reflect.Value{}, false
+}
+
+// compareValues compares two strings, numbers or bools, returning -1, 0 or 1.
+func compareValues(a, b reflect.Value) (int, error) {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	switch {
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), nil
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		switch {
+		case a.Bool() == b.Bool():
+			return 0, nil
+		case b.Bool():
+			return -1, nil
+		}
+		return 1, nil
+	}
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if !aok || !bok {
+		return 0, fmt.Errorf("cannot compare %s and %s", a.Type(), b.Type())
+	}
+	switch {
+	case af < bf:
+		return -1, nil
+	case af > bf:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// toFloat returns the number as a float64.
+func toFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// toInt returns the integer as an int.
+func toInt(i interface{}) (int, error) {
+	v := reflect.ValueOf(i)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), nil
+	}
+	return 0, fmt.Errorf("expected an integer, got %T", i)
+}
+
+// isEmpty returns true for nil, false, zero numbers, and empty strings,
+// lists and maps.
+func isEmpty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Bool:
+		return !rv.Bool()
+	}
+	if f, ok := toFloat(rv); ok {
+		return f == 0
+	}
+	return false
+}
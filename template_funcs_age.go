@@ -0,0 +1,51 @@
+package hcat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/pkg/errors"
+)
+
+// Decryption of age encrypted files (https://age-encryption.org/v1), binary
+// or armored, with the X25519 identities of an age identity file.
+
+// readAgeIdentities reads the identities of the key file. Errors don't
+// include the keys.
+func readAgeIdentities(path string) ([]age.Identity, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no decrypt key file configured")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "key file")
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "key file %s", path)
+	}
+	return ids, nil
+}
+
+// ageDecrypt decrypts an age file, binary or armored, with the identities.
+func ageDecrypt(data []byte, ids []age.Identity) ([]byte, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte(armor.Header)) {
+		r = armor.NewReader(bytes.NewReader(trimmed))
+	}
+	dr, err := age.Decrypt(r, ids...)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := ioutil.ReadAll(dr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt the payload")
+	}
+	return plain, nil
+}
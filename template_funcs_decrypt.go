@@ -0,0 +1,409 @@
+package hcat
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/hashicorp/hcat/dep"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Functions to decrypt values encrypted with age or SOPS, such as those in
+// Consul KV or files. They decrypt with the identities of the template's
+// DecryptKeyFile, an age identity file, which are never exposed to the
+// template:
+//
+// 		{{ key "app/db_password" | decryptAge }}
+// 		{{ with file "secrets.enc.yaml" | decryptSOPS }}{{ .db.password }}{{ end }}
+//
+// Errors are DecryptErrors, with the dependency of the value.
+
+// DecryptError is the error of decrypting a value in a template, with the
+// dependency the value is from, if known.
+type DecryptError struct {
+	Dependency dep.Dependency
+	Err        error
+}
+
+func (e *DecryptError) Error() string {
+	if e.Dependency == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Dependency, e.Err)
+}
+
+// Unwrap returns the decryption error.
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// decrypter decrypts values for the template functions, reading the key
+// file once per execution.
+type decrypter struct {
+	r       Recaller
+	used    *DepSet
+	keyFile string
+	ids     []age.Identity
+}
+
+// decryptAgeFunc returns the function that decrypts an age encrypted value,
+// binary or armored. Empty values are returned as is, so values not yet
+// fetched render empty.
+func decryptAgeFunc(d *decrypter) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if s == "" {
+			return "", nil
+		}
+		ids, err := d.identities()
+		if err != nil {
+			return "", d.error("decryptAge", s, err)
+		}
+		plain, err := ageDecrypt([]byte(s), ids)
+		if err != nil {
+			return "", d.error("decryptAge", s, err)
+		}
+		return string(plain), nil
+	}
+}
+
+// decryptSOPSFunc returns the function that decrypts a SOPS encrypted JSON
+// or YAML document, with age keys, to its data. The document's MAC is
+// verified.
+func decryptSOPSFunc(d *decrypter) func(string) (map[string]interface{}, error) {
+	return func(s string) (map[string]interface{}, error) {
+		if s == "" {
+			return map[string]interface{}{}, nil
+		}
+		ids, err := d.identities()
+		if err != nil {
+			return nil, d.error("decryptSOPS", s, err)
+		}
+		data, err := sopsDecrypt([]byte(s), ids)
+		if err != nil {
+			return nil, d.error("decryptSOPS", s, err)
+		}
+		return data, nil
+	}
+}
+
+func (d *decrypter) identities() ([]age.Identity, error) {
+	if d.ids == nil {
+		ids, err := readAgeIdentities(d.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		d.ids = ids
+	}
+	return d.ids, nil
+}
+
+// error returns a DecryptError, with the dependency of the value, found by
+// its data among those used by the template.
+func (d *decrypter) error(name, value string, err error) error {
+	e := &DecryptError{Err: fmt.Errorf("%s: %s", name, err)}
+	for _, dp := range d.used.List() {
+		if v, ok := d.r.Recall(dp.String()); ok {
+			if s, ok := v.(string); ok && s == value {
+				e.Dependency = dp
+				break
+			}
+		}
+	}
+	return e
+}
+
+var sopsValueRe = regexp.MustCompile(
+	`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// sopsMetadata is the metadata of a SOPS document, its sops key.
+type sopsMetadata struct {
+	lastModified      string
+	mac               string
+	unencryptedSuffix string
+	encryptedSuffix   string
+	unencryptedRegex  *regexp.Regexp
+	encryptedRegex    *regexp.Regexp
+	// the MAC is only over the encrypted values
+	macOnlyEncrypted bool
+	// the data key encrypted to each age recipient
+	age []string
+}
+
+// sopsMACOnlyEncryptedInit initializes the MAC of documents with
+// mac_only_encrypted set, so it differs from the MAC over all values.
+var sopsMACOnlyEncryptedInit = []byte{0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66,
+	0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0xb, 0xb, 0x97, 0x5b, 0x3b,
+	0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69}
+
+// sopsComment is a comment in a sequence, which SOPS encrypts as one of its
+// values.
+type sopsComment string
+
+// sopsDecrypt decrypts a SOPS document with the age identities. Comments
+// aren't part of the data, and nulls, which SOPS leaves as is, are kept.
+func sopsDecrypt(src []byte, ids []age.Identity) (map[string]interface{}, error) {
+	// JSON is YAML, and MapSlices keep the order the MAC is computed in
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("invalid document: %s", err)
+	}
+	var meta *sopsMetadata
+	var tree yaml.MapSlice
+	for _, item := range doc {
+		if item.Key == "sops" {
+			var err error
+			if meta, err = parseSOPSMetadata(item.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tree = append(tree, item)
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("not a SOPS document, no sops metadata")
+	}
+
+	var key []byte
+	for _, enc := range meta.age {
+		k, err := ageDecrypt([]byte(enc), ids)
+		if err == nil {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("no identity matched any of the age recipients")
+	}
+
+	hash := sha512.New()
+	if meta.macOnlyEncrypted {
+		hash.Write(sopsMACOnlyEncryptedInit)
+	}
+	var walk func(v interface{}, path []string) (interface{}, error)
+	walk = func(v interface{}, path []string) (interface{}, error) {
+		switch typed := v.(type) {
+		case yaml.MapSlice:
+			m := make(map[string]interface{}, len(typed))
+			for _, item := range typed {
+				k := fmt.Sprint(item.Key)
+				value, err := walk(item.Value, append(path[:len(path):len(path)], k))
+				if err != nil {
+					return nil, err
+				}
+				m[k] = value
+			}
+			return m, nil
+		case []interface{}:
+			l := make([]interface{}, 0, len(typed))
+			for _, item := range typed {
+				value, err := walk(item, path)
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := value.(sopsComment); !ok {
+					l = append(l, value)
+				}
+			}
+			return l, nil
+		case nil:
+			return nil, nil
+		}
+
+		encrypted := meta.encrypted(path)
+		if encrypted {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected an encrypted value",
+					strings.Join(path, "."))
+			}
+			var err error
+			if v, err = sopsDecryptValue(s, key, strings.Join(path, ":")+":"); err != nil {
+				return nil, fmt.Errorf("%s: %s", strings.Join(path, "."), err)
+			}
+		}
+		if _, ok := v.(sopsComment); ok || (meta.macOnlyEncrypted && !encrypted) {
+			return v, nil
+		}
+		b, err := sopsMACBytes(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", strings.Join(path, "."), err)
+		}
+		hash.Write(b)
+		return v, nil
+	}
+	data, err := walk(tree, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	lastModified := meta.lastModified
+	if t, err := time.Parse(time.RFC3339, lastModified); err == nil {
+		lastModified = t.Format(time.RFC3339)
+	}
+	mac, err := sopsDecryptValue(meta.mac, key, lastModified)
+	if err != nil {
+		return nil, fmt.Errorf("mac: %s", err)
+	}
+	if mac != fmt.Sprintf("%X", hash.Sum(nil)) {
+		return nil, fmt.Errorf("MAC mismatch, the document was modified")
+	}
+	return data.(map[string]interface{}), nil
+}
+
+func parseSOPSMetadata(v interface{}) (*sopsMetadata, error) {
+	m, ok := v.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("invalid sops metadata")
+	}
+	meta := &sopsMetadata{}
+	for _, item := range m {
+		var err error
+		switch item.Key {
+		case "lastmodified":
+			meta.lastModified = fmt.Sprint(item.Value)
+		case "mac":
+			meta.mac = fmt.Sprint(item.Value)
+		case "unencrypted_suffix":
+			meta.unencryptedSuffix = fmt.Sprint(item.Value)
+		case "encrypted_suffix":
+			meta.encryptedSuffix = fmt.Sprint(item.Value)
+		case "unencrypted_regex":
+			meta.unencryptedRegex, err = regexp.Compile(fmt.Sprint(item.Value))
+		case "encrypted_regex":
+			meta.encryptedRegex, err = regexp.Compile(fmt.Sprint(item.Value))
+		case "mac_only_encrypted":
+			meta.macOnlyEncrypted = item.Value == true
+		case "unencrypted_comment_regex", "encrypted_comment_regex":
+			return nil, fmt.Errorf("%s is not supported", item.Key)
+		case "key_groups":
+			if l, ok := item.Value.([]interface{}); ok && len(l) > 0 {
+				return nil, fmt.Errorf("key groups are not supported")
+			}
+		case "age":
+			l, _ := item.Value.([]interface{})
+			for _, r := range l {
+				rm, _ := r.(yaml.MapSlice)
+				for _, ri := range rm {
+					if ri.Key == "enc" {
+						meta.age = append(meta.age, fmt.Sprint(ri.Value))
+					}
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid sops metadata: %s", err)
+		}
+	}
+	if meta.mac == "" {
+		return nil, fmt.Errorf("invalid sops metadata: no mac")
+	}
+	if len(meta.age) == 0 {
+		return nil, fmt.Errorf("no age recipients, other key types are not supported")
+	}
+	return meta, nil
+}
+
+// encrypted returns true if the value at the path is encrypted, as set by
+// the suffixes and regexes of the keys in the path.
+func (m *sopsMetadata) encrypted(path []string) bool {
+	matchAny := func(f func(string) bool) bool {
+		for _, k := range path {
+			if f(k) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case m.unencryptedSuffix != "":
+		return !matchAny(func(k string) bool { return strings.HasSuffix(k, m.unencryptedSuffix) })
+	case m.encryptedSuffix != "":
+		return matchAny(func(k string) bool { return strings.HasSuffix(k, m.encryptedSuffix) })
+	case m.unencryptedRegex != nil:
+		return !matchAny(m.unencryptedRegex.MatchString)
+	case m.encryptedRegex != nil:
+		return matchAny(m.encryptedRegex.MatchString)
+	}
+	return true
+}
+
+// sopsDecryptValue decrypts an ENC[AES256_GCM,...] value, authenticated with
+// the additional data, to its type.
+func sopsDecryptValue(s string, key []byte, additionalData string) (interface{}, error) {
+	if s == "" {
+		return "", nil
+	}
+	match := sopsValueRe.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+	var parts [3][]byte
+	for i := range parts {
+		var err error
+		if parts[i], err = base64.StdEncoding.DecodeString(match[i+1]); err != nil {
+			return nil, fmt.Errorf("invalid encrypted value")
+		}
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value")
+	}
+
+	switch typ := match[4]; typ {
+	case "str", "bytes":
+		return string(plain), nil
+	case "int":
+		return strconv.Atoi(string(plain))
+	case "float":
+		return strconv.ParseFloat(string(plain), 64)
+	case "bool":
+		return strconv.ParseBool(string(plain))
+	case "time":
+		var t time.Time
+		err := t.UnmarshalText(plain)
+		return t, err
+	case "comment":
+		return sopsComment(plain), nil
+	default:
+		return nil, fmt.Errorf("unknown value type %q", typ)
+	}
+}
+
+// sopsMACBytes returns the bytes of the value the MAC is computed over.
+// Unencrypted timestamps are parsed as strings, so their MAC differs from
+// the one SOPS computes.
+func sopsMACBytes(v interface{}) ([]byte, error) {
+	switch typed := v.(type) {
+	case string:
+		return []byte(typed), nil
+	case int:
+		return []byte(strconv.Itoa(typed)), nil
+	case float64:
+		return []byte(strconv.FormatFloat(typed, 'f', -1, 64)), nil
+	case bool:
+		if typed {
+			return []byte("True"), nil
+		}
+		return []byte("False"), nil
+	case time.Time:
+		return typed.MarshalText()
+	}
+	return nil, fmt.Errorf("unsupported value %T", v)
+}
@@ -0,0 +1,315 @@
+package hcat
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// The files of testdata/decrypt are encrypted with the age and sops CLIs
+// (sops 3.13.3), to the identity of keys.txt:
+//
+// 		age -r $recipient -o secret.txt.age secret.txt
+// 		age -a -r $recipient -o secret.txt.age.asc secret.txt
+// 		sops -e --age $recipient secrets.yaml > secrets.enc.yaml
+// 		sops -e --age $recipient secrets.json > secrets.enc.json
+// 		sops -e --age $recipient --encrypted-regex '^password$' \
+// 			--mac-only-encrypted secrets.yaml > secrets.partial.enc.yaml
+
+const testDecryptKeyFile = "testdata/decrypt/keys.txt"
+
+func testDecryptFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "decrypt", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testDecryptIdentities(t *testing.T) []age.Identity {
+	t.Helper()
+	ids, err := readAgeIdentities(testDecryptKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestAgeDecrypt(t *testing.T) {
+	t.Parallel()
+	ids := testDecryptIdentities(t)
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := testDecryptFile(t, "secret.txt.age")
+	armored := testDecryptFile(t, "secret.txt.age.asc")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		ids     []age.Identity
+		want    string
+		wantErr string
+	}{
+		{"binary", binary, ids, "s3cr3t", ""},
+		{"armored", armored, ids, "s3cr3t", ""},
+		{"armored_whitespace", append([]byte("\n  "), armored...), ids, "s3cr3t", ""},
+		{"other_identity", binary, []age.Identity{other}, "",
+			"no identity matched"},
+		{"truncated", binary[:len(binary)-1], ids, "", "failed to decrypt the payload"},
+		{"not_age", []byte("plain text"), ids, "", "failed to read header"},
+		{"bad_armor", []byte(strings.Replace(string(armored), "YWdl", "!Wdl", 1)), ids, "",
+			"invalid armor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ageDecrypt(tt.data, tt.ids)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("identities", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "hcat")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		key := other.String()
+		for _, data := range []string{
+			"", "# only a comment\n", "AGE-SECRET-KEY-1NOPE\n",
+			strings.ToLower(key[:20]) + key[20:] + "\n",
+			key[:len(key)-1] + "Q\n",
+		} {
+			path := filepath.Join(dir, "keys.txt")
+			if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readAgeIdentities(path)
+			if err == nil {
+				t.Errorf("expected an error for %q", data)
+				continue
+			}
+			if strings.Contains(err.Error(), "AGE-SECRET-KEY") {
+				t.Errorf("error includes the key: %s", err)
+			}
+		}
+	})
+}
+
+func TestSOPSDecrypt(t *testing.T) {
+	t.Parallel()
+	ids := testDecryptIdentities(t)
+	yamlDoc := string(testDecryptFile(t, "secrets.enc.yaml"))
+	jsonDoc := string(testDecryptFile(t, "secrets.enc.json"))
+	partialDoc := string(testDecryptFile(t, "secrets.partial.enc.yaml"))
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	hosts := []interface{}{
+		"a.example.com",
+		"b.example.com",
+		map[string]interface{}{
+			"nested": []interface{}{1, []interface{}{"x", "y"}},
+			"empty":  nil,
+		},
+	}
+	want := map[string]interface{}{
+		"db": map[string]interface{}{
+			"user": "app", "password": "s3cr3t", "port": 5432, "ratio": 0.75,
+			"enabled": true, "created": created, "replica": nil,
+		},
+		"hosts":               hosts,
+		"api_key_unencrypted": "plain",
+	}
+	wantJSON := map[string]interface{}{
+		"db": map[string]interface{}{
+			"user": "app", "password": "s3cr3t", "port": 5432, "ratio": 0.75,
+			"enabled": true, "replica": nil,
+		},
+		"hosts":               append([]interface{}{}, hosts[0], hosts[2]),
+		"api_key_unencrypted": "plain",
+	}
+	wantPartial := map[string]interface{}{
+		"db": map[string]interface{}{
+			"user": "app", "password": "s3cr3t", "port": 5432, "ratio": 0.75,
+			"enabled": true, "created": "2024-01-01T10:00:00Z", "replica": nil,
+		},
+		"hosts":               hosts,
+		"api_key_unencrypted": "plain",
+	}
+
+	// nulls aren't part of the MAC
+	withoutReplica := map[string]interface{}{
+		"db": map[string]interface{}{
+			"user": "app", "password": "s3cr3t", "port": 5432, "ratio": 0.75,
+			"enabled": true, "created": created,
+		},
+		"hosts":               hosts,
+		"api_key_unencrypted": "plain",
+	}
+
+	// swap the lines of two values, which are valid in their own place
+	swap := func(doc, a, b string) string {
+		lines := strings.Split(doc, "\n")
+		var i, j int
+		for n, l := range lines {
+			if strings.HasPrefix(strings.TrimSpace(l), a) {
+				i = n
+			}
+			if strings.HasPrefix(strings.TrimSpace(l), b) {
+				j = n
+			}
+		}
+		li := strings.TrimPrefix(strings.TrimSpace(lines[i]), a)
+		lj := strings.TrimPrefix(strings.TrimSpace(lines[j]), b)
+		lines[i] = strings.Replace(lines[i], li, lj, 1)
+		lines[j] = strings.Replace(lines[j], lj, li, 1)
+		return strings.Join(lines, "\n")
+	}
+
+	tests := []struct {
+		name    string
+		doc     string
+		ids     []age.Identity
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{"yaml", yamlDoc, ids, want, ""},
+		{"json", jsonDoc, ids, wantJSON, ""},
+		{"mac_only_encrypted", partialDoc, ids, wantPartial, ""},
+		{"swapped_values", swap(yamlDoc, "user:", "password:"), ids, nil,
+			"db.user: failed to decrypt value"},
+		{"modified_unencrypted", strings.Replace(yamlDoc, ": plain", ": changed", 1), ids,
+			nil, "MAC mismatch"},
+		{"removed_null", strings.Replace(yamlDoc, "    replica: null\n", "", 1), ids,
+			withoutReplica, ""},
+		{"removed_encrypted", strings.Replace(partialDoc, "    password:", "    #password:", 1),
+			ids, nil, "MAC mismatch"},
+		{"other_identity", yamlDoc, []age.Identity{other}, nil, "no identity matched"},
+		{"not_sops", "a: b\n", ids, nil, "not a SOPS document"},
+		{"no_age", "a: b\nsops:\n    mac: x\n    kms: []\n", ids, nil,
+			"no age recipients"},
+		{"comment_regex", strings.Replace(yamlDoc, "    unencrypted_suffix:",
+			"    encrypted_comment_regex: sops:enc\n    unencrypted_suffix:", 1), ids, nil,
+			"encrypted_comment_regex is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sopsDecrypt([]byte(tt.doc), tt.ids)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecryptFuncs(t *testing.T) {
+	t.Parallel()
+	st := NewStore()
+	secret, err := idep.NewKVGetQuery("app/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Save(secret.String(), string(testDecryptFile(t, "secret.txt.age.asc")))
+	secrets, err := idep.NewKVGetQuery("app/secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Save(secrets.String(), string(testDecryptFile(t, "secrets.enc.yaml")))
+	broken, err := idep.NewKVGetQuery("app/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Save(broken.String(), "not encrypted")
+
+	execute := func(contents, keyFile string) (string, error) {
+		tpl := NewTemplate(TemplateInput{Contents: contents, DecryptKeyFile: keyFile})
+		res, err := tpl.Execute(st)
+		if err != nil {
+			return "", err
+		}
+		return string(res.Output), nil
+	}
+
+	t.Run("decrypt", func(t *testing.T) {
+		out, err := execute(`{{ key "app/secret" | decryptAge }} `+
+			`{{ with key "app/secrets" | decryptSOPS }}{{ .db.password }} `+
+			`{{ range .hosts }}{{ . }},{{ end }}{{ end }}`, testDecryptKeyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "s3cr3t s3cr3t a.example.com,b.example.com,map[empty:<nil> nested:[1 [x y]]],"
+		if out != want {
+			t.Errorf("got %q, want %q", out, want)
+		}
+	})
+	t.Run("missing_value", func(t *testing.T) {
+		out, err := execute(`{{ key "app/missing" | decryptAge }}`+
+			`{{ key "app/missing" | decryptSOPS | len }}`, testDecryptKeyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "0" {
+			t.Errorf("got %q", out)
+		}
+	})
+	t.Run("error_dependency", func(t *testing.T) {
+		_, err := execute(`{{ key "app/secret" }}{{ key "app/broken" | decryptAge }}`,
+			testDecryptKeyFile)
+		var de *DecryptError
+		if !errors.As(err, &de) {
+			t.Fatalf("expected a DecryptError, got %v", err)
+		}
+		if de.Dependency == nil || de.Dependency.String() != broken.String() {
+			t.Errorf("expected the dependency %s, got %v", broken, de.Dependency)
+		}
+		if !strings.Contains(err.Error(), broken.String()+": decryptAge: ") {
+			t.Errorf("unexpected error %q", err)
+		}
+	})
+	t.Run("no_key_file", func(t *testing.T) {
+		_, err := execute(`{{ key "app/secret" | decryptAge }}`, "")
+		if err == nil || !strings.Contains(err.Error(), "no decrypt key file configured") {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("missing_key_file", func(t *testing.T) {
+		_, err := execute(`{{ key "app/secret" | decryptAge }}`, "testdata/decrypt/none.txt")
+		if err == nil || !strings.Contains(err.Error(), "key file") {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
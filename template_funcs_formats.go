@@ -0,0 +1,791 @@
+package hcat
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/pkg/errors"
+)
+
+// Parsers and emitters for structured data formats, so values can be
+// converted to what the target application needs. The emitters sort map
+// keys, so the output is the same for the same data.
+
+// parseTOML returns a structure for valid TOML
+func parseTOML(s string) (interface{}, error) {
+	data := map[string]interface{}{}
+	if s == "" {
+		return data, nil
+	}
+
+	if _, err := toml.Decode(s, &data); err != nil {
+		return nil, errors.Wrap(err, "parseTOML")
+	}
+	return data, nil
+}
+
+// parseHCL returns a structure for valid HCL (v1). Blocks become maps, with
+// their labels as nested keys. Repeated keys become lists.
+//
+// 		service "web" { port = 80 }
+// 		service "db" { port = 5432 }
+//
+// yields map[service:map[db:map[port:5432] web:map[port:80]]]
+func parseHCL(s string) (interface{}, error) {
+	if s == "" {
+		return map[string]interface{}{}, nil
+	}
+
+	f, err := hcl.Parse(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseHCL")
+	}
+	list, ok := f.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("parseHCL: unexpected root %T", f.Node)
+	}
+	m, err := hclObject(list)
+	if err != nil {
+		return nil, errors.Wrap(err, "parseHCL")
+	}
+	return m, nil
+}
+
+// hclRepeated is a list of the values of a repeated key, as opposed to a
+// list value.
+type hclRepeated []interface{}
+
+func hclObject(list *ast.ObjectList) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	for _, item := range list.Items {
+		v, err := hclValue(item.Val)
+		if err != nil {
+			return nil, err
+		}
+
+		// labels are nested keys
+		dst := m
+		for _, k := range item.Keys[:len(item.Keys)-1] {
+			key := hclKey(k)
+			switch next := dst[key].(type) {
+			case nil:
+				nm := make(map[string]interface{})
+				dst[key], dst = nm, nm
+			case map[string]interface{}:
+				dst = next
+			default:
+				return nil, fmt.Errorf("%s: key %q is both a value and a block",
+					k.Pos(), key)
+			}
+		}
+		key := hclKey(item.Keys[len(item.Keys)-1])
+		switch existing := dst[key].(type) {
+		case nil:
+			dst[key] = v
+		case hclRepeated:
+			dst[key] = append(existing, v)
+		default:
+			dst[key] = hclRepeated{existing, v}
+		}
+	}
+	return hclFinish(m).(map[string]interface{}), nil
+}
+
+// hclFinish replaces the repeated keys' values with lists.
+func hclFinish(v interface{}) interface{} {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		for k, e := range typed {
+			typed[k] = hclFinish(e)
+		}
+	case hclRepeated:
+		return hclFinish([]interface{}(typed))
+	case []interface{}:
+		for i, e := range typed {
+			typed[i] = hclFinish(e)
+		}
+	}
+	return v
+}
+
+func hclKey(k *ast.ObjectKey) string {
+	if s, ok := k.Token.Value().(string); ok {
+		return s
+	}
+	return k.Token.Text
+}
+
+func hclValue(n ast.Node) (interface{}, error) {
+	switch typed := n.(type) {
+	case *ast.LiteralType:
+		return typed.Token.Value(), nil
+	case *ast.ListType:
+		l := make([]interface{}, 0, len(typed.List))
+		for _, e := range typed.List {
+			v, err := hclValue(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		return l, nil
+	case *ast.ObjectType:
+		return hclObject(typed.List)
+	default:
+		return nil, fmt.Errorf("%s: unexpected %T", n.Pos(), n)
+	}
+}
+
+// toHCL converts the given structure into an HCL (v1) string. Maps become
+// blocks and lists of maps become repeated blocks.
+func toHCL(m map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := writeHCLBody(&buf, m, ""); err != nil {
+		return "", errors.Wrap(err, "toHCL")
+	}
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+var hclIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func hclKeyString(k string) string {
+	if hclIdentRe.MatchString(k) && k != "true" && k != "false" {
+		return k
+	}
+	return strconv.Quote(k)
+}
+
+func writeHCLBody(buf *bytes.Buffer, m interface{}, indent string) error {
+	mv, _ := stringMap(m)
+	for _, k := range sortedDataKeys(mv) {
+		v := mv[k]
+		key := hclKeyString(k)
+		if block, ok := stringMap(v); ok {
+			fmt.Fprintf(buf, "%s%s {\n", indent, key)
+			if err := writeHCLBody(buf, block, indent+"  "); err != nil {
+				return err
+			}
+			fmt.Fprintf(buf, "%s}\n", indent)
+			continue
+		}
+		if blocks, ok := mapList(v); ok {
+			for _, block := range blocks {
+				fmt.Fprintf(buf, "%s%s {\n", indent, key)
+				if err := writeHCLBody(buf, block, indent+"  "); err != nil {
+					return err
+				}
+				fmt.Fprintf(buf, "%s}\n", indent)
+			}
+			continue
+		}
+		s, err := hclValueString(k, v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "%s%s = %s\n", indent, key, s)
+	}
+	return nil
+}
+
+func hclValueString(key string, v interface{}) (string, error) {
+	if m, ok := stringMap(v); ok {
+		parts := make([]string, 0, len(m))
+		for _, k := range sortedDataKeys(m) {
+			s, err := hclValueString(k, m[k])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, hclKeyString(k)+" = "+s)
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			s, err := hclValueString(key, rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+	if v == nil {
+		return "", fmt.Errorf("unsupported null value for %q", key)
+	}
+	s, err := scalarString(key, v)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := v.(string); ok {
+		return strconv.Quote(s), nil
+	}
+	if _, ok := v.(time.Time); ok {
+		return strconv.Quote(s), nil
+	}
+	return s, nil
+}
+
+// parseINI returns a structure for an INI file. Keys before the first
+// section are at the top level and sections are maps. Values are strings,
+// with their surrounding quotes removed. Lines starting with ";" or "#" are
+// comments.
+func parseINI(s string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	dst := m
+	for i, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", line[0] == ';', line[0] == '#':
+			continue
+		case line[0] == '[':
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("parseINI: line %d: unterminated section", i+1)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			section, ok := m[name].(map[string]interface{})
+			if !ok {
+				if _, exists := m[name]; exists {
+					return nil, fmt.Errorf("parseINI: line %d: section %q is also a key",
+						i+1, name)
+				}
+				section = make(map[string]interface{})
+				m[name] = section
+			}
+			dst = section
+			continue
+		}
+
+		key, value := line, ""
+		if idx := strings.IndexAny(line, "=:"); idx >= 0 {
+			key = strings.TrimSpace(line[:idx])
+			value = unquoteValue(strings.TrimSpace(line[idx+1:]))
+		}
+		if key == "" {
+			return nil, fmt.Errorf("parseINI: line %d: missing key", i+1)
+		}
+		if _, ok := dst[key].(map[string]interface{}); ok {
+			return nil, fmt.Errorf("parseINI: line %d: key %q is also a section",
+				i+1, key)
+		}
+		dst[key] = value
+	}
+	return m, nil
+}
+
+// unquoteValue removes the quotes around a value, unescaping double quoted
+// values.
+func unquoteValue(v string) string {
+	if len(v) < 2 || v[0] != v[len(v)-1] {
+		return v
+	}
+	switch v[0] {
+	case '"':
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+		return v[1 : len(v)-1]
+	case '\'':
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// toINI converts the given structure into an INI string. Top level maps
+// become sections, which can't be nested.
+func toINI(m map[string]interface{}) (string, error) {
+	var top, sections bytes.Buffer
+	for _, k := range sortedDataKeys(m) {
+		section, ok := stringMap(m[k])
+		if !ok {
+			if err := writeINIKey(&top, k, m[k]); err != nil {
+				return "", errors.Wrap(err, "toINI")
+			}
+			continue
+		}
+		fmt.Fprintf(&sections, "\n[%s]\n", k)
+		for _, sk := range sortedDataKeys(section) {
+			if err := writeINIKey(&sections, sk, section[sk]); err != nil {
+				return "", errors.Wrapf(err, "toINI: [%s]", k)
+			}
+		}
+	}
+	top.Write(sections.Bytes())
+	return string(bytes.TrimSpace(top.Bytes())), nil
+}
+
+func writeINIKey(buf *bytes.Buffer, k string, v interface{}) error {
+	if strings.ContainsAny(k, "=:[]\n") {
+		return fmt.Errorf("invalid key %q", k)
+	}
+	s, err := scalarString(k, v)
+	if err != nil {
+		return err
+	}
+	if s != strings.TrimSpace(s) || strings.ContainsAny(s, "\"'\n\r") {
+		s = strconv.Quote(s)
+	}
+	fmt.Fprintf(buf, "%s = %s\n", k, s)
+	return nil
+}
+
+// parseProperties returns a structure for a Java .properties file. Keys are
+// not split on dots, so "a.b=c" yields map[a.b:c].
+func parseProperties(s string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		// lines ending with an odd number of backslashes continue
+		for trailingBackslashes(line)%2 == 1 && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		// the key ends at the first unescaped separator or whitespace
+		end := len(line)
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", line[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+		key, rest := line[:end], strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+
+		k, err := unescapeProperty(key)
+		if err != nil {
+			return nil, fmt.Errorf("parseProperties: line %d: %s", i+1, err)
+		}
+		v, err := unescapeProperty(rest)
+		if err != nil {
+			return nil, fmt.Errorf("parseProperties: line %d: %s", i+1, err)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+func trailingBackslashes(s string) int {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid unicode escape %q", s[i-1:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape %q", s[i-1:i+5])
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// toProperties converts the given structure into a Java .properties string.
+// Nested maps are flattened, joining their keys with dots.
+func toProperties(m map[string]interface{}) (string, error) {
+	flat := make(map[string]interface{})
+	if err := flattenMap(flat, "", m); err != nil {
+		return "", errors.Wrap(err, "toProperties")
+	}
+
+	var buf bytes.Buffer
+	for _, k := range sortedDataKeys(flat) {
+		s, err := scalarString(k, flat[k])
+		if err != nil {
+			return "", errors.Wrap(err, "toProperties")
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", escapeProperty(k, true), escapeProperty(s, false))
+	}
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+func flattenMap(dst map[string]interface{}, prefix string, m map[string]interface{}) error {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if nested, ok := stringMap(v); ok {
+			if err := flattenMap(dst, k, nested); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := dst[k]; ok {
+			return fmt.Errorf("duplicate key %q", k)
+		}
+		dst[k] = v
+	}
+	return nil
+}
+
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!', ' ':
+			// separators only need escaping in keys, and a leading space
+			// in values
+			if key || (i == 0 && r == ' ') {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parseCSV returns a list of maps for CSV with a header row, keyed by the
+// header's column names.
+func parseCSV(s string) ([]interface{}, error) {
+	records, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "parseCSV")
+	}
+	if len(records) == 0 {
+		return []interface{}{}, nil
+	}
+
+	header := records[0]
+	seen := make(map[string]bool, len(header))
+	for _, h := range header {
+		if seen[h] {
+			return nil, fmt.Errorf("parseCSV: duplicate column %q", h)
+		}
+		seen[h] = true
+	}
+	rows := make([]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, h := range header {
+			row[h] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// toCSV converts a list of maps or lists into a CSV string. For maps, the
+// header row has their sorted keys. Lists are written as they are.
+func toCSV(rows interface{}) (string, error) {
+	items, err := listItems("toCSV", rows)
+	if err != nil {
+		return "", err
+	}
+
+	var header []string
+	if len(items) > 0 {
+		if _, ok := stringMap(items[0]); ok {
+			cols := make(map[string]interface{})
+			for i, item := range items {
+				m, ok := stringMap(item)
+				if !ok {
+					return "", fmt.Errorf("toCSV: row %d is %T, not a map", i, item)
+				}
+				for k := range m {
+					cols[k] = nil
+				}
+			}
+			header = sortedDataKeys(cols)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if header != nil {
+		w.Write(header)
+	}
+	for i, item := range items {
+		var record []string
+		if header != nil {
+			m, _ := stringMap(item)
+			record = make([]string, len(header))
+			for j, h := range header {
+				if record[j], err = scalarString(h, m[h]); err != nil {
+					return "", errors.Wrap(err, "toCSV")
+				}
+			}
+		} else {
+			fields, err := listItems("toCSV", item)
+			if err != nil {
+				return "", fmt.Errorf("toCSV: row %d is %T, not a list", i, item)
+			}
+			record = make([]string, len(fields))
+			for j, f := range fields {
+				if record[j], err = scalarString(strconv.Itoa(j), f); err != nil {
+					return "", errors.Wrap(err, "toCSV")
+				}
+			}
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", errors.Wrap(err, "toCSV")
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+// parseDotenv returns a structure for a dotenv file of KEY=value lines,
+// optionally prefixed with "export". Double quoted values are unescaped and
+// single quoted values are literal, both can span lines. Unquoted values end
+// at a " #" comment.
+func parseDotenv(s string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		idx := strings.IndexByte(line, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("parseDotenv: line %d: expected KEY=value", lineNum)
+		}
+		key := strings.TrimSpace(line[:idx])
+		if !dotenvKeyRe.MatchString(key) {
+			return nil, fmt.Errorf("parseDotenv: line %d: invalid key %q", lineNum, key)
+		}
+		value := strings.TrimSpace(line[idx+1:])
+
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			if c := strings.Index(value, " #"); c >= 0 {
+				value = strings.TrimSpace(value[:c])
+			}
+			m[key] = value
+			continue
+		}
+
+		// quoted values continue until the closing quote
+		quote := value[0]
+		value = value[1:]
+		end := closingQuote(value, quote)
+		for end < 0 && i+1 < len(lines) {
+			i++
+			value += "\n" + lines[i]
+			end = closingQuote(value, quote)
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("parseDotenv: line %d: unterminated quoted value", lineNum)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && rest[0] != '#' {
+			return nil, fmt.Errorf("parseDotenv: line %d: unexpected %q after quoted value",
+				lineNum, rest)
+		}
+		value = value[:end]
+		if quote == '"' {
+			value = unescapeDotenv(value)
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+var dotenvKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// closingQuote returns the index of the closing quote, or -1. Double quotes
+// can be escaped.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$', '`':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+var dotenvPlainRe = regexp.MustCompile(`^[A-Za-z0-9_./:@,+-]*$`)
+
+// toDotenv converts the given map into a dotenv string. Values that aren't
+// plain are double quoted.
+func toDotenv(m map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	for _, k := range sortedDataKeys(m) {
+		if !dotenvKeyRe.MatchString(k) {
+			return "", fmt.Errorf("toDotenv: invalid key %q", k)
+		}
+		s, err := scalarString(k, m[k])
+		if err != nil {
+			return "", errors.Wrap(err, "toDotenv")
+		}
+		if !dotenvPlainRe.MatchString(s) {
+			s = `"` + strings.NewReplacer(
+				`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`",
+				"\n", `\n`, "\r", `\r`, "\t", `\t`,
+			).Replace(s) + `"`
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", k, s)
+	}
+	return string(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// stringMap returns a map keyed by strings. Maps with other key types, such
+// as those from parseYAML, have their keys formatted as strings.
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map {
+		return nil, false
+	}
+	m := make(map[string]interface{}, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+	}
+	return m, true
+}
+
+// mapList returns the list's maps if it is a non-empty list of maps.
+func mapList(v interface{}) ([]map[string]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Len() == 0 {
+		return nil, false
+	}
+	l := make([]map[string]interface{}, rv.Len())
+	for i := range l {
+		m, ok := stringMap(rv.Index(i).Interface())
+		if !ok {
+			return nil, false
+		}
+		l[i] = m
+	}
+	return l, true
+}
+
+func sortedDataKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scalarString formats a string, bool, number or time. Nil is empty.
+func scalarString(key string, v interface{}) (string, error) {
+	switch typed := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return typed, nil
+	case []byte:
+		if utf8.Valid(typed) {
+			return string(typed), nil
+		}
+	case time.Time:
+		return typed.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return typed.String(), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.String:
+		return rv.String(), nil
+	}
+	return "", fmt.Errorf("unsupported value for %q (%T)", key, v)
+}
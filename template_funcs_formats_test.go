@@ -0,0 +1,303 @@
+package hcat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		fn      func(string) (interface{}, error)
+		in      string
+		want    interface{}
+		wantErr bool
+	}{
+		{"toml", parseTOMLIface, "a = 1\n[b]\nc = \"d\"",
+			map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": "d"}}, false},
+		{"toml_empty", parseTOMLIface, "", map[string]interface{}{}, false},
+		{"toml_invalid", parseTOMLIface, "a = ", nil, true},
+		{"hcl", parseHCL, `
+a = 1
+b = "two"
+c = [1, "x"]
+d {
+  e = true
+}
+service "web" { port = 80 }
+service "db" { port = 5432 }
+`, map[string]interface{}{
+			"a": int64(1),
+			"b": "two",
+			"c": []interface{}{int64(1), "x"},
+			"d": map[string]interface{}{"e": true},
+			"service": map[string]interface{}{
+				"web": map[string]interface{}{"port": int64(80)},
+				"db":  map[string]interface{}{"port": int64(5432)},
+			},
+		}, false},
+		{"hcl_repeated", parseHCL, "a { x = 1 }\na { x = 2 }\na { x = 3 }",
+			map[string]interface{}{"a": []interface{}{
+				map[string]interface{}{"x": int64(1)},
+				map[string]interface{}{"x": int64(2)},
+				map[string]interface{}{"x": int64(3)},
+			}}, false},
+		{"hcl_json", parseHCL, `{"a": {"b": 1.5}}`,
+			map[string]interface{}{"a": map[string]interface{}{"b": 1.5}}, false},
+		{"hcl_empty", parseHCL, "", map[string]interface{}{}, false},
+		{"hcl_invalid", parseHCL, "a {", nil, true},
+		{"hcl_conflict", parseHCL, "a = 1\na \"b\" {}", nil, true},
+		{"ini", parseINIIface, `
+; comment
+top = 1
+[server]
+host = example.com
+port: 8080
+# comment
+name = "quoted \"value\""
+flag
+[empty]
+`, map[string]interface{}{
+			"top": "1",
+			"server": map[string]interface{}{
+				"host": "example.com",
+				"port": "8080",
+				"name": `quoted "value"`,
+				"flag": "",
+			},
+			"empty": map[string]interface{}{},
+		}, false},
+		{"ini_unterminated", parseINIIface, "[server", nil, true},
+		{"ini_conflict", parseINIIface, "a = 1\n[a]", nil, true},
+		{"properties", parsePropertiesIface, `
+# comment
+! comment
+a.b = c
+key:value
+spaced value with spaces
+multi = one, \
+        two
+escaped\ key = tab\thereé
+empty
+`, map[string]interface{}{
+			"a.b":         "c",
+			"key":         "value",
+			"spaced":      "value with spaces",
+			"multi":       "one, two",
+			"escaped key": "tab\thereé",
+			"empty":       "",
+		}, false},
+		{"properties_bad_unicode", parsePropertiesIface, `a = \u12`, nil, true},
+		{"csv", parseCSVIface, "name,port\nweb,80\ndb,5432",
+			[]interface{}{
+				map[string]interface{}{"name": "web", "port": "80"},
+				map[string]interface{}{"name": "db", "port": "5432"},
+			}, false},
+		{"csv_empty", parseCSVIface, "", []interface{}{}, false},
+		{"csv_ragged", parseCSVIface, "a,b\n1", nil, true},
+		{"csv_duplicate_column", parseCSVIface, "a,a\n1,2", nil, true},
+		{"dotenv", parseDotenvIface, `
+# comment
+A=1
+export B = two
+C="line\nbreak \"quoted\" \$HOME" # comment
+D='literal \n $HOME'
+E=value # comment
+F="multi
+line"
+G=
+`, map[string]interface{}{
+			"A": "1",
+			"B": "two",
+			"C": "line\nbreak \"quoted\" $HOME",
+			"D": `literal \n $HOME`,
+			"E": "value",
+			"F": "multi\nline",
+			"G": "",
+		}, false},
+		{"dotenv_no_equals", parseDotenvIface, "A", nil, true},
+		{"dotenv_bad_key", parseDotenvIface, "1A=b", nil, true},
+		{"dotenv_unterminated", parseDotenvIface, `A="b`, nil, true},
+		{"dotenv_trailing", parseDotenvIface, `A="b" c`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fn(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmitFormats(t *testing.T) {
+	t.Parallel()
+	data := map[string]interface{}{
+		"name":  "web app",
+		"port":  float64(8080),
+		"debug": false,
+		"db": map[string]interface{}{
+			"host": "db.local",
+			"pass": `p"a$s`,
+		},
+	}
+	tests := []struct {
+		name    string
+		fn      func(interface{}) (string, error)
+		in      interface{}
+		want    string
+		wantErr bool
+	}{
+		{"hcl", toHCLIface, map[string]interface{}{
+			"a":    "b",
+			"list": []interface{}{1, "x"},
+			"svc": []interface{}{
+				map[string]interface{}{"port": 80},
+				map[string]interface{}{"port": 81},
+			},
+			"nested": map[interface{}]interface{}{"x": map[string]interface{}{"y": true}},
+			"odd key": []interface{}{map[string]interface{}{"z": 1}, 2},
+		}, `a = "b"
+list = [1, "x"]
+nested {
+  x {
+    y = true
+  }
+}
+"odd key" = [{ z = 1 }, 2]
+svc {
+  port = 80
+}
+svc {
+  port = 81
+}`, false},
+		{"hcl_null", toHCLIface, map[string]interface{}{"a": nil}, "", true},
+		{"ini", toINIIface, data, `debug = false
+name = web app
+port = 8080
+
+[db]
+host = db.local
+pass = "p\"a$s"`, false},
+		{"ini_nested_section", toINIIface, map[string]interface{}{
+			"a": map[string]interface{}{"b": map[string]interface{}{}},
+		}, "", true},
+		{"properties", toPropertiesIface, map[string]interface{}{
+			"a":     map[string]interface{}{"b": map[string]interface{}{"c": 1}},
+			"key=":  " leading",
+			"multi": "one\ntwo",
+		}, `a.b.c=1
+key\==\ leading
+multi=one\ntwo`, false},
+		{"properties_list", toPropertiesIface, map[string]interface{}{"a": []int{1}}, "", true},
+		{"properties_duplicate", toPropertiesIface, map[string]interface{}{
+			"a.b": 1,
+			"a":   map[string]interface{}{"b": 2},
+		}, "", true},
+		{"csv_maps", toCSV, []interface{}{
+			map[string]interface{}{"name": "web", "port": 80},
+			map[string]interface{}{"name": "db, primary", "tag": nil},
+		}, "name,port,tag\nweb,80,\n\"db, primary\",,", false},
+		{"csv_lists", toCSV, [][]string{{"a", "b"}, {"c", "d"}}, "a,b\nc,d", false},
+		{"csv_nil", toCSV, nil, "", false},
+		{"csv_mixed", toCSV, []interface{}{map[string]interface{}{}, []string{}}, "", true},
+		{"dotenv_nested", toDotenvIface, data, "", true},
+		{"dotenv_flat", toDotenvIface, map[string]interface{}{
+			"A":   "plain/value:1",
+			"B":   "with space",
+			"C":   "q\"$x\n",
+			"D_1": 1.5,
+		}, `A=plain/value:1
+B="with space"
+C="q\"\$x\n"
+D_1=1.5`, false},
+		{"dotenv_bad_key", toDotenvIface, map[string]interface{}{"a-b": "c"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fn(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	t.Parallel()
+	flat := map[string]interface{}{
+		"A": "plain",
+		"B": "with space",
+		"C": "q\"$x\n\ttab",
+		"D": " leading=:#!\\",
+	}
+	tests := []struct {
+		name  string
+		emit  func(interface{}) (string, error)
+		parse func(string) (interface{}, error)
+		in    interface{}
+	}{
+		{"hcl", toHCLIface, parseHCL, map[string]interface{}{
+			"a": "b\n\"c\"",
+			"d": map[string]interface{}{"e": []interface{}{true, 1.5}},
+			"f": []interface{}{
+				map[string]interface{}{"g": "h"},
+				map[string]interface{}{"g": "i"},
+			},
+		}},
+		{"ini", toINIIface, parseINIIface, map[string]interface{}{
+			"top": "1",
+			"s":   flat,
+		}},
+		{"properties", toPropertiesIface, parsePropertiesIface, flat},
+		{"dotenv", toDotenvIface, parseDotenvIface, flat},
+		{"csv", toCSV, parseCSVIface, []interface{}{flat, flat}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.emit(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.parse(s)
+			if err != nil {
+				t.Fatalf("%s\n%s", err, s)
+			}
+			if !reflect.DeepEqual(got, tt.in) {
+				t.Errorf("got %#v, want %#v\n%s", got, tt.in, s)
+			}
+			// the output is the same every time
+			for i := 0; i < 10; i++ {
+				if again, _ := tt.emit(tt.in); again != s {
+					t.Fatalf("output changed:\n%s\n%s", s, again)
+				}
+			}
+		})
+	}
+}
+
+// adapters for the table tests
+
+func parseTOMLIface(s string) (interface{}, error)       { return parseTOML(s) }
+func parseINIIface(s string) (interface{}, error)        { return parseINI(s) }
+func parsePropertiesIface(s string) (interface{}, error) { return parseProperties(s) }
+func parseCSVIface(s string) (interface{}, error)        { return parseCSV(s) }
+func parseDotenvIface(s string) (interface{}, error)     { return parseDotenv(s) }
+
+func toHCLIface(v interface{}) (string, error)        { return toHCL(v.(map[string]interface{})) }
+func toINIIface(v interface{}) (string, error)        { return toINI(v.(map[string]interface{})) }
+func toPropertiesIface(v interface{}) (string, error) { return toProperties(v.(map[string]interface{})) }
+func toDotenvIface(v interface{}) (string, error)     { return toDotenv(v.(map[string]interface{})) }
@@ -0,0 +1,264 @@
+package hcat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/blowfish"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Password hashing and secret derivation functions. They are deterministic,
+// the same arguments always give the same result, so a rendered file only
+// changes when a password or seed does.
+//
+// The password hashes take a seed that the salt is derived from, with the
+// password. It should be unique to the entry, such as the user name, but
+// isn't secret.
+//
+// 		{{ with secret "secret/users/web" }}
+// 		web:{{ .Data.password | bcrypt 10 "web" }}{{ end }}
+//
+// As the hashes are slow to compute by design, the Template memoizes them
+// across executions.
+
+const (
+	// bcryptMaxCost is the highest bcrypt cost allowed, above it a hash
+	// takes seconds to compute.
+	bcryptMaxCost = 16
+
+	// the parameters of scrypt and argon2id hashes, as recommended by their
+	// packages for interactive logins
+	scryptLogN       = 15
+	scryptR          = 8
+	scryptP          = 1
+	argon2Time       = 1
+	argon2Memory     = 64 * 1024
+	argon2Threads    = 4
+	passwordHashSize = 32
+	passwordSaltSize = 16
+)
+
+// bcryptEncoding is the base64 encoding of bcrypt hashes.
+var bcryptEncoding = base64.NewEncoding(
+	"./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").
+	WithPadding(base64.NoPadding)
+
+// bcryptHash returns the bcrypt hash of the password with the cost, as used
+// by htpasswd files.
+//
+// 		{{ "s3cr3t" | bcrypt 10 "web" }} // $2a$10$...
+//
+func bcryptHash(cost int, seed, password string) (string, error) {
+	if cost < bcrypt.MinCost || cost > bcryptMaxCost {
+		return "", fmt.Errorf("bcrypt: cost %d is outside allowed range (%d,%d)",
+			cost, bcrypt.MinCost, bcryptMaxCost)
+	}
+	salt := passwordSalt(seed, password)
+
+	// The key includes the trailing NULL of C strings, for compatibility.
+	key := append([]byte(password), 0)
+	c, err := blowfish.NewSaltedCipher(key, salt)
+	if err != nil {
+		return "", fmt.Errorf("bcrypt: %s", err)
+	}
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		blowfish.ExpandKey(key, c)
+		blowfish.ExpandKey(salt, c)
+	}
+	data := []byte("OrpheanBeholderScryDoubt")
+	for i := 0; i < len(data); i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(data[i:i+8], data[i:i+8])
+		}
+	}
+
+	// Only 23 of the 24 bytes are encoded, for compatibility.
+	return fmt.Sprintf("$2a$%02d$%s%s", cost, bcryptEncoding.EncodeToString(salt),
+		bcryptEncoding.EncodeToString(data[:23])), nil
+}
+
+// scryptHash returns the scrypt hash of the password in the format of
+// passlib.
+//
+// 		{{ "s3cr3t" | scrypt "web" }} // $scrypt$ln=15,r=8,p=1$...
+//
+func scryptHash(seed, password string) (string, error) {
+	salt := passwordSalt(seed, password)
+	key, err := scrypt.Key([]byte(password), salt, 1<<scryptLogN, scryptR, scryptP,
+		passwordHashSize)
+	if err != nil {
+		return "", fmt.Errorf("scrypt: %s", err)
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", scryptLogN, scryptR, scryptP,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// argon2Hash returns the argon2id hash of the password in the PHC string
+// format.
+//
+// 		{{ "s3cr3t" | argon2id "web" }} // $argon2id$v=19$m=65536,t=1,p=4$...
+//
+func argon2Hash(seed, password string) (string, error) {
+	salt := passwordSalt(seed, password)
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory,
+		argon2Threads, passwordHashSize)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// hashCache memoizes a Template's password hashes by their arguments. Only
+// the hashes used since the start of the previous execution are kept, so
+// the hashes of changed passwords don't accumulate. The zero value is ready
+// to use.
+type hashCache struct {
+	mux       sync.Mutex
+	prev, cur map[[sha256.Size]byte]string
+}
+
+// rotate starts a new execution, dropping the hashes unused by the last.
+func (c *hashCache) rotate() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.prev, c.cur = c.cur, nil
+}
+
+// get returns the memoized hash for the arguments, computing it with the
+// function if there is none. The arguments are only kept digested.
+func (c *hashCache) get(hash func() (string, error), args ...string) (string, error) {
+	h := sha256.New()
+	for _, a := range args {
+		// length prefixed so the arguments can't run into each other
+		binary.Write(h, binary.BigEndian, uint64(len(a)))
+		io.WriteString(h, a)
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+
+	c.mux.Lock()
+	if v, ok := c.cur[key]; ok {
+		c.mux.Unlock()
+		return v, nil
+	}
+	v, ok := c.prev[key]
+	c.mux.Unlock()
+
+	if !ok {
+		var err error
+		if v, err = hash(); err != nil {
+			return "", err
+		}
+	}
+	c.mux.Lock()
+	if c.cur == nil {
+		c.cur = make(map[[sha256.Size]byte]string)
+	}
+	c.cur[key] = v
+	c.mux.Unlock()
+	return v, nil
+}
+
+// bcryptFunc returns bcryptHash memoized by the cache.
+func bcryptFunc(c *hashCache) func(int, string, string) (string, error) {
+	return func(cost int, seed, password string) (string, error) {
+		return c.get(func() (string, error) {
+			return bcryptHash(cost, seed, password)
+		}, "bcrypt", strconv.Itoa(cost), seed, password)
+	}
+}
+
+// scryptFunc returns scryptHash memoized by the cache.
+func scryptFunc(c *hashCache) func(string, string) (string, error) {
+	return func(seed, password string) (string, error) {
+		return c.get(func() (string, error) {
+			return scryptHash(seed, password)
+		}, "scrypt", seed, password)
+	}
+}
+
+// argon2Func returns argon2Hash memoized by the cache.
+func argon2Func(c *hashCache) func(string, string) (string, error) {
+	return func(seed, password string) (string, error) {
+		return c.get(func() (string, error) {
+			return argon2Hash(seed, password)
+		}, "argon2id", seed, password)
+	}
+}
+
+// hmacSHA256Hex returns the hex of the HMAC-SHA256 of the message with the
+// key.
+//
+// 		{{ .Data.body | hmacSHA256Hex .Data.key }}
+//
+func hmacSHA256Hex(key, message string) (string, error) {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(message))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// deriveKey derives a key of the length in bytes from the secret with
+// HKDF-SHA256, for the purpose named by the info, and returns it in base64.
+// Different infos give unrelated keys, so one secret can seed many.
+//
+// 		{{ .Data.seed | deriveKey 32 "cookie-secret" }}
+//
+func deriveKey(length int, info, secret string) (string, error) {
+	if length <= 0 || length > 255*sha256.Size {
+		return "", fmt.Errorf("deriveKey: invalid length %d", length)
+	}
+	key := make([]byte, length)
+	r := hkdf.New(sha256.New, []byte(secret), nil, []byte(info))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return "", fmt.Errorf("deriveKey: %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// derivePassword derives a password of the length in letters and digits from
+// the secret with HKDF-SHA256, for the purpose named by the info.
+//
+// 		{{ .Data.seed | derivePassword 24 "postgres/app" }}
+//
+func derivePassword(length int, info, secret string) (string, error) {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	// HKDF output is limited, this leaves room for the rejected bytes
+	if length <= 0 || length > 1024 {
+		return "", fmt.Errorf("derivePassword: invalid length %d", length)
+	}
+	r := hkdf.New(sha256.New, []byte(secret), nil, []byte(info))
+	result := make([]byte, 0, length)
+	buf := make([]byte, 1)
+	for len(result) < length {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", fmt.Errorf("derivePassword: %s", err)
+		}
+		// reject the bytes past the last whole multiple of the number of
+		// chars so each char is equally likely
+		if int(buf[0]) >= 256-256%len(chars) {
+			continue
+		}
+		result = append(result, chars[int(buf[0])%len(chars)])
+	}
+	return string(result), nil
+}
+
+// passwordSalt derives the salt of a password hash from the seed and the
+// password.
+func passwordSalt(seed, password string) []byte {
+	h := hmac.New(sha256.New, []byte(seed))
+	h.Write([]byte(password))
+	return h.Sum(nil)[:passwordSaltSize]
+}
@@ -0,0 +1,221 @@
+package hcat
+
+import (
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestPasswordHashFuncs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		hash   func(seed, password string) (string, error)
+		prefix string
+		// verify checks the hash against the password with the algorithm's
+		// own implementation
+		verify func(t *testing.T, hash, password string)
+	}{
+		{"bcrypt", func(seed, password string) (string, error) {
+			return bcryptHash(bcrypt.MinCost, seed, password)
+		}, "$2a$04$", func(t *testing.T, hash, password string) {
+			if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+				t.Error(err)
+			}
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password+"x")) == nil {
+				t.Error("expected the wrong password not to match")
+			}
+		}},
+		{"scrypt", scryptHash, "$scrypt$ln=15,r=8,p=1$",
+			func(t *testing.T, hash, password string) {
+				salt, key := phcSaltKey(t, hash)
+				want, err := scrypt.Key([]byte(password), salt, 1<<15, 8, 1, len(key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(want) != string(key) {
+					t.Error("hash does not match password")
+				}
+			}},
+		{"argon2id", argon2Hash, "$argon2id$v=19$m=65536,t=1,p=4$",
+			func(t *testing.T, hash, password string) {
+				salt, key := phcSaltKey(t, hash)
+				want := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, uint32(len(key)))
+				if string(want) != string(key) {
+					t.Error("hash does not match password")
+				}
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hash("web", "s3cr3t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("expected prefix %q, got %q", tt.prefix, hash)
+			}
+			tt.verify(t, hash, "s3cr3t")
+
+			again, _ := tt.hash("web", "s3cr3t")
+			if again != hash {
+				t.Errorf("expected the same hash, got %q and %q", hash, again)
+			}
+			other, _ := tt.hash("db", "s3cr3t")
+			if other == hash {
+				t.Error("expected a different hash for a different seed")
+			}
+			empty, err := tt.hash("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.verify(t, empty, "")
+		})
+	}
+
+	t.Run("bcrypt_bad_cost", func(t *testing.T) {
+		if _, err := bcryptHash(3, "web", "s3cr3t"); err == nil {
+			t.Error("expected an error")
+		}
+		if _, err := bcryptHash(bcryptMaxCost+1, "web", "s3cr3t"); err == nil {
+			t.Error("expected an error above the max cost")
+		}
+	})
+}
+
+func TestHashCache(t *testing.T) {
+	var c hashCache
+	calls := 0
+	hash := func(args ...string) string {
+		v, err := c.get(func() (string, error) {
+			calls++
+			return strings.Join(args, ","), nil
+		}, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	hash("a", "bc")
+	if v := hash("a", "bc"); v != "a,bc" || calls != 1 {
+		t.Fatalf("expected a memoized hash, got %q after %d calls", v, calls)
+	}
+	// the arguments are length prefixed
+	hash("ab", "c")
+	if calls != 2 {
+		t.Fatalf("expected different arguments to be hashed, %d calls", calls)
+	}
+
+	// kept while used by the last execution
+	c.rotate()
+	hash("a", "bc")
+	c.rotate()
+	hash("a", "bc")
+	if calls != 2 {
+		t.Fatalf("expected a memoized hash across executions, %d calls", calls)
+	}
+	// unused ones are dropped
+	c.rotate()
+	hash("ab", "c")
+	if calls != 3 {
+		t.Fatalf("expected an unused hash to be dropped, %d calls", calls)
+	}
+
+	// errors aren't memoized
+	fail := func() (string, error) { calls++; return "", errors.New("fail") }
+	c.get(fail, "x")
+	if _, err := c.get(fail, "x"); err == nil || calls != 5 {
+		t.Fatalf("expected errors not memoized, %v after %d calls", err, calls)
+	}
+
+	// templates memoize their hash functions
+	tmpl := NewTemplate(TemplateInput{Contents: `{{ "s3cr3t" | bcrypt 4 "web" }}`})
+	for i := 0; i < 2; i++ {
+		if _, err := tmpl.Execute(NewStore()); err != nil {
+			t.Fatal(err)
+		}
+		if len(tmpl.hashes.cur) != 1 {
+			t.Fatalf("expected 1 memoized hash, got %d", len(tmpl.hashes.cur))
+		}
+	}
+}
+
+// phcSaltKey returns the salt and key of a hash in the PHC string format.
+func phcSaltKey(t *testing.T, hash string) ([]byte, []byte) {
+	t.Helper()
+	parts := strings.Split(hash, "$")
+	salt, err := base64.RawStdEncoding.DecodeString(parts[len(parts)-2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[len(parts)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return salt, key
+}
+
+func TestDerivationFuncs(t *testing.T) {
+	t.Parallel()
+	t.Run("hmacSHA256Hex", func(t *testing.T) {
+		// RFC 4231 test case 2
+		got, err := hmacSHA256Hex("Jefe", "what do ya want for nothing?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("deriveKey", func(t *testing.T) {
+		// RFC 5869 test case 3, without salt and info
+		secret := strings.Repeat("\x0b", 22)
+		got, err := deriveKey(42, "", secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "jaTndaVjwY9xX4AqBjxaMbihH1xe4Yeew0VOXzxzjS2dIBOV+qS2GpbI"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		other, _ := deriveKey(42, "other", secret)
+		if other == got {
+			t.Error("expected a different key for a different info")
+		}
+		if _, err := deriveKey(0, "", secret); err == nil {
+			t.Error("expected an error")
+		}
+	})
+	t.Run("derivePassword", func(t *testing.T) {
+		got, err := derivePassword(300, "postgres/app", "seed")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`^[A-Za-z0-9]{300}$`).MatchString(got) {
+			t.Errorf("unexpected password %q", got)
+		}
+		again, _ := derivePassword(300, "postgres/app", "seed")
+		if again != got {
+			t.Error("expected the same password")
+		}
+		short, _ := derivePassword(12, "postgres/app", "seed")
+		if short != got[:12] {
+			t.Errorf("expected a prefix of the longer password, got %q", short)
+		}
+		other, _ := derivePassword(12, "postgres/admin", "seed")
+		if other == short {
+			t.Error("expected a different password for a different info")
+		}
+		if _, err := derivePassword(-1, "", "seed"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,295 @@
+package hcat
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Network functions for IP addresses and CIDR prefixes, such as the
+// addresses of services and nodes. They take the address or prefix last so
+// they can be piped:
+//
+// 		{{ "10.0.0.0/16" | cidrSubnet 8 2 }}
+// 		{{ range service "web" }}{{ if .Address | cidrContains "10.0.0.0/8" }}...
+//
+// Addresses written with colons are IPv6.
+
+// cidrHost returns the address of the host number in the prefix. Negative
+// numbers count back from the end of the prefix.
+//
+// 		{{ "10.0.0.0/24" | cidrHost 5 }} // 10.0.0.5
+//
+func cidrHost(num int, prefix string) (string, error) {
+	r, err := parsePrefix("cidrHost", prefix)
+	if err != nil {
+		return "", err
+	}
+	n := big.NewInt(int64(num))
+	if num < 0 {
+		n.Add(n, r.size())
+	}
+	if n.Sign() < 0 || n.Cmp(r.size()) >= 0 {
+		return "", fmt.Errorf("cidrHost: host number %d is out of range for %s",
+			num, prefix)
+	}
+	return r.ip(n.Add(n, r.start)).String(), nil
+}
+
+// cidrSubnet returns the subnet of the prefix, with the prefix extended by
+// the new bits, numbered by netnum.
+//
+// 		{{ "10.0.0.0/16" | cidrSubnet 8 2 }} // 10.0.2.0/24
+//
+func cidrSubnet(newbits, netnum int, prefix string) (string, error) {
+	r, err := parsePrefix("cidrSubnet", prefix)
+	if err != nil {
+		return "", err
+	}
+	if newbits < 0 || r.ones+newbits > r.bits {
+		return "", fmt.Errorf("cidrSubnet: cannot extend %s by %d bits", prefix, newbits)
+	}
+	n := big.NewInt(int64(netnum))
+	if n.Sign() < 0 || n.BitLen() > newbits {
+		return "", fmt.Errorf("cidrSubnet: network number %d is out of range for %d bits",
+			netnum, newbits)
+	}
+	n.Lsh(n, uint(r.bits-r.ones-newbits))
+	return r.prefix(n.Add(n, r.start), r.ones+newbits), nil
+}
+
+// cidrNetmask returns the netmask of an IPv4 prefix in dotted form.
+//
+// 		{{ "10.0.0.0/12" | cidrNetmask }} // 255.240.0.0
+//
+func cidrNetmask(prefix string) (string, error) {
+	r, err := parsePrefix("cidrNetmask", prefix)
+	if err != nil {
+		return "", err
+	}
+	if r.bits != 8*net.IPv4len {
+		return "", fmt.Errorf("cidrNetmask: %s is not an IPv4 prefix", prefix)
+	}
+	return net.IP(net.CIDRMask(r.ones, r.bits)).String(), nil
+}
+
+// cidrContains returns true if the prefix contains the address, or all the
+// addresses of a prefix. Addresses of the other family are not contained.
+func cidrContains(prefix, addr string) (bool, error) {
+	r, err := parsePrefix("cidrContains", prefix)
+	if err != nil {
+		return false, err
+	}
+	a, err := parseAddrRange("cidrContains", addr)
+	if err != nil {
+		return false, err
+	}
+	return a.bits == r.bits && a.start.Cmp(r.start) >= 0 && a.end.Cmp(r.end) <= 0, nil
+}
+
+// isIPv4 returns true if the value is an IPv4 address or prefix.
+func isIPv4(s string) (bool, error) {
+	r, err := parseAddrRange("isIPv4", s)
+	return err == nil && r.bits == 8*net.IPv4len, nil
+}
+
+// isIPv6 returns true if the value is an IPv6 address or prefix.
+func isIPv6(s string) (bool, error) {
+	r, err := parseAddrRange("isIPv6", s)
+	return err == nil && r.bits == 8*net.IPv6len, nil
+}
+
+// sortIPs sorts a list of addresses or prefixes by address, IPv4 before
+// IPv6, with the shorter of prefixes of the same address first.
+//
+// 		{{ range service "web" | pluck "Address" | sortIPs }}
+//
+func sortIPs(l interface{}) ([]string, error) {
+	addrs, ranges, err := addrRanges("sortIPs", l)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(addrs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := ranges[idx[i]], ranges[idx[j]]
+		if c := a.compare(b); c != 0 {
+			return c < 0
+		}
+		return a.ones < b.ones
+	})
+	result := make([]string, len(idx))
+	for i, j := range idx {
+		result[i] = addrs[j]
+	}
+	return result, nil
+}
+
+// cidrMerge aggregates a list of addresses and prefixes into the fewest
+// prefixes covering them, merging overlapping and adjacent ranges. The
+// prefixes are sorted, IPv4 before IPv6.
+//
+// 		{{ list "10.0.0.0/25" "10.0.0.128/25" "10.0.1.1" | cidrMerge }}
+// 		// [10.0.0.0/24 10.0.1.1/32]
+//
+func cidrMerge(l interface{}) ([]string, error) {
+	_, ranges, err := addrRanges("cidrMerge", l)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].compare(ranges[j]) < 0
+	})
+
+	var merged []addrRange
+	for _, r := range ranges {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			next := new(big.Int).Add(last.end, big.NewInt(1))
+			if last.bits == r.bits && r.start.Cmp(next) <= 0 {
+				if r.end.Cmp(last.end) > 0 {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	result := []string{}
+	for _, r := range merged {
+		result = append(result, r.prefixes()...)
+	}
+	return result, nil
+}
+
+// addrRange is the range of addresses of an address or prefix, as integers.
+type addrRange struct {
+	// bits is 32 for IPv4 and 128 for IPv6, ones is the prefix length
+	bits, ones int
+	start, end *big.Int
+}
+
+// parseAddrRange parses an address or a prefix.
+func parseAddrRange(name, s string) (addrRange, error) {
+	s = strings.TrimSpace(s)
+	bits := 8 * net.IPv4len
+	if strings.Contains(s, ":") {
+		bits = 8 * net.IPv6len
+	}
+
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return addrRange{}, fmt.Errorf("%s: invalid CIDR prefix %q", name, s)
+		}
+		ones, _ := network.Mask.Size()
+		start := ipInt(network.IP, bits)
+		end := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		end.Add(end, start).Sub(end, big.NewInt(1))
+		return addrRange{bits: bits, ones: ones, start: start, end: end}, nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return addrRange{}, fmt.Errorf("%s: invalid IP address %q", name, s)
+	}
+	n := ipInt(ip, bits)
+	return addrRange{bits: bits, ones: bits, start: n, end: new(big.Int).Set(n)}, nil
+}
+
+// parsePrefix parses a prefix, which can't be a single address.
+func parsePrefix(name, s string) (addrRange, error) {
+	if !strings.Contains(s, "/") {
+		return addrRange{}, fmt.Errorf("%s: invalid CIDR prefix %q", name, s)
+	}
+	return parseAddrRange(name, s)
+}
+
+// addrRanges parses a list of addresses, which must be strings.
+func addrRanges(name string, l interface{}) ([]string, []addrRange, error) {
+	items, err := listItems(name, l)
+	if err != nil {
+		return nil, nil, err
+	}
+	addrs := make([]string, len(items))
+	ranges := make([]addrRange, len(items))
+	for i, item := range items {
+		v := reflect.ValueOf(item)
+		if v.Kind() != reflect.String {
+			return nil, nil, fmt.Errorf("%s: expected an address, got %T", name, item)
+		}
+		addrs[i] = strings.TrimSpace(v.String())
+		if ranges[i], err = parseAddrRange(name, addrs[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return addrs, ranges, nil
+}
+
+func ipInt(ip net.IP, bits int) *big.Int {
+	if bits == 8*net.IPv4len {
+		return new(big.Int).SetBytes(ip.To4())
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+// compare orders IPv4 ranges before IPv6, then by their start.
+func (r addrRange) compare(o addrRange) int {
+	if r.bits != o.bits {
+		if r.bits < o.bits {
+			return -1
+		}
+		return 1
+	}
+	return r.start.Cmp(o.start)
+}
+
+// size returns the number of addresses in the range of a prefix.
+func (r addrRange) size() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(r.bits-r.ones))
+}
+
+// ip returns the address of the integer in the range's family.
+func (r addrRange) ip(n *big.Int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, r.bits/8)
+	copy(ip[len(ip)-len(b):], b)
+	return ip
+}
+
+// prefix formats the prefix of the integer and length in the range's
+// family.
+func (r addrRange) prefix(n *big.Int, ones int) string {
+	return fmt.Sprintf("%s/%d", r.ip(n), ones)
+}
+
+// prefixes returns the fewest prefixes covering the range.
+func (r addrRange) prefixes() []string {
+	var result []string
+	one := big.NewInt(1)
+	start := new(big.Int).Set(r.start)
+	for start.Cmp(r.end) <= 0 {
+		// the largest block aligned at the start that fits in the range
+		size := r.bits
+		if start.Sign() != 0 && int(start.TrailingZeroBits()) < size {
+			size = int(start.TrailingZeroBits())
+		}
+		for {
+			last := new(big.Int).Lsh(one, uint(size))
+			last.Add(last, start).Sub(last, one)
+			if last.Cmp(r.end) <= 0 {
+				break
+			}
+			size--
+		}
+		result = append(result, r.prefix(start, r.bits-size))
+		start.Add(start, new(big.Int).Lsh(one, uint(size)))
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package hcat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+func TestNetworkFuncs(t *testing.T) {
+	t.Parallel()
+	node := &dep.Node{
+		Address: "10.1.2.3",
+		TaggedAddresses: map[string]string{
+			"lan":      "10.1.2.3",
+			"wan":      "198.51.100.7",
+			"lan_ipv6": "2001:db8::7",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		fn      func() (interface{}, error)
+		want    interface{}
+		wantErr bool
+	}{
+		{"cidrHost", func() (interface{}, error) { return cidrHost(5, "10.0.0.0/24") },
+			"10.0.0.5", false},
+		{"cidrHost_negative", func() (interface{}, error) { return cidrHost(-2, "10.0.0.0/24") },
+			"10.0.0.254", false},
+		{"cidrHost_unaligned", func() (interface{}, error) { return cidrHost(1, "10.0.0.77/30") },
+			"10.0.0.77", false},
+		{"cidrHost_ipv6", func() (interface{}, error) { return cidrHost(16, "2001:db8::/64") },
+			"2001:db8::10", false},
+		{"cidrHost_out_of_range", func() (interface{}, error) { return cidrHost(256, "10.0.0.0/24") },
+			nil, true},
+		{"cidrHost_not_prefix", func() (interface{}, error) { return cidrHost(1, "10.0.0.1") },
+			nil, true},
+		{"cidrSubnet", func() (interface{}, error) { return cidrSubnet(8, 2, "10.0.0.0/16") },
+			"10.0.2.0/24", false},
+		{"cidrSubnet_zero_bits", func() (interface{}, error) { return cidrSubnet(0, 0, "10.0.0.0/16") },
+			"10.0.0.0/16", false},
+		{"cidrSubnet_ipv6", func() (interface{}, error) { return cidrSubnet(16, 255, "2001:db8::/32") },
+			"2001:db8:ff::/48", false},
+		{"cidrSubnet_too_many_bits", func() (interface{}, error) { return cidrSubnet(17, 0, "10.0.0.0/16") },
+			nil, true},
+		{"cidrSubnet_bad_netnum", func() (interface{}, error) { return cidrSubnet(2, 4, "10.0.0.0/16") },
+			nil, true},
+		{"cidrNetmask", func() (interface{}, error) { return cidrNetmask("10.0.0.0/12") },
+			"255.240.0.0", false},
+		{"cidrNetmask_ipv6", func() (interface{}, error) { return cidrNetmask("2001:db8::/32") },
+			nil, true},
+		{"cidrNetmask_invalid", func() (interface{}, error) { return cidrNetmask("10.0.0.0/33") },
+			nil, true},
+		{"cidrContains", func() (interface{}, error) { return cidrContains("10.0.0.0/8", node.Address) },
+			true, false},
+		{"cidrContains_not", func() (interface{}, error) {
+			return cidrContains("10.0.0.0/8", node.TaggedAddresses["wan"])
+		}, false, false},
+		{"cidrContains_prefix", func() (interface{}, error) { return cidrContains("10.0.0.0/8", "10.2.0.0/16") },
+			true, false},
+		{"cidrContains_wider_prefix", func() (interface{}, error) { return cidrContains("10.0.0.0/16", "10.0.0.0/8") },
+			false, false},
+		{"cidrContains_other_family", func() (interface{}, error) {
+			return cidrContains("0.0.0.0/0", node.TaggedAddresses["lan_ipv6"])
+		}, false, false},
+		{"cidrContains_invalid", func() (interface{}, error) { return cidrContains("10.0.0.0/8", "nope") },
+			nil, true},
+		{"isIPv4", func() (interface{}, error) { return isIPv4(node.TaggedAddresses["lan"]) },
+			true, false},
+		{"isIPv4_prefix", func() (interface{}, error) { return isIPv4("10.0.0.0/8") }, true, false},
+		{"isIPv4_ipv6", func() (interface{}, error) { return isIPv4("2001:db8::7") }, false, false},
+		{"isIPv4_mapped", func() (interface{}, error) { return isIPv4("::ffff:10.0.0.1") }, false, false},
+		{"isIPv4_invalid", func() (interface{}, error) { return isIPv4("example.com") }, false, false},
+		{"isIPv6", func() (interface{}, error) { return isIPv6(node.TaggedAddresses["lan_ipv6"]) },
+			true, false},
+		{"isIPv6_ipv4", func() (interface{}, error) { return isIPv6("10.0.0.1") }, false, false},
+		{"isIPv6_empty", func() (interface{}, error) { return isIPv6("") }, false, false},
+		{"sortIPs", func() (interface{}, error) {
+			return sortIPs([]string{"10.0.0.10", "2001:db8::1", "10.0.0.9", "9.255.0.1",
+				"10.0.0.0/8", "10.0.0.0/24"})
+		}, []string{"9.255.0.1", "10.0.0.0/8", "10.0.0.0/24", "10.0.0.9", "10.0.0.10",
+			"2001:db8::1"}, false},
+		{"sortIPs_tagged_addresses", func() (interface{}, error) {
+			addrs, _ := values(node.TaggedAddresses)
+			return sortIPs(addrs)
+		}, []string{"10.1.2.3", "198.51.100.7", "2001:db8::7"}, false},
+		{"sortIPs_nil", func() (interface{}, error) { return sortIPs(nil) }, []string{}, false},
+		{"sortIPs_invalid", func() (interface{}, error) { return sortIPs([]string{"nope"}) },
+			nil, true},
+		{"sortIPs_not_strings", func() (interface{}, error) { return sortIPs([]int{1}) },
+			nil, true},
+		{"cidrMerge", func() (interface{}, error) {
+			return cidrMerge([]string{"10.0.0.128/25", "10.0.0.0/25", "10.0.1.1",
+				"10.0.1.0/30", "2001:db8::/33", "2001:db8:8000::/33", "10.0.0.5"})
+		}, []string{"10.0.0.0/24", "10.0.1.0/30", "2001:db8::/32"}, false},
+		{"cidrMerge_unaligned", func() (interface{}, error) {
+			return cidrMerge([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"})
+		}, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/32"}, false},
+		{"cidrMerge_all", func() (interface{}, error) {
+			return cidrMerge([]string{"0.0.0.0/1", "128.0.0.0/1"})
+		}, []string{"0.0.0.0/0"}, false},
+		{"cidrMerge_nil", func() (interface{}, error) { return cidrMerge(nil) }, []string{}, false},
+		{"cidrMerge_invalid", func() (interface{}, error) { return cidrMerge([]string{"10.0.0.0/40"}) },
+			nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fn()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package hcat
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/hcat/dep"
+)
+
+// Functions to inspect X.509 certificates and PEM data. They take PEM
+// strings, Connect CA roots and leaves (the results of caRoots and caLeaf),
+// or lists of them. They return nil for nil or empty values, so they can be
+// used on data not yet fetched:
+//
+// 		{{ with caLeaf "web" | parseCert }}{{ .NotAfter }}{{ end }}
+// 		{{ with secret "pki/issue/web" "common_name=web" }}
+// 		{{ list .Data.certificate .Data.issuing_ca | certChain }}{{ end }}
+//
+
+// parseCert returns the first certificate in the PEM.
+func parseCert(v interface{}) (*dep.Certificate, error) {
+	certs, err := parsePEMCerts("parseCert", v)
+	if err != nil || len(certs) == 0 {
+		return nil, err
+	}
+	return certInfo(certs[0]), nil
+}
+
+// parseCerts returns all the certificates in the PEM, such as a bundle.
+func parseCerts(v interface{}) ([]*dep.Certificate, error) {
+	certs, err := parsePEMCerts("parseCerts", v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*dep.Certificate, len(certs))
+	for i, c := range certs {
+		result[i] = certInfo(c)
+	}
+	return result, nil
+}
+
+// splitPEM splits PEM data, such as a bundle, into its blocks. Data other
+// than the blocks is dropped.
+func splitPEM(v interface{}) ([]string, error) {
+	blocks, err := pemBlocks("splitPEM", v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(blocks))
+	for i, b := range blocks {
+		result[i] = string(pem.EncodeToMemory(b))
+	}
+	return result, nil
+}
+
+// certChain builds a certificate chain from the certificates in the PEM,
+// from the leaf up to the root, as PEM. The leaf is the certificate that
+// issued none of the others, preferring one that isn't a CA, and each next
+// certificate is the issuer of the previous one. Certificates not in the
+// chain, such as other roots, are left out.
+func certChain(v interface{}) (string, error) {
+	certs, err := parsePEMCerts("certChain", v)
+	if err != nil || len(certs) == 0 {
+		return "", err
+	}
+
+	// drop duplicates, as the issuing CA is often also in the bundle
+	var uniq []*x509.Certificate
+	for _, c := range certs {
+		dup := false
+		for _, u := range uniq {
+			if c.Equal(u) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			uniq = append(uniq, c)
+		}
+	}
+
+	var leaves []*x509.Certificate
+	for _, c := range uniq {
+		issuer := false
+		for _, o := range uniq {
+			if o != c && issuedBy(o, c) {
+				issuer = true
+				break
+			}
+		}
+		if !issuer {
+			leaves = append(leaves, c)
+		}
+	}
+	if len(leaves) > 1 {
+		var endEntities []*x509.Certificate
+		for _, c := range leaves {
+			if !c.IsCA {
+				endEntities = append(endEntities, c)
+			}
+		}
+		if len(endEntities) > 0 {
+			leaves = endEntities
+		}
+	}
+	if len(leaves) != 1 {
+		return "", fmt.Errorf("certChain: expected one leaf certificate, found %d",
+			len(leaves))
+	}
+
+	chain := []*x509.Certificate{leaves[0]}
+	for c := leaves[0]; !issuedBy(c, c); {
+		var next *x509.Certificate
+		for _, o := range uniq {
+			if issuedBy(c, o) && !containsCert(chain, o) {
+				next = o
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		chain = append(chain, next)
+		c = next
+	}
+
+	var buf bytes.Buffer
+	for _, c := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	return buf.String(), nil
+}
+
+// pemToDER returns the DER bytes of the first PEM block.
+func pemToDER(v interface{}) (string, error) {
+	blocks, err := pemBlocks("pemToDER", v)
+	if err != nil || len(blocks) == 0 {
+		return "", err
+	}
+	return string(blocks[0].Bytes), nil
+}
+
+// pemToBase64 returns the base64 encoded DER bytes of the first PEM block,
+// on a single line.
+func pemToBase64(v interface{}) (string, error) {
+	blocks, err := pemBlocks("pemToBase64", v)
+	if err != nil || len(blocks) == 0 {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(blocks[0].Bytes), nil
+}
+
+// issuedBy returns true if the certificate was signed by the issuer.
+func issuedBy(c, issuer *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, issuer.RawSubject) &&
+		c.CheckSignatureFrom(issuer) == nil
+}
+
+func containsCert(certs []*x509.Certificate, c *x509.Certificate) bool {
+	for _, o := range certs {
+		if o.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// certInfo returns the certificate's details for templates.
+func certInfo(c *x509.Certificate) *dep.Certificate {
+	sha1Sum := sha1.Sum(c.Raw)
+	sha256Sum := sha256.Sum256(c.Raw)
+	info := &dep.Certificate{
+		Subject:           c.Subject.String(),
+		CommonName:        c.Subject.CommonName,
+		Issuer:            c.Issuer.String(),
+		SerialNumber:      colonHex(c.SerialNumber.Bytes()),
+		SHA1Fingerprint:   colonHex(sha1Sum[:]),
+		SHA256Fingerprint: colonHex(sha256Sum[:]),
+		NotBefore:         c.NotBefore,
+		NotAfter:          c.NotAfter,
+		DNSNames:          append([]string{}, c.DNSNames...),
+		IPAddresses:       make([]string, len(c.IPAddresses)),
+		EmailAddresses:    append([]string{}, c.EmailAddresses...),
+		URIs:              make([]string, len(c.URIs)),
+		IsCA:              c.IsCA,
+		PEM:               string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})),
+	}
+	for i, ip := range c.IPAddresses {
+		info.IPAddresses[i] = ip.String()
+	}
+	for i, u := range c.URIs {
+		info.URIs[i] = u.String()
+	}
+	return info
+}
+
+// colonHex encodes the bytes in hex separated by :, as serial numbers are
+// by Consul and Vault.
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// parsePEMCerts returns the certificates of the PEM's CERTIFICATE blocks.
+func parsePEMCerts(name string, v interface{}) ([]*x509.Certificate, error) {
+	blocks, err := pemBlocks(name, v)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, b := range blocks {
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		certs = append(certs, c)
+	}
+	if len(blocks) > 0 && len(certs) == 0 {
+		return nil, fmt.Errorf("%s: no certificates found", name)
+	}
+	return certs, nil
+}
+
+// pemBlocks returns the PEM blocks of the value. Data that isn't empty but
+// has no blocks is an error.
+func pemBlocks(name string, v interface{}) ([]*pem.Block, error) {
+	data, err := pemData(name, v)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []*pem.Block
+	for rest := data; ; {
+		var b *pem.Block
+		if b, rest = pem.Decode(rest); b == nil {
+			break
+		}
+		blocks = append(blocks, b)
+	}
+	if len(blocks) == 0 && len(bytes.TrimSpace(data)) > 0 {
+		return nil, fmt.Errorf("%s: no PEM data found", name)
+	}
+	return blocks, nil
+}
+
+// pemData returns the PEM data of strings, Connect CA roots and leaves, and
+// lists of them.
+func pemData(name string, v interface{}) ([]byte, error) {
+	switch typed := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return typed, nil
+	case *api.CARoot:
+		if typed == nil {
+			return nil, nil
+		}
+		return []byte(typed.RootCertPEM), nil
+	case *api.LeafCert:
+		if typed == nil {
+			return nil, nil
+		}
+		return []byte(typed.CertPEM), nil
+	case *dep.Certificate:
+		if typed == nil {
+			return nil, nil
+		}
+		return []byte(typed.PEM), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), nil
+	case reflect.Array, reflect.Slice:
+		var buf bytes.Buffer
+		for i := 0; i < rv.Len(); i++ {
+			data, err := pemData(name, rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%s: wrong argument type %T", name, v)
+}
@@ -0,0 +1,1166 @@
+package hcat
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// query evaluates a jq-like expression against the value, which can be any
+// template data: parsed JSON, exploded KV trees or the Consul and Vault
+// types, whose fields are accessed by name. It takes the value last so it
+// can be piped:
+//
+// 		{{ service "web" | query "[.[] | select(.Port > 80) | .Address] | sort" }}
+//
+// The expression language is a subset of jq:
+//
+// 		.                 the value
+// 		$                 the value query was called with
+// 		.foo, ."foo"      the field or map key foo, null if the map has no foo
+// 		.[0], .[-1]       a list element, null if out of range
+// 		.[1:3]            part of a list or string
+// 		.[]               each list element, or each map value in key order
+// 		a | b             b evaluated with each result of a
+// 		a, b              the results of a then b
+// 		[a]               a list of the results of a
+// 		{k: a, name}      a map, with name short for name: .name
+// 		==, !=, <, <=, >, >=, and, or
+// 		"str", 1.5, true, false, null
+//
+// and the functions length, keys, has(k), first, last, reverse, sort,
+// sort_by(f), unique, map(f), select(f), not and join(sep).
+//
+// Expressions producing a stream of results, as they iterate with .[],
+// select or have a comma outside of [...] and function arguments, return a
+// list of the results, whatever their number. Other expressions always have
+// a single result, which is returned as it is.
+//
+// 		.ports[0]                    80
+// 		.ports[]                     [80, 443]
+// 		.ports[] | select(. > 80)    [443]
+// 		.nope[]                      []
+func query(expr string, v interface{}) (interface{}, error) {
+	n, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	out, err := n.eval(&queryEnv{root: v, src: expr}, v)
+	if err != nil {
+		return nil, err
+	}
+	if queryStreams(n) {
+		if out == nil {
+			out = []interface{}{}
+		}
+		return out, nil
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out[0], nil
+}
+
+// queryStreams returns true if the node produces a stream of results, ie.
+// any number of them, rather than a single one.
+func queryStreams(n queryNode) bool {
+	switch n := n.(type) {
+	case *queryIterate, *queryComma:
+		return true
+	case *queryField:
+		return queryStreams(n.target)
+	case *queryIndex:
+		return queryStreams(n.target) || queryStreams(n.index)
+	case *querySlice:
+		return queryStreams(n.target)
+	case *queryPipe:
+		return queryStreams(n.left) || queryStreams(n.right)
+	case *queryBinary:
+		return queryStreams(n.left) || queryStreams(n.right)
+	case *queryObject:
+		for _, v := range n.vals {
+			if queryStreams(v) {
+				return true
+			}
+		}
+	case *queryCall:
+		return n.name == "select"
+	}
+	// identity, root, literals and [...] have a single result
+	return false
+}
+
+// queryError is an error in a query, with its position in the expression.
+type queryError struct {
+	expr string
+	pos  int
+	msg  string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("query %q: col %d: %s", e.expr, e.pos+1, e.msg)
+}
+
+func newQueryError(expr string, pos int, format string, args ...interface{}) error {
+	return &queryError{expr: expr, pos: pos, msg: fmt.Sprintf(format, args...)}
+}
+
+type queryTokenKind int
+
+const (
+	queryEOF queryTokenKind = iota
+	queryIdent
+	queryString
+	queryNumber
+	queryPunct
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+	val  interface{}
+}
+
+func isQueryIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isQueryDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func lexQuery(src string) ([]queryToken, error) {
+	var toks []queryToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isQueryIdentStart(c):
+			j := i + 1
+			for j < len(src) && (isQueryIdentStart(src[j]) || isQueryDigit(src[j])) {
+				j++
+			}
+			toks = append(toks, queryToken{kind: queryIdent, text: src[i:j], pos: i})
+			i = j
+		case isQueryDigit(c) || (c == '-' && i+1 < len(src) && isQueryDigit(src[i+1])):
+			j := i + 1
+			for j < len(src) && isQueryDigit(src[j]) {
+				j++
+			}
+			if j+1 < len(src) && src[j] == '.' && isQueryDigit(src[j+1]) {
+				j++
+				for j < len(src) && isQueryDigit(src[j]) {
+					j++
+				}
+			}
+			f, _ := strconv.ParseFloat(src[i:j], 64)
+			toks = append(toks, queryToken{kind: queryNumber, text: src[i:j], pos: i, val: f})
+			i = j
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return nil, newQueryError(src, i, "unterminated string")
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, newQueryError(src, i, "invalid string %s", src[i:j+1])
+			}
+			toks = append(toks, queryToken{kind: queryString, text: src[i : j+1], pos: i, val: s})
+			i = j + 1
+		default:
+			if i+1 < len(src) {
+				switch op := src[i : i+2]; op {
+				case "==", "!=", "<=", ">=":
+					toks = append(toks, queryToken{kind: queryPunct, text: op, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte(".|,[]{}():$<>", c) < 0 {
+				return nil, newQueryError(src, i, "unexpected character %q", c)
+			}
+			toks = append(toks, queryToken{kind: queryPunct, text: src[i : i+1], pos: i})
+			i++
+		}
+	}
+	return append(toks, queryToken{kind: queryEOF, pos: len(src)}), nil
+}
+
+// queryFuncs are the functions' number of arguments.
+var queryFuncs = map[string]int{
+	"first":   0,
+	"has":     1,
+	"join":    1,
+	"keys":    0,
+	"last":    0,
+	"length":  0,
+	"map":     1,
+	"not":     0,
+	"reverse": 0,
+	"select":  1,
+	"sort":    0,
+	"sort_by": 1,
+	"unique":  0,
+}
+
+type queryParser struct {
+	src  string
+	toks []queryToken
+	i    int
+}
+
+func parseQuery(src string) (queryNode, error) {
+	toks, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{src: src, toks: toks}
+	if p.peek().kind == queryEOF {
+		return nil, newQueryError(src, 0, "empty query")
+	}
+	n, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != queryEOF {
+		return nil, p.unexpected()
+	}
+	return n, nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.toks[p.i]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.toks[p.i]
+	if t.kind != queryEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *queryParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == queryPunct && t.text == s
+}
+
+func (p *queryParser) isKeyword(s string) bool {
+	t := p.peek()
+	return t.kind == queryIdent && t.text == s
+}
+
+func (p *queryParser) expect(s string) error {
+	if !p.isPunct(s) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+func (p *queryParser) unexpected() error {
+	t := p.peek()
+	if t.kind == queryEOF {
+		return newQueryError(p.src, t.pos, "unexpected end of query")
+	}
+	return newQueryError(p.src, t.pos, "unexpected %s", t.text)
+}
+
+func (p *queryParser) parsePipe() (queryNode, error) {
+	left, err := p.parseComma()
+	if err != nil || !p.isPunct("|") {
+		return left, err
+	}
+	p.next()
+	right, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	return &queryPipe{left: left, right: right}, nil
+}
+
+func (p *queryParser) parseComma() (queryNode, error) {
+	left, err := p.parseOr()
+	for err == nil && p.isPunct(",") {
+		p.next()
+		var right queryNode
+		if right, err = p.parseOr(); err == nil {
+			left = &queryComma{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.isKeyword("or") {
+		pos := p.next().pos
+		var right queryNode
+		if right, err = p.parseAnd(); err == nil {
+			left = &queryBinary{pos: pos, op: "or", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseCompare()
+	for err == nil && p.isKeyword("and") {
+		pos := p.next().pos
+		var right queryNode
+		if right, err = p.parseCompare(); err == nil {
+			left = &queryBinary{pos: pos, op: "and", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) parseCompare() (queryNode, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != queryPunct {
+		return left, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		return &queryBinary{pos: t.pos, op: t.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *queryParser) parsePostfix() (queryNode, error) {
+	n, err := p.parsePrimary()
+	for err == nil {
+		switch {
+		case p.isPunct("."):
+			pos := p.next().pos
+			switch t := p.peek(); {
+			case t.kind == queryIdent:
+				p.next()
+				n = &queryField{pos: pos, target: n, name: t.text}
+			case t.kind == queryString:
+				p.next()
+				n = &queryField{pos: pos, target: n, name: t.val.(string)}
+			case p.isPunct("["):
+				n, err = p.parseBracket(n)
+			default:
+				return nil, p.unexpected()
+			}
+		case p.isPunct("["):
+			n, err = p.parseBracket(n)
+		default:
+			return n, nil
+		}
+	}
+	return nil, err
+}
+
+// parseBracket parses an index, slice or iteration of the target.
+func (p *queryParser) parseBracket(target queryNode) (queryNode, error) {
+	pos := p.next().pos
+	if p.isPunct("]") {
+		p.next()
+		return &queryIterate{pos: pos, target: target}, nil
+	}
+
+	var from, to queryNode
+	var err error
+	if !p.isPunct(":") {
+		if from, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+		if p.isPunct("]") {
+			p.next()
+			return &queryIndex{pos: pos, target: target, index: from}, nil
+		}
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if !p.isPunct("]") {
+		if to, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	return &querySlice{pos: pos, target: target, from: from, to: to}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case queryNumber, queryString:
+		p.next()
+		return &queryLiteral{val: t.val}, nil
+	case queryIdent:
+		p.next()
+		switch t.text {
+		case "true":
+			return &queryLiteral{val: true}, nil
+		case "false":
+			return &queryLiteral{val: false}, nil
+		case "null":
+			return &queryLiteral{val: nil}, nil
+		}
+		arity, ok := queryFuncs[t.text]
+		if !ok {
+			return nil, newQueryError(p.src, t.pos, "unknown function %q", t.text)
+		}
+		call := &queryCall{pos: t.pos, name: t.text}
+		if arity > 0 {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			call.arg = arg
+		}
+		return call, nil
+	case queryPunct:
+		switch t.text {
+		case ".":
+			p.next()
+			// a field directly after the dot
+			if next := p.peek(); next.pos == t.pos+1 {
+				switch next.kind {
+				case queryIdent:
+					p.next()
+					return &queryField{pos: t.pos, target: queryIdentity{}, name: next.text}, nil
+				case queryString:
+					p.next()
+					return &queryField{pos: t.pos, target: queryIdentity{}, name: next.val.(string)}, nil
+				}
+			}
+			return queryIdentity{}, nil
+		case "$":
+			p.next()
+			return queryRoot{}, nil
+		case "(":
+			p.next()
+			n, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			p.next()
+			if p.isPunct("]") {
+				p.next()
+				return &queryCollect{}, nil
+			}
+			n, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			return &queryCollect{expr: n}, p.expect("]")
+		case "{":
+			return p.parseObject()
+		}
+	}
+	return nil, p.unexpected()
+}
+
+func (p *queryParser) parseObject() (queryNode, error) {
+	p.next()
+	obj := &queryObject{}
+	for !p.isPunct("}") {
+		var key string
+		t := p.peek()
+		switch t.kind {
+		case queryIdent:
+			key = t.text
+		case queryString:
+			key = t.val.(string)
+		default:
+			return nil, p.unexpected()
+		}
+		p.next()
+
+		var val queryNode = &queryField{pos: t.pos, target: queryIdentity{}, name: key}
+		if p.isPunct(":") {
+			p.next()
+			var err error
+			if val, err = p.parseOr(); err != nil {
+				return nil, err
+			}
+		}
+		obj.keys = append(obj.keys, key)
+		obj.vals = append(obj.vals, val)
+
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	return obj, p.expect("}")
+}
+
+// queryEnv is the environment a query is evaluated in.
+type queryEnv struct {
+	root interface{}
+	src  string
+}
+
+func (e *queryEnv) errorf(pos int, format string, args ...interface{}) error {
+	return newQueryError(e.src, pos, format, args...)
+}
+
+// queryNode is a node of a parsed query. Evaluating it against a value
+// produces any number of results.
+type queryNode interface {
+	eval(e *queryEnv, in interface{}) ([]interface{}, error)
+}
+
+type queryIdentity struct{}
+
+func (queryIdentity) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	return []interface{}{in}, nil
+}
+
+type queryRoot struct{}
+
+func (queryRoot) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	return []interface{}{e.root}, nil
+}
+
+type queryLiteral struct {
+	val interface{}
+}
+
+func (n *queryLiteral) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	return []interface{}{n.val}, nil
+}
+
+type queryField struct {
+	pos    int
+	target queryNode
+	name   string
+}
+
+func (n *queryField) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(targets))
+	for _, t := range targets {
+		v, err := e.field(n.pos, t, n.name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// field returns a map's key or a struct's field. Missing map keys and
+// fields of nil are nil.
+func (e *queryEnv) field(pos int, v interface{}, name string) (interface{}, error) {
+	rv := queryIndirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			m, _ := stringMap(rv.Interface())
+			return m[name], nil
+		}
+		f := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !f.IsValid() {
+			return nil, nil
+		}
+		return f.Interface(), nil
+	case reflect.Struct:
+		f, ok := lookupField(rv.Interface(), name)
+		if !ok {
+			return nil, e.errorf(pos, "%s has no field %q", rv.Type(), name)
+		}
+		return f.Interface(), nil
+	}
+	return nil, e.errorf(pos, "cannot get field %q of %T", name, v)
+}
+
+type queryIndex struct {
+	pos    int
+	target queryNode
+	index  queryNode
+}
+
+func (n *queryIndex) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	// the index is evaluated against the input, as in .[.i]
+	indexes, err := n.index.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, t := range targets {
+		for _, idx := range indexes {
+			var v interface{}
+			if s, ok := idx.(string); ok {
+				v, err = e.field(n.pos, t, s)
+			} else {
+				v, err = e.index(n.pos, t, idx)
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// index returns a list's element, counting from the end for negative
+// indexes. Out of range indexes and indexes of nil are nil.
+func (e *queryEnv) index(pos int, v, idx interface{}) (interface{}, error) {
+	i, err := e.integer(pos, idx)
+	if err != nil {
+		return nil, err
+	}
+	rv := queryIndirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Array, reflect.Slice:
+		if i < 0 {
+			i += rv.Len()
+		}
+		if i < 0 || i >= rv.Len() {
+			return nil, nil
+		}
+		return rv.Index(i).Interface(), nil
+	}
+	return nil, e.errorf(pos, "cannot index %T with a number", v)
+}
+
+func (e *queryEnv) integer(pos int, v interface{}) (int, error) {
+	f, ok := toFloat(reflect.ValueOf(v))
+	if !ok || f != float64(int(f)) {
+		return 0, e.errorf(pos, "expected an integer index, got %v", v)
+	}
+	return int(f), nil
+}
+
+type querySlice struct {
+	pos      int
+	target   queryNode
+	from, to queryNode
+}
+
+func (n *querySlice) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(targets))
+	for _, t := range targets {
+		rv := queryIndirect(reflect.ValueOf(t))
+		switch rv.Kind() {
+		case reflect.Invalid:
+			out = append(out, nil)
+			continue
+		case reflect.Array, reflect.Slice, reflect.String:
+		default:
+			return nil, e.errorf(n.pos, "cannot slice %T", t)
+		}
+
+		bounds := []int{0, rv.Len()}
+		for i, b := range []queryNode{n.from, n.to} {
+			if b == nil {
+				continue
+			}
+			v, err := e.single(b, in)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue
+			}
+			if bounds[i], err = e.integer(n.pos, v); err != nil {
+				return nil, err
+			}
+			if bounds[i] < 0 {
+				bounds[i] += rv.Len()
+			}
+			switch {
+			case bounds[i] < 0:
+				bounds[i] = 0
+			case bounds[i] > rv.Len():
+				bounds[i] = rv.Len()
+			}
+		}
+		if bounds[0] > bounds[1] {
+			bounds[0] = bounds[1]
+		}
+
+		if rv.Kind() == reflect.String {
+			out = append(out, rv.String()[bounds[0]:bounds[1]])
+			continue
+		}
+		items, _ := listItems("", rv.Interface())
+		out = append(out, items[bounds[0]:bounds[1]])
+	}
+	return out, nil
+}
+
+type queryIterate struct {
+	pos    int
+	target queryNode
+}
+
+func (n *queryIterate) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, t := range targets {
+		items, err := e.items(n.pos, t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+	}
+	return out, nil
+}
+
+// items returns a list's elements, or a map's values in the order of their
+// keys. Nil has no elements.
+func (e *queryEnv) items(pos int, v interface{}) ([]interface{}, error) {
+	rv := queryIndirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return []interface{}{}, nil
+	case reflect.Array, reflect.Slice:
+		return listItems("", rv.Interface())
+	case reflect.Map:
+		m, _ := stringMap(rv.Interface())
+		items := make([]interface{}, 0, len(m))
+		for _, k := range sortedDataKeys(m) {
+			items = append(items, m[k])
+		}
+		return items, nil
+	}
+	return nil, e.errorf(pos, "cannot iterate over %T", v)
+}
+
+// single evaluates the node, which must produce at most one result.
+func (e *queryEnv) single(n queryNode, in interface{}) (interface{}, error) {
+	out, err := n.eval(e, in)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+type queryPipe struct {
+	left, right queryNode
+}
+
+func (n *queryPipe) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range lefts {
+		rights, err := n.right.eval(e, l)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rights...)
+	}
+	return out, nil
+}
+
+type queryComma struct {
+	left, right queryNode
+}
+
+func (n *queryComma) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	return append(lefts, rights...), nil
+}
+
+type queryBinary struct {
+	pos         int
+	op          string
+	left, right queryNode
+}
+
+func (n *queryBinary) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(e, in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range lefts {
+		// and and or short-circuit
+		switch {
+		case n.op == "and" && !queryTruthy(l):
+			out = append(out, false)
+			continue
+		case n.op == "or" && queryTruthy(l):
+			out = append(out, true)
+			continue
+		}
+		rights, err := n.right.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			v, err := n.apply(e, l, r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func (n *queryBinary) apply(e *queryEnv, l, r interface{}) (bool, error) {
+	switch n.op {
+	case "and", "or":
+		return queryTruthy(r), nil
+	case "==":
+		return queryEqual(l, r), nil
+	case "!=":
+		return !queryEqual(l, r), nil
+	}
+	c, err := queryCompare(l, r)
+	if err != nil {
+		return false, e.errorf(n.pos, "%s", err)
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+type queryCollect struct {
+	expr queryNode
+}
+
+func (n *queryCollect) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	list := []interface{}{}
+	if n.expr != nil {
+		out, err := n.expr.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, out...)
+	}
+	return []interface{}{list}, nil
+}
+
+type queryObject struct {
+	keys []string
+	vals []queryNode
+}
+
+// eval produces a map for each combination of the values' results.
+func (n *queryObject) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	maps := []map[string]interface{}{{}}
+	for i, key := range n.keys {
+		vals, err := n.vals[i].eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		next := make([]map[string]interface{}, 0, len(maps)*len(vals))
+		for _, m := range maps {
+			for _, v := range vals {
+				c := make(map[string]interface{}, len(m)+1)
+				for k, mv := range m {
+					c[k] = mv
+				}
+				c[key] = v
+				next = append(next, c)
+			}
+		}
+		maps = next
+	}
+	out := make([]interface{}, len(maps))
+	for i, m := range maps {
+		out[i] = m
+	}
+	return out, nil
+}
+
+type queryCall struct {
+	pos  int
+	name string
+	arg  queryNode
+}
+
+func (n *queryCall) eval(e *queryEnv, in interface{}) ([]interface{}, error) {
+	switch n.name {
+	case "not":
+		return []interface{}{!queryTruthy(in)}, nil
+	case "select":
+		out, err := n.arg.eval(e, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range out {
+			if queryTruthy(v) {
+				return []interface{}{in}, nil
+			}
+		}
+		return nil, nil
+	case "length":
+		rv := queryIndirect(reflect.ValueOf(in))
+		switch rv.Kind() {
+		case reflect.Invalid:
+			return []interface{}{0}, nil
+		case reflect.String:
+			return []interface{}{utf8.RuneCountInString(rv.String())}, nil
+		case reflect.Array, reflect.Slice, reflect.Map:
+			return []interface{}{rv.Len()}, nil
+		}
+		return nil, e.errorf(n.pos, "%T has no length", in)
+	case "keys":
+		rv := queryIndirect(reflect.ValueOf(in))
+		switch rv.Kind() {
+		case reflect.Invalid:
+			return []interface{}{[]interface{}{}}, nil
+		case reflect.Map:
+			m, _ := stringMap(rv.Interface())
+			keys := make([]interface{}, 0, len(m))
+			for _, k := range sortedDataKeys(m) {
+				keys = append(keys, k)
+			}
+			return []interface{}{keys}, nil
+		case reflect.Array, reflect.Slice:
+			keys := make([]interface{}, rv.Len())
+			for i := range keys {
+				keys[i] = i
+			}
+			return []interface{}{keys}, nil
+		}
+		return nil, e.errorf(n.pos, "%T has no keys", in)
+	case "has":
+		key, err := e.single(n.arg, in)
+		if err != nil {
+			return nil, err
+		}
+		rv := queryIndirect(reflect.ValueOf(in))
+		switch rv.Kind() {
+		case reflect.Invalid:
+			return []interface{}{false}, nil
+		case reflect.Map:
+			m, _ := stringMap(rv.Interface())
+			_, ok := m[fmt.Sprint(key)]
+			return []interface{}{ok}, nil
+		case reflect.Array, reflect.Slice:
+			i, err := e.integer(n.pos, key)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{i >= 0 && i < rv.Len()}, nil
+		}
+		return nil, e.errorf(n.pos, "cannot check whether %T has a key", in)
+	}
+
+	// the remaining functions take lists
+	switch queryIndirect(reflect.ValueOf(in)).Kind() {
+	case reflect.Invalid, reflect.Array, reflect.Slice:
+	default:
+		return nil, e.errorf(n.pos, "%s: expected a list, got %T", n.name, in)
+	}
+	items, err := e.items(n.pos, in)
+	if err != nil {
+		return nil, err
+	}
+	switch n.name {
+	case "first", "last":
+		if len(items) == 0 {
+			return []interface{}{nil}, nil
+		}
+		if n.name == "first" {
+			return []interface{}{items[0]}, nil
+		}
+		return []interface{}{items[len(items)-1]}, nil
+	case "reverse":
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		return []interface{}{items}, nil
+	case "sort", "unique":
+		if err := e.sortBy(n.pos, items, items); err != nil {
+			return nil, err
+		}
+		if n.name == "unique" {
+			uniq := items[:0]
+			for i, item := range items {
+				if i == 0 || !queryEqual(item, uniq[len(uniq)-1]) {
+					uniq = append(uniq, item)
+				}
+			}
+			items = uniq
+		}
+		return []interface{}{items}, nil
+	case "sort_by":
+		keys := make([]interface{}, len(items))
+		for i, item := range items {
+			if keys[i], err = e.single(n.arg, item); err != nil {
+				return nil, err
+			}
+		}
+		if err := e.sortBy(n.pos, items, keys); err != nil {
+			return nil, err
+		}
+		return []interface{}{items}, nil
+	case "map":
+		out := []interface{}{}
+		for _, item := range items {
+			vals, err := n.arg.eval(e, item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vals...)
+		}
+		return []interface{}{out}, nil
+	case "join":
+		sep, err := e.single(n.arg, in)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := sep.(string)
+		if !ok {
+			return nil, e.errorf(n.pos, "join: expected a string separator, got %T", sep)
+		}
+		strs := make([]string, len(items))
+		for i, item := range items {
+			if strs[i], err = scalarString(strconv.Itoa(i), item); err != nil {
+				return nil, e.errorf(n.pos, "join: %s", err)
+			}
+		}
+		return []interface{}{strings.Join(strs, s)}, nil
+	}
+	return nil, e.errorf(n.pos, "unknown function %q", n.name)
+}
+
+// sortBy stably sorts the items by their keys, which are sorted along with
+// them.
+func (e *queryEnv) sortBy(pos int, items, keys []interface{}) error {
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	var err error
+	sort.SliceStable(idx, func(i, j int) bool {
+		c, cerr := queryCompare(keys[idx[i]], keys[idx[j]])
+		if cerr != nil && err == nil {
+			err = e.errorf(pos, "%s", cerr)
+		}
+		return c < 0
+	})
+	if err != nil {
+		return err
+	}
+	sortedItems := make([]interface{}, len(items))
+	sortedKeys := make([]interface{}, len(keys))
+	for i, j := range idx {
+		sortedItems[i], sortedKeys[i] = items[j], keys[j]
+	}
+	copy(items, sortedItems)
+	copy(keys, sortedKeys)
+	return nil
+}
+
+func queryIndirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// queryTruthy returns false for false and null, and true otherwise.
+func queryTruthy(v interface{}) bool {
+	rv := queryIndirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return false
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return true
+}
+
+// queryEqual compares values, with numbers compared by value whatever their
+// types.
+func queryEqual(a, b interface{}) bool {
+	av, bv := queryIndirect(reflect.ValueOf(a)), queryIndirect(reflect.ValueOf(b))
+	if !av.IsValid() || !bv.IsValid() {
+		return av.IsValid() == bv.IsValid()
+	}
+	if af, ok := toFloat(av); ok {
+		bf, ok := toFloat(bv)
+		return ok && af == bf
+	}
+	if av.Kind() == reflect.String && bv.Kind() == reflect.String {
+		return av.String() == bv.String()
+	}
+	return reflect.DeepEqual(av.Interface(), bv.Interface())
+}
+
+// queryCompare orders null first, then strings, numbers and bools among
+// themselves.
+func queryCompare(a, b interface{}) (int, error) {
+	av, bv := queryIndirect(reflect.ValueOf(a)), queryIndirect(reflect.ValueOf(b))
+	switch {
+	case !av.IsValid() && !bv.IsValid():
+		return 0, nil
+	case !av.IsValid():
+		return -1, nil
+	case !bv.IsValid():
+		return 1, nil
+	}
+	return compareValues(av, bv)
+}
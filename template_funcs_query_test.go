@@ -0,0 +1,160 @@
+package hcat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcat/dep"
+)
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+	data, err := parseJSON(`{
+		"name": "app",
+		"ports": [80, 443, 8080],
+		"servers": [
+			{"host": "b.local", "weight": 2, "tags": ["web"]},
+			{"host": "a.local", "weight": 5, "tags": ["web", "db"]},
+			{"host": "c.local", "weight": 1, "tags": [], "backup": true}
+		],
+		"meta": {"z": 1, "a": 2},
+		"odd key": "x"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := []*dep.HealthService{
+		{Node: "n2", Address: "10.0.0.2", Port: 8080, Tags: dep.ServiceTags{"v2"}},
+		{Node: "n1", Address: "10.0.0.1", Port: 80, Tags: dep.ServiceTags{"v1"}},
+		{Node: "n3", Address: "10.0.0.3", Port: 9090, Tags: dep.ServiceTags{"v2"}},
+	}
+	secret := &dep.Secret{Data: map[string]interface{}{
+		"data": map[string]interface{}{"password": "s3cr3t"},
+	}}
+
+	tests := []struct {
+		name string
+		expr string
+		in   interface{}
+		want interface{}
+	}{
+		{"identity", ".", "x", "x"},
+		{"field", ".name", data, "app"},
+		{"quoted_field", `."odd key"`, data, "x"},
+		{"bracket_field", `.["odd key"]`, data, "x"},
+		{"missing_field", ".nope", data, nil},
+		{"nested_missing", ".nope.deeper[0]", data, nil},
+		{"index", ".ports[1]", data, float64(443)},
+		{"negative_index", ".ports[-1]", data, float64(8080)},
+		{"out_of_range", ".ports[10]", data, nil},
+		{"slice", ".ports[1:]", data, []interface{}{float64(443), float64(8080)}},
+		{"slice_string", ".name[:2]", data, "ap"},
+		{"iterate", ".ports[]", data, []interface{}{float64(80), float64(443), float64(8080)}},
+		{"iterate_map", ".meta[]", data, []interface{}{float64(2), float64(1)}},
+		{"iterate_nil", ".nope[]", data, []interface{}{}},
+		// streams are lists whatever their number of results
+		{"stream_none", ".ports[] | select(. > 9000)", data, []interface{}{}},
+		{"stream_one", ".ports[] | select(. == 443)", data, []interface{}{float64(443)}},
+		{"stream_many", ".ports[] | select(. > 80)", data,
+			[]interface{}{float64(443), float64(8080)}},
+		{"select_single", ".servers[0] | select(.weight > 1) | .host", data,
+			[]interface{}{"b.local"}},
+		{"select_single_none", ".servers[0] | select(.weight > 5) | .host", data,
+			[]interface{}{}},
+		{"pipe", ".servers[0] | .host", data, "b.local"},
+		{"collect", "[.servers[] | .host]", data,
+			[]interface{}{"b.local", "a.local", "c.local"}},
+		{"collect_empty", "[.servers[] | select(.weight > 10)]", data, []interface{}{}},
+		{"select", `[.servers[] | select(.weight >= 2 and .backup != true) | .host]`, data,
+			[]interface{}{"b.local", "a.local"}},
+		{"select_or", `[.servers[] | select(.backup or .weight == 5) | .host]`, data,
+			[]interface{}{"a.local", "c.local"}},
+		{"select_not", `[.servers[] | select(.backup | not) | .host]`, data,
+			[]interface{}{"b.local", "a.local"}},
+		{"sort_by", "[.servers | sort_by(.weight)[] | .host]", data,
+			[]interface{}{"c.local", "b.local", "a.local"}},
+		{"sort", "[.servers[].host] | sort | first", data, "a.local"},
+		{"reverse", ".ports | reverse", data,
+			[]interface{}{float64(8080), float64(443), float64(80)}},
+		{"unique", "[.servers[].tags[]] | unique", data, []interface{}{"db", "web"}},
+		{"map", ".servers | map(.weight) | last", data, float64(1)},
+		{"length", "[.ports, .name, .meta, .nope | length]", data, []interface{}{3, 3, 2, 0}},
+		{"keys", ".meta | keys", data, []interface{}{"a", "z"}},
+		{"has", `[.meta | has("a"), has("b")]`, data, []interface{}{true, false}},
+		{"join", `.servers | map(.host) | join(",")`, data, "b.local,a.local,c.local"},
+		{"object", "[.servers[] | {host, w: .weight}] | first", data,
+			map[string]interface{}{"host": "b.local", "w": float64(2)}},
+		{"object_product", `{a: (1, 2)} | .a`, nil, []interface{}{float64(1), float64(2)}},
+		{"comma", ".name, .ports[0]", data, []interface{}{"app", float64(80)}},
+		{"root", `.servers[] | select(.host == "a.local") | $.name`, data,
+			[]interface{}{"app"}},
+		{"literals", `[1.5, -2, "s", true, false, null]`, nil,
+			[]interface{}{1.5, float64(-2), "s", true, false, nil}},
+		{"services", `[.[] | select(.Port > 80) | .Address] | sort`, services,
+			[]interface{}{"10.0.0.2", "10.0.0.3"}},
+		{"services_sort_by", `sort_by(.Node) | map(.Port)`, services,
+			[]interface{}{80, 8080, 9090}},
+		{"services_tags", `[.[] | select(.Tags[0] == "v2") | .Node]`, services,
+			[]interface{}{"n2", "n3"}},
+		{"secret", ".Data.data.password", secret, "s3cr3t"},
+		{"nil_input", ".a.b", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := query(tt.expr, tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	t.Parallel()
+	services := []*dep.HealthService{{Node: "n1"}}
+	tests := []struct {
+		name string
+		expr string
+		in   interface{}
+		err  string
+	}{
+		{"empty", "", nil, `query "": col 1: empty query`},
+		{"unterminated_string", `."abc`, nil, `col 2: unterminated string`},
+		{"bad_character", ".a # b", nil, `col 4: unexpected character '#'`},
+		{"unexpected_token", ".a | | .b", nil, `col 6: unexpected |`},
+		{"unexpected_end", ".a |", nil, `col 5: unexpected end of query`},
+		{"unclosed_bracket", ".a[0", nil, `col 5: unexpected end of query`},
+		{"unknown_function", ".a | frob", nil, `col 6: unknown function "frob"`},
+		{"missing_argument", "select", nil, `col 7: unexpected end of query`},
+		{"bad_object_key", "{1: 2}", nil, `col 2: unexpected 1`},
+		{"no_such_field", ".[0].Nope", services,
+			`col 5: dep.HealthService has no field "Nope"`},
+		{"field_of_number", ".a.b", map[string]interface{}{"a": 1},
+			`col 3: cannot get field "b" of int`},
+		{"iterate_string", ".a[]", map[string]interface{}{"a": "x"},
+			`col 3: cannot iterate over string`},
+		{"bad_index", ".[1.5]", []int{1}, `col 2: expected an integer index, got 1.5`},
+		{"compare_types", `.[] | select(. > "a")`, []interface{}{1}, `col 16: cannot compare int and string`},
+		{"sort_map", ".a | sort", map[string]interface{}{"a": map[string]interface{}{}},
+			`col 6: sort: expected a list`},
+		{"length_bool", "length", true, `col 1: bool has no length`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := query(tt.expr, tt.in)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if _, ok := err.(*queryError); !ok {
+				t.Errorf("expected a *queryError, got %T", err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected %q in %q", tt.err, err)
+			}
+		})
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"github.com/hashicorp/hcat/dep"
 )
 
-// NOTE: the template functions are all tested in ./template_test.go and
-// the tests here are for ancillary code only.
+// NOTE: the template functions are mostly tested in ./template_test.go and
+// the tests here are for ancillary code and the collection helpers.
 
 func TestFileSandbox(t *testing.T) {
 	t.Parallel()
@@ -235,3 +235,116 @@ func Test_sha256Hex(t *testing.T) {
 		})
 	}
 }
+
+func TestCollectionFuncs(t *testing.T) {
+	t.Parallel()
+	type svc struct {
+		Name string
+		Port int
+	}
+	web := &svc{Name: "web", Port: 80}
+	api := &svc{Name: "api", Port: 8080}
+	db := &svc{Name: "db", Port: 5432}
+
+	tests := []struct {
+		name    string
+		fn      func() (interface{}, error)
+		want    interface{}
+		wantErr bool
+	}{
+		{"dict", func() (interface{}, error) { return dict("a", 1, "b", "two") },
+			map[string]interface{}{"a": 1, "b": "two"}, false},
+		{"dict_empty", func() (interface{}, error) { return dict() },
+			map[string]interface{}{}, false},
+		{"dict_odd", func() (interface{}, error) { return dict("a") }, nil, true},
+		{"dict_non_string_key", func() (interface{}, error) { return dict(1, 2) }, nil, true},
+		{"list", func() (interface{}, error) { return listFunc(1, "a") },
+			[]interface{}{1, "a"}, false},
+		{"list_empty", func() (interface{}, error) { return listFunc() },
+			[]interface{}{}, false},
+		{"append", func() (interface{}, error) { return appendFunc("c", []string{"a", "b"}) },
+			[]interface{}{"a", "b", "c"}, false},
+		{"append_nil", func() (interface{}, error) { return appendFunc("a", nil) },
+			[]interface{}{"a"}, false},
+		{"append_not_list", func() (interface{}, error) { return appendFunc("a", "b") }, nil, true},
+		{"keys", func() (interface{}, error) { return keys(map[string]int{"b": 1, "a": 2}) },
+			[]string{"a", "b"}, false},
+		{"keys_nil", func() (interface{}, error) { return keys(nil) }, []string{}, false},
+		{"keys_not_map", func() (interface{}, error) { return keys([]string{}) }, nil, true},
+		{"values", func() (interface{}, error) { return values(map[string]int{"b": 1, "a": 2}) },
+			[]interface{}{2, 1}, false},
+		{"values_nil", func() (interface{}, error) { return values(nil) }, []interface{}{}, false},
+		{"pluck_structs", func() (interface{}, error) { return pluck("Name", []*svc{web, nil, api}) },
+			[]interface{}{"web", "api"}, false},
+		{"pluck_maps", func() (interface{}, error) {
+			return pluck("a", []map[string]int{{"a": 1}, {"b": 2}, {"a": 3}})
+		}, []interface{}{1, 3}, false},
+		{"pluck_nil", func() (interface{}, error) { return pluck("a", nil) }, []interface{}{}, false},
+		{"uniq", func() (interface{}, error) { return uniq([]interface{}{"a", 1, "a", 2, 1}) },
+			[]interface{}{"a", 1, 2}, false},
+		{"uniq_nil", func() (interface{}, error) { return uniq(nil) }, []interface{}{}, false},
+		{"sortBy_string", func() (interface{}, error) { return sortBy("Name", []*svc{web, api, db}) },
+			[]interface{}{api, db, web}, false},
+		{"sortBy_number", func() (interface{}, error) { return sortBy("Port", []*svc{db, api, web}) },
+			[]interface{}{web, db, api}, false},
+		{"sortBy_missing_last", func() (interface{}, error) {
+			return sortBy("a", []map[string]interface{}{{"b": 1}, {"a": 2}, {"a": 1.5}})
+		}, []interface{}{
+			map[string]interface{}{"a": 1.5},
+			map[string]interface{}{"a": 2},
+			map[string]interface{}{"b": 1},
+		}, false},
+		{"sortBy_mixed", func() (interface{}, error) {
+			return sortBy("a", []map[string]interface{}{{"a": "x"}, {"a": 1}})
+		}, nil, true},
+		{"default_empty", func() (interface{}, error) { return defaultFunc("d", "") }, "d", false},
+		{"default_nil", func() (interface{}, error) { return defaultFunc("d", nil) }, "d", false},
+		{"default_zero", func() (interface{}, error) { return defaultFunc(5, 0) }, 5, false},
+		{"default_set", func() (interface{}, error) { return defaultFunc("d", "v") }, "v", false},
+		{"default_false", func() (interface{}, error) { return defaultFunc(true, false) }, true, false},
+		{"coalesce", func() (interface{}, error) { return coalesce(nil, "", []int{}, "a", "b") },
+			"a", false},
+		{"coalesce_none", func() (interface{}, error) { return coalesce(nil, "") }, nil, false},
+		{"ternary_true", func() (interface{}, error) { return ternary("t", "f", true) }, "t", false},
+		{"ternary_false", func() (interface{}, error) { return ternary("t", "f", false) }, "f", false},
+		{"first", func() (interface{}, error) { return first([]int{1, 2, 3}) }, 1, false},
+		{"first_empty", func() (interface{}, error) { return first([]int{}) }, nil, false},
+		{"first_nil", func() (interface{}, error) { return first(nil) }, nil, false},
+		{"last", func() (interface{}, error) { return last([]int{1, 2, 3}) }, 3, false},
+		{"last_nil", func() (interface{}, error) { return last(nil) }, nil, false},
+		{"sublist", func() (interface{}, error) { return sublist(1, 3, []int{1, 2, 3, 4}) },
+			[]int{2, 3}, false},
+		{"sublist_start", func() (interface{}, error) { return sublist(2, []int{1, 2, 3, 4}) },
+			[]int{3, 4}, false},
+		{"sublist_list_first", func() (interface{}, error) { return sublist([]int{1, 2, 3, 4}, 1, 3) },
+			nil, true},
+		{"sublist_string", func() (interface{}, error) { return sublist(1, "abc") }, "bc", false},
+		{"sublist_array", func() (interface{}, error) { return sublist(1, [3]int{1, 2, 3}) },
+			[]int{2, 3}, false},
+		{"sublist_clamped", func() (interface{}, error) { return sublist(-1, 10, []int{1, 2}) },
+			[]int{1, 2}, false},
+		{"sublist_start_after_end", func() (interface{}, error) { return sublist(2, 1, []int{1, 2}) },
+			[]int{}, false},
+		{"sublist_nil", func() (interface{}, error) { return sublist(1, nil) }, nil, false},
+		{"sublist_no_index", func() (interface{}, error) { return sublist([]int{1}) }, nil, true},
+		{"sublist_not_list", func() (interface{}, error) { return sublist(1, 2) }, nil, true},
+		{"trimPrefix", func() (interface{}, error) { return trimPrefix("v", "v1.2") }, "1.2", false},
+		{"trimSuffix", func() (interface{}, error) { return trimSuffix(".0", "1.0") }, "1", false},
+		{"repeat", func() (interface{}, error) { return repeat(3, "ab") }, "ababab", false},
+		{"repeat_negative", func() (interface{}, error) { return repeat(-1, "ab") }, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fn()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
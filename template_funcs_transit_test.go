@@ -0,0 +1,191 @@
+package hcat
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	idep "github.com/hashicorp/hcat/internal/dependency"
+)
+
+// fakeTransit is a fake Vault server with a Transit secrets engine. Its
+// ciphertexts include the number of the encryption, so they differ each
+// time as Vault's do.
+type fakeTransit struct {
+	sync.Mutex
+	requests map[string]int
+}
+
+func (f *fakeTransit) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// /v1/<mount>/<op>/<key>
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/v1/"), "/")
+	if len(parts) < 3 || (req.Method != "PUT" && req.Method != "POST") {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	mount := strings.Join(parts[:len(parts)-2], "/")
+	op, key := parts[len(parts)-2], parts[len(parts)-1]
+	var body map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.Lock()
+	f.requests[op]++
+	n := f.requests[op]
+	f.Unlock()
+
+	fail := func(msg string) {
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(rw, `{"errors":[%q]}`, msg)
+	}
+	prefix := fmt.Sprintf("vault:v1:%s/%s:", mount, key)
+	var data map[string]string
+	switch op {
+	case "encrypt":
+		data = map[string]string{
+			"ciphertext": fmt.Sprintf("%s%d:%s", prefix, n, body["plaintext"])}
+	case "decrypt":
+		if !strings.HasPrefix(body["ciphertext"], prefix) {
+			fail("invalid ciphertext")
+			return
+		}
+		rest := strings.TrimPrefix(body["ciphertext"], prefix)
+		data = map[string]string{"plaintext": rest[strings.Index(rest, ":")+1:]}
+	case "hmac":
+		data = map[string]string{"hmac": prefix + "hmac-" + body["input"]}
+	case "sign":
+		data = map[string]string{"signature": prefix + "sig-" + body["input"]}
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(rw).Encode(map[string]interface{}{"data": data})
+}
+
+func (f *fakeTransit) count(op string) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests[op]
+}
+
+func TestTransitFuncs(t *testing.T) {
+	fake := &fakeTransit{requests: map[string]int{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	newWatcher := func() *Watcher {
+		clients := NewClientSet()
+		if err := clients.AddVault(VaultInput{Address: srv.URL, Token: "token"}); err != nil {
+			t.Fatal(err)
+		}
+		return NewWatcher(WatcherInput{
+			Clients:             clients,
+			VaultErrorRetryFunc: NoRetry,
+		})
+	}
+	// resolve runs the template until it's complete, waiting for data
+	resolve := func(w *Watcher, tmpl *Template) (ResolveEvent, error) {
+		rv := NewResolver()
+		for i := 0; i < 5; i++ {
+			ev, err := rv.Run(tmpl, w)
+			if err != nil || ev.Complete {
+				return ev, err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			err = w.Wait(ctx)
+			cancel()
+			if err != nil {
+				return ev, err
+			}
+		}
+		return ResolveEvent{}, fmt.Errorf("template did not complete")
+	}
+
+	t.Run("functions", func(t *testing.T) {
+		w := newWatcher()
+		defer w.Close()
+		tmpl := NewTemplate(TemplateInput{Contents: `{{ $c := "s3cr3t" | transitEncrypt "app" }}` +
+			`{{ $c }}|{{ $c | transitDecrypt "app" }}|` +
+			`{{ "s3cr3t" | transitHMAC "keys/transit/app" }}|{{ "s3cr3t" | transitSign "app" }}|` +
+			`{{ "" | transitEncrypt "app" }}`})
+		ev, err := resolve(w, tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b64 := base64.StdEncoding.EncodeToString([]byte("s3cr3t"))
+		want := "vault:v1:transit/app:1:" + b64 + "|s3cr3t|" +
+			"vault:v1:keys/transit/app:hmac-" + b64 + "|vault:v1:transit/app:sig-" + b64 + "|"
+		if string(ev.Contents) != want {
+			t.Fatalf("got %q, want %q", ev.Contents, want)
+		}
+
+		res, err := tmpl.Execute(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range res.Used.List() {
+			if s := d.String(); strings.Contains(s, "s3cr3t") || strings.Contains(s, b64) {
+				t.Errorf("dependency exposes the input: %s", s)
+			}
+		}
+
+		// the results are fetched once, so the ciphertext doesn't change
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		w.Wait(ctx)
+		res, err = tmpl.Execute(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Output) != want {
+			t.Errorf("output changed to %q", res.Output)
+		}
+		for _, op := range []string{"encrypt", "decrypt", "hmac", "sign"} {
+			if n := fake.count(op); n != 1 {
+				t.Errorf("expected 1 %s request, got %d", op, n)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		w := newWatcher()
+		defer w.Close()
+		tmpl := NewTemplate(TemplateInput{
+			Contents: `{{ "vault:v1:other:1:eA==" | transitDecrypt "app" }}`})
+		_, err := resolve(w, tmpl)
+		if err == nil || !strings.Contains(err.Error(), "vault.transit(decrypt transit/app") ||
+			!strings.Contains(err.Error(), "invalid ciphertext") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("bad_result", func(t *testing.T) {
+		tmpl := NewTemplate(TemplateInput{Contents: `{{ "x" | transitEncrypt "app" }}`})
+		d, err := idep.NewVaultTransitQuery(idep.TransitEncrypt, "app", "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		st := NewStore()
+		st.Save(d.String(), 1)
+		_, err = tmpl.Execute(st)
+		if err == nil || !strings.Contains(err.Error(), "unexpected result int") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("invalid_key", func(t *testing.T) {
+		tmpl := NewTemplate(TemplateInput{Contents: `{{ "x" | transitEncrypt "" }}`})
+		if _, err := tmpl.Execute(NewStore()); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -1205,6 +1205,24 @@ func TestTemplate_Execute(t *testing.T) {
 			"map[foo:bar]",
 			false,
 		},
+		{
+			"helper_parseTOML",
+			TemplateInput{
+				Contents: `{{ "foo = \"bar\"" | parseTOML }}`,
+			},
+			NewStore(),
+			"map[foo:bar]",
+			false,
+		},
+		{
+			"helper_toDotenv",
+			TemplateInput{
+				Contents: `{{ ("[app]\nport = 80\nname = web app" | parseINI).app | toDotenv }}`,
+			},
+			NewStore(),
+			"name=\"web app\"\nport=80",
+			false,
+		},
 		{
 			"helper_parseUint",
 			TemplateInput{
@@ -1269,6 +1287,15 @@ func TestTemplate_Execute(t *testing.T) {
 			"true",
 			false,
 		},
+		{
+			"helper_query",
+			TemplateInput{
+				Contents: `{{ "{\"a\":[{\"n\":2},{\"n\":1}]}" | parseJSON | query "[.a[].n] | sort | join(\",\")" }}`,
+			},
+			NewStore(),
+			"1,2",
+			false,
+		},
 		{
 			"helper_regexReplaceAll",
 			TemplateInput{
@@ -1287,6 +1314,78 @@ func TestTemplate_Execute(t *testing.T) {
 			"bye my bye",
 			false,
 		},
+		{
+			"helper_cidr",
+			TemplateInput{
+				Contents: `{{ "10.0.0.0/16" | cidrSubnet 8 1 | cidrHost 1 }} {{ list "10.0.0.0/25" "10.0.0.128/25" | cidrMerge }} {{ "10.0.1.1" | cidrContains "10.0.0.0/16" }}`,
+			},
+			NewStore(),
+			"10.0.1.1 [10.0.0.0/24] true",
+			false,
+		},
+		{
+			"helper_pem",
+			TemplateInput{
+				Contents: `{{ $b := "-----BEGIN TEST-----\naGk=\n-----END TEST-----\n" }}{{ $b | pemToBase64 }} {{ $b | pemToDER }} {{ len (splitPEM (print $b $b)) }} {{ with parseCert "" }}x{{ end }}`,
+			},
+			NewStore(),
+			"aGk= hi 2 ",
+			false,
+		},
+		{
+			"helper_hmac_derive",
+			TemplateInput{
+				Contents: `{{ "what do ya want for nothing?" | hmacSHA256Hex "Jefe" }} {{ "seed" | derivePassword 16 "app" | len }} {{ eq ("s" | bcrypt 4 "web") ("s" | bcrypt 4 "web") }}`,
+			},
+			NewStore(),
+			"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843 16 true",
+			false,
+		},
+		{
+			"helper_collections",
+			TemplateInput{
+				Contents: `{{ $m := dict "b" 2 "a" 1 }}{{ keys $m }} {{ values $m }} {{ list "x" "y" "x" | append "z" | uniq | sublist 1 }}`,
+			},
+			NewStore(),
+			"[a b] [1 2] [y z]",
+			false,
+		},
+		{
+			"helper_sortBy_pluck",
+			TemplateInput{
+				Contents: `{{ list (dict "n" "b") (dict "n" "a") | sortBy "n" | pluck "n" | first }}`,
+			},
+			NewStore(),
+			"a",
+			false,
+		},
+		{
+			"helper_default",
+			TemplateInput{
+				Contents: `{{ "" | default "fallback" }} {{ coalesce "" 0 "x" }} {{ true | ternary "yes" "no" }}`,
+			},
+			NewStore(),
+			"fallback x yes",
+			false,
+		},
+		{
+			"builtin_slice",
+			TemplateInput{
+				Contents: `{{ slice "abcd" 1 3 }} {{ $l := list 1 2 3 }}{{ slice $l 1 2 3 }}`,
+			},
+			NewStore(),
+			"bc [2]",
+			false,
+		},
+		{
+			"builtin_slice_out_of_range",
+			TemplateInput{
+				Contents: `{{ slice (list 1 2 3) 5 }}`,
+			},
+			NewStore(),
+			"",
+			true,
+		},
 		{
 			"helper_split",
 			TemplateInput{
@@ -1541,3 +1640,53 @@ func TestTemplate_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplate_dataAge(t *testing.T) {
+	st := NewStore()
+	a, err := idep.NewKVGetQuery("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := idep.NewKVGetQuery("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Save(a.String(), "x")
+	st.Save(b.String(), "y")
+
+	// only the data used before dataAge counts
+	tpl := NewTemplate(TemplateInput{
+		Contents: `{{ key "a" }} {{ dataAge }} {{ key "b" }} {{ dataAge }}`,
+	})
+	cases := []struct {
+		name string
+		r    Recaller
+		e    string
+	}{
+		{"aged", agedStore{Store: st, ages: map[string]time.Duration{
+			a.String(): time.Second, b.String(): time.Minute}}, "x 1s y 1m0s"},
+		{"fresh", agedStore{Store: st}, "x 0s y 0s"},
+		{"no-ages", st, "x 0s y 0s"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tpl.Execute(tc.r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(res.Output) != tc.e {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.e, string(res.Output))
+			}
+		})
+	}
+}
+
+// agedStore is a Store with the ages of its data.
+type agedStore struct {
+	*Store
+	ages map[string]time.Duration
+}
+
+func (s agedStore) DataAge(id string) time.Duration {
+	return s.ages[id]
+}
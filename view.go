@@ -1,6 +1,7 @@
 package hcat
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -26,7 +27,16 @@ type view struct {
 	dataLock     sync.RWMutex
 	data         interface{}
 	receivedData bool
+	expired      bool // stale data was dropped
 	lastIndex    uint64
+	lastUpdate   time.Time
+	lastContact  time.Time
+
+	// retries and lastErr are the number of consecutive failed fetches and
+	// the most recent error returned from fetching. Both are cleared on the
+	// next successful contact with the upstream.
+	retries int
+	lastErr error
 
 	// blockWaitTime is amount of time in seconds to do a blocking query for
 	blockWaitTime time.Duration
@@ -34,15 +44,39 @@ type view struct {
 	// maxStale is the maximum amount of time to allow a query to be stale.
 	maxStale time.Duration
 
+	// staleMaxAge is how long the data keeps being served once fetching it
+	// fails, see WatcherInput.StaleOnErrorMaxAge. Zero disables it.
+	staleMaxAge time.Duration
+
 	// defaultLease is used for non-renewable leases when secret has no lease
 	defaultLease time.Duration
 
 	// retryFunc is the function to invoke on failure to determine if a retry
 	// should be attempted.
-	retryFunc RetryFunc
+	retryFunc ErrorRetryFunc
+
+	// permanentRetryFunc and authRetryFunc are used instead of retryFunc for
+	// permanent and auth errors (see dep.ErrorClass).
+	permanentRetryFunc ErrorRetryFunc
+	authRetryFunc      ErrorRetryFunc
+
+	// reauth re-authenticates the clients on auth errors, optional.
+	reauth *reauther
+
+	// limiter is shared by all views using the same upstream to limit the
+	// rate and concurrency of requests.
+	limiter *limiter
 
 	// stopCh is used to stop polling on this view
 	stopCh chan struct{}
+	// doneCh is closed once polling, including any in-flight fetch, has
+	// stopped.
+	doneCh chan struct{}
+
+	// ctx is passed to the dependency's fetch and is canceled on stop to
+	// abort any in-flight requests.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewViewInput is used as input to the NewView function.
@@ -63,18 +97,42 @@ type newViewInput struct {
 
 	// RetryFunc is a function which dictates how this view should retry on
 	// upstream errors.
-	RetryFunc RetryFunc
+	RetryFunc ErrorRetryFunc
+
+	// PermanentRetryFunc and AuthRetryFunc are used instead of RetryFunc for
+	// permanent and auth errors. Permanent errors are not retried if nil,
+	// auth errors use RetryFunc.
+	PermanentRetryFunc ErrorRetryFunc
+	AuthRetryFunc      ErrorRetryFunc
+
+	// Reauth re-authenticates the clients on auth errors, optional.
+	Reauth *reauther
+
+	// StaleMaxAge is how long to serve the last data on upstream errors.
+	StaleMaxAge time.Duration
+
+	// Limiter limits requests to the upstream, optional.
+	Limiter *limiter
 }
 
 // NewView constructs a new view with the given inputs.
 func newView(i *newViewInput) *view {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &view{
-		dependency:    i.Dependency,
-		clients:       i.Clients,
-		blockWaitTime: i.BlockWaitTime,
-		maxStale:      i.MaxStale,
-		retryFunc:     i.RetryFunc,
-		stopCh:        make(chan struct{}, 1),
+		dependency:         i.Dependency,
+		clients:            i.Clients,
+		blockWaitTime:      i.BlockWaitTime,
+		maxStale:           i.MaxStale,
+		staleMaxAge:        i.StaleMaxAge,
+		retryFunc:          i.RetryFunc,
+		permanentRetryFunc: i.PermanentRetryFunc,
+		authRetryFunc:      i.AuthRetryFunc,
+		reauth:             i.Reauth,
+		limiter:            i.Limiter,
+		stopCh:             make(chan struct{}, 1),
+		doneCh:             make(chan struct{}),
+		ctx:                ctx,
+		cancel:             cancel,
 	}
 }
 
@@ -99,18 +157,146 @@ func (v *view) DataAndLastIndex() (interface{}, uint64) {
 	return v.data, v.lastIndex
 }
 
+// received returns true if the view has data. It is false before the first
+// data and after stale data expired.
+func (v *view) received() bool {
+	v.dataLock.RLock()
+	defer v.dataLock.RUnlock()
+	return v.receivedData
+}
+
+// dataExpired returns true if the view's stale data was dropped, until new
+// data is received.
+func (v *view) dataExpired() bool {
+	v.dataLock.RLock()
+	defer v.dataLock.RUnlock()
+	return v.expired
+}
+
+// age returns how long the view's data has been stale, ie. the time since
+// the last successful contact with the upstream while fetching fails. It is
+// zero while the upstream is reachable.
+func (v *view) age() time.Duration {
+	v.dataLock.RLock()
+	defer v.dataLock.RUnlock()
+	if v.lastErr == nil || !v.receivedData {
+		return 0
+	}
+	return time.Since(v.lastContact)
+}
+
+// staleWait returns how long to wait before restarting the retries if the
+// view can keep serving its data after fetching it failed, or false if it
+// can't.
+func (v *view) staleWait() (time.Duration, bool) {
+	if v.staleMaxAge <= 0 || !v.received() {
+		return 0, false
+	}
+	remaining := v.staleMaxAge - v.age()
+	if remaining < 0 {
+		return 0, false
+	}
+	if remaining > staleRetryInterval {
+		remaining = staleRetryInterval
+	}
+	return remaining, true
+}
+
+// expireStale drops the view's data if it has been stale for longer than
+// the max age. Returns true if it did.
+func (v *view) expireStale() bool {
+	if v.staleMaxAge <= 0 || v.age() <= v.staleMaxAge {
+		return false
+	}
+	v.dataLock.Lock()
+	defer v.dataLock.Unlock()
+	v.data = nil
+	v.receivedData = false
+	v.expired = true
+	v.lastIndex = 0 // so the same data is sent again once fetched
+	return true
+}
+
+// retryFuncFor returns the ErrorRetryFunc for the class of error.
+func (v *view) retryFuncFor(class dep.ErrorClass) ErrorRetryFunc {
+	switch class {
+	case dep.ClassPermanent:
+		return v.permanentRetryFunc
+	case dep.ClassAuth:
+		if v.authRetryFunc != nil {
+			return v.authRetryFunc
+		}
+	}
+	return v.retryFunc
+}
+
+// viewStatus is a snapshot of the view's state used for introspection.
+type viewStatus struct {
+	lastIndex   uint64
+	lastUpdate  time.Time
+	lastContact time.Time
+	retries     int
+	err         error
+}
+
+// status returns a snapshot of the view's current state.
+func (v *view) status() viewStatus {
+	v.dataLock.RLock()
+	defer v.dataLock.RUnlock()
+	return viewStatus{
+		lastIndex:   v.lastIndex,
+		lastUpdate:  v.lastUpdate,
+		lastContact: v.lastContact,
+		retries:     v.retries,
+		err:         v.lastErr,
+	}
+}
+
+// setRetries records the retry state of the view.
+func (v *view) setRetries(retries int, err error) {
+	v.dataLock.Lock()
+	defer v.dataLock.Unlock()
+	v.retries = retries
+	v.lastErr = err
+}
+
 // poll queries the Consul instance for data using the fetch function, but also
 // accounts for interrupts on the interrupt channel. This allows the poll
 // function to be fired in a goroutine, but then halted even if the fetch
 // function is in the middle of a blocking query.
+//
+// When poll returns the fetch goroutine has exited and the view's doneCh is
+// closed.
 func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 	var retries int
+	var lastClass dep.ErrorClass
+	// firstFailure and lastSleep are the time of the first failure and the
+	// last sleep of the current retries, for the ErrorRetryFunc
+	var firstFailure time.Time
+	var lastSleep time.Duration
+	var fetchExitCh chan struct{}
+	// reconnect is true if the last fetch failed
+	var reconnect bool
+	defer func() {
+		if fetchExitCh != nil {
+			<-fetchExitCh
+		}
+		close(v.doneCh)
+	}()
 
 	for {
+		if fetchExitCh != nil {
+			<-fetchExitCh
+		}
 		doneCh := make(chan struct{}, 1)
 		successCh := make(chan struct{}, 1)
 		fetchErrCh := make(chan error, 1)
-		go v.fetch(doneCh, successCh, fetchErrCh)
+		fetchExitCh = make(chan struct{})
+		go func(exitCh chan struct{}, reconnect bool) {
+			defer close(exitCh)
+			v.fetch(doneCh, successCh, fetchErrCh, reconnect)
+		}(fetchExitCh, reconnect)
+		reconnect = false
 
 	WAIT:
 		select {
@@ -118,6 +304,7 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 			// Reset the retry to avoid exponentially incrementing retries when we
 			// have some successful requests
 			retries = 0
+			v.setRetries(0, nil)
 
 			//log.Printf("[TRACE] (view) %s received data", v.dependency)
 			select {
@@ -135,11 +322,42 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 			// actual template.
 			//log.Printf("[TRACE] (view) %s successful contact, resetting retries", v.dependency
 			retries = 0
+			v.setRetries(0, nil)
 			goto WAIT
 		case err := <-fetchErrCh:
-			if v.retryFunc != nil {
-				retry, sleep := v.retryFunc(retries)
+			reconnect = true
+			class := dep.ClassOf(err)
+			if class != lastClass {
+				// each class of errors is retried on its own
+				retries, lastClass = 0, class
+			}
+			if retries == 0 {
+				firstFailure, lastSleep = time.Now(), 0
+			}
+			if class == dep.ClassAuth {
+				if rerr := v.reauth.reauth(v.ctx, v.clients, err); rerr != nil {
+					err = fmt.Errorf("%w (re-authenticating: %v)", err, rerr)
+				}
+			}
+			v.setRetries(retries+1, err)
+			if v.expireStale() {
+				//log.Printf("[WARN] (view) %s stale data expired", v.dependency)
+				select {
+				case <-v.stopCh:
+					return
+				case viewCh <- v:
+				}
+			}
+			if retryFunc := v.retryFuncFor(class); retryFunc != nil {
+				retry, sleep := retryFunc(Retry{
+					Attempt:  retries,
+					Err:      err,
+					Elapsed:  time.Since(firstFailure),
+					Previous: lastSleep,
+				})
 				if retry {
+					lastSleep = sleep
+					sleep += v.limiter.reconnectJitter()
 					//log.Printf("[WARN] (view) %s (retry attempt %d after %q)",
 					//err, retries+1, sleep)
 					select {
@@ -152,6 +370,18 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 				}
 			}
 
+			if sleep, ok := v.staleWait(); ok {
+				//log.Printf("[WARN] (view) %s (serving stale data after %q)",
+				//v.dependency, err)
+				select {
+				case <-time.After(sleep):
+					retries = 0
+					continue
+				case <-v.stopCh:
+					return
+				}
+			}
+
 			//log.Printf("[ERR] (view) %s (exceeded maximum retries)", err)
 
 			// Push the error back up to the watcher
@@ -173,7 +403,7 @@ func (v *view) poll(viewCh chan<- *view, errCh chan<- error) {
 // written to errCh. It is designed to be run in a goroutine that selects the
 // result of doneCh and errCh. It is assumed that only one instance of fetch
 // is running per view and therefore no locking or mutexes are used.
-func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
+func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error, reconnect bool) {
 	//log.Printf("[TRACE] (view) %s starting fetch", v.dependency)
 
 	var allowStale bool
@@ -192,17 +422,38 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 
 		start := time.Now() // for rateLimiter below
 
+		// Only the requests before the first data and reconnects take an
+		// in-flight slot of the limiter. They don't block on the server, as
+		// reconnects don't send the wait index, and free the slot once they
+		// start waiting, so waiting views don't hold slots.
+		limited := v.lastIndex == 0 || reconnect
+		reconnect = false
+		waitIndex := v.lastIndex
+		ctx := v.ctx
+		var freeOnce sync.Once
+		freeSlot := func() { freeOnce.Do(v.limiter.freeSlot) }
+		if limited {
+			waitIndex = 0
+			ctx = idep.WithWaitFunc(ctx, freeSlot)
+		}
 		if d, ok := v.dependency.(idep.QueryOptionsSetter); ok {
 			d.SetOptions(idep.QueryOptions{
 				AllowStale:   allowStale,
 				WaitTime:     v.blockWaitTime,
-				WaitIndex:    v.lastIndex,
+				WaitIndex:    waitIndex,
 				DefaultLease: v.defaultLease,
 			})
 		}
-		data, rm, err := v.dependency.Fetch(v.clients)
+		if !v.limiter.acquire(v.stopCh, limited) {
+			return
+		}
+		data, rm, err := dep.FetchContext(ctx, v.dependency, v.clients)
+		if limited {
+			freeSlot()
+		}
+		v.limiter.release()
 		if err != nil {
-			if err == dep.ErrStopped {
+			if err == dep.ErrStopped || v.ctx.Err() != nil {
 				//log.Printf("[TRACE] (view) %s reported stop", v.dependency)
 			} else {
 				errCh <- err
@@ -220,6 +471,9 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		// trigger a data update (because we could continue below), but we need to
 		// inform the poller to reset the retry count.
 		//log.Printf("[TRACE] (view) %s marking successful data response", v.dependency)
+		v.dataLock.Lock()
+		v.lastContact = time.Now()
+		v.dataLock.Unlock()
 		select {
 		case successCh <- struct{}{}:
 		default:
@@ -236,7 +490,11 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		}
 
 		if dur := rateLimiter(start); dur > 1 {
-			time.Sleep(dur)
+			select {
+			case <-time.After(dur):
+			case <-v.stopCh:
+				return
+			}
 		}
 
 		if rm.LastIndex == v.lastIndex {
@@ -268,6 +526,8 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 
 		v.data = data
 		v.receivedData = true
+		v.expired = false
+		v.lastUpdate = time.Now()
 		v.dataLock.Unlock()
 
 		close(doneCh)
@@ -277,6 +537,10 @@ func (v *view) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 
 const minDelayBetweenUpdates = time.Millisecond * 100
 
+// staleRetryInterval is the longest a view serving stale data waits before
+// restarting its retries.
+const staleRetryInterval = time.Second * 10
+
 // return a duration to sleep to limit the frequency of upstream calls
 func rateLimiter(start time.Time) time.Duration {
 	remaining := minDelayBetweenUpdates - time.Since(start)
@@ -289,6 +553,7 @@ func rateLimiter(start time.Time) time.Duration {
 
 // stop halts polling of this view.
 func (v *view) stop() {
+	v.cancel()
 	v.dependency.Stop()
 	close(v.stopCh)
 }
@@ -1,6 +1,9 @@
 package hcat
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
@@ -77,9 +80,7 @@ func TestPoll_stopsViewStopCh(t *testing.T) {
 func TestPoll_retries(t *testing.T) {
 	vw := newView(&newViewInput{
 		Dependency: &dep.FakeDepRetry{},
-		RetryFunc: func(retry int) (bool, time.Duration) {
-			return retry < 1, 250 * time.Millisecond
-		},
+		RetryFunc:  RetryMaxAttempts(1, RetryConstant(250*time.Millisecond)),
 	})
 
 	viewCh := make(chan *view)
@@ -106,6 +107,100 @@ func TestPoll_retries(t *testing.T) {
 	}
 }
 
+func TestPoll_retryInput(t *testing.T) {
+	var got []Retry
+	vw := newView(&newViewInput{
+		Dependency: &dep.FakeDepFetchError{},
+		RetryFunc: func(r Retry) (bool, time.Duration) {
+			got = append(got, r)
+			return r.Attempt < 2, 10 * time.Millisecond
+		},
+	})
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	select {
+	case <-errCh:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timeout")
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(got))
+	}
+	for i, r := range got {
+		if r.Attempt != i || r.Err == nil {
+			t.Errorf("bad retry %d: %#v", i, r)
+		}
+	}
+	if got[0].Previous != 0 || got[2].Previous != 10*time.Millisecond {
+		t.Errorf("bad previous sleeps: %#v", got)
+	}
+	if got[2].Elapsed < 20*time.Millisecond {
+		t.Errorf("expected elapsed time of the retries, got %s", got[2].Elapsed)
+	}
+	if status := vw.status(); status.retries != 3 || status.err == nil {
+		t.Errorf("expected 3 failed fetches, got %#v", status)
+	}
+}
+
+func TestPoll_staleOnError(t *testing.T) {
+	d := &outageDep{}
+	vw := newView(&newViewInput{
+		Dependency:  d,
+		StaleMaxAge: 300 * time.Millisecond,
+		RetryFunc:   RetryMaxAttempts(1, RetryConstant(10*time.Millisecond)),
+	})
+
+	viewCh := make(chan *view)
+	errCh := make(chan error)
+
+	go vw.poll(viewCh, errCh)
+	defer vw.stop()
+
+	select {
+	case <-viewCh:
+	case err := <-errCh:
+		t.Fatalf("error while polling: %s", err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the retries are exhausted but the data is served
+	select {
+	case <-viewCh:
+		t.Fatal("data should not have expired yet")
+	case err := <-errCh:
+		t.Fatalf("error while serving stale data: %s", err)
+	case <-time.After(150 * time.Millisecond):
+	}
+	if !vw.received() || vw.age() == 0 {
+		t.Fatalf("expected stale data, received: %v, age: %s",
+			vw.received(), vw.age())
+	}
+
+	// the data expires, then the error is returned
+	select {
+	case <-viewCh:
+	case err := <-errCh:
+		t.Fatalf("error before the data expired: %s", err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	if !vw.dataExpired() || vw.received() || vw.Data() != nil {
+		t.Fatal("expected the data to be dropped")
+	}
+	select {
+	case <-errCh:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
 func TestFetch_resetRetries(t *testing.T) {
 	view := newView(&newViewInput{
 		Dependency: &dep.FakeDepSameIndex{},
@@ -115,7 +210,7 @@ func TestFetch_resetRetries(t *testing.T) {
 	successCh := make(chan struct{}, 1)
 	errCh := make(chan error, 1)
 
-	go view.fetch(doneCh, successCh, errCh)
+	go view.fetch(doneCh, successCh, errCh, false)
 
 	select {
 	case <-successCh:
@@ -136,7 +231,7 @@ func TestFetch_maxStale(t *testing.T) {
 	successCh := make(chan struct{})
 	errCh := make(chan error)
 
-	go view.fetch(doneCh, successCh, errCh)
+	go view.fetch(doneCh, successCh, errCh, false)
 
 	select {
 	case <-doneCh:
@@ -158,7 +253,7 @@ func TestFetch_savesView(t *testing.T) {
 	successCh := make(chan struct{})
 	errCh := make(chan error)
 
-	go view.fetch(doneCh, successCh, errCh)
+	go view.fetch(doneCh, successCh, errCh, false)
 
 	select {
 	case <-doneCh:
@@ -180,7 +275,7 @@ func TestFetch_returnsErrCh(t *testing.T) {
 	successCh := make(chan struct{})
 	errCh := make(chan error)
 
-	go view.fetch(doneCh, successCh, errCh)
+	go view.fetch(doneCh, successCh, errCh, false)
 
 	select {
 	case <-doneCh:
@@ -214,6 +309,98 @@ func TestStop_stopsPolling(t *testing.T) {
 	}
 }
 
+// blockingConsulServer blocks all requests but the leader check done on
+// client creation, like long blocking queries, until the client gives up or
+// for 5 seconds.
+// The channels are closed once a request is made and once it is canceled.
+func blockingConsulServer() (srv *httptest.Server, requestCh, canceledCh chan struct{}) {
+	requestCh = make(chan struct{})
+	canceledCh = make(chan struct{})
+	srv = httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/v1/status/leader" {
+				rw.Write([]byte(`"127.0.0.1:8300"`))
+				return
+			}
+			close(requestCh)
+			select {
+			case <-req.Context().Done():
+				close(canceledCh)
+			case <-time.After(5 * time.Second):
+			}
+		}))
+	return srv, requestCh, canceledCh
+}
+
+func TestFetchContext_cancelsRequest(t *testing.T) {
+	srv, requestCh, canceledCh := blockingConsulServer()
+	defer srv.Close()
+
+	clients := NewClientSet()
+	if err := clients.AddConsul(ConsulInput{Address: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetOptions(dep.QueryOptions{WaitIndex: 1, WaitTime: time.Minute})
+
+	// called directly, the request can only be canceled by the context
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := d.FetchContext(ctx, clients)
+		errCh <- err
+	}()
+	select {
+	case <-requestCh:
+	case <-time.After(time.Second):
+		t.Fatal("request not made")
+	}
+	cancel()
+	select {
+	case <-canceledCh:
+	case <-time.After(time.Second):
+		t.Fatal("in-flight request not canceled")
+	}
+	if err := <-errCh; err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestStop_cancelsFetch(t *testing.T) {
+	srv, requestCh, canceledCh := blockingConsulServer()
+	defer srv.Close()
+
+	clients := NewClientSet()
+	if err := clients.AddConsul(ConsulInput{Address: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vw := newView(&newViewInput{
+		Dependency:    d,
+		Clients:       clients,
+		BlockWaitTime: time.Minute,
+	})
+	go vw.poll(make(chan *view), make(chan error))
+
+	select {
+	case <-requestCh:
+	case <-time.After(time.Second):
+		t.Fatal("request not made")
+	}
+	vw.stop()
+	select {
+	case <-canceledCh:
+	case <-time.After(time.Second):
+		t.Fatal("in-flight request not canceled on stop")
+	}
+}
+
 func TestRateLimiter(t *testing.T) {
 	// test for rate limiting delay working
 	elapsed := minDelayBetweenUpdates / 2 // simulate time passing
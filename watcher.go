@@ -2,6 +2,8 @@ package hcat
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,11 +16,13 @@ import (
 const dataBufferSize = 2048
 
 // RetryFunc defines the function type used to determine how many and how often
-// to retry calls to the external services.
+// to retry calls to the external services. See ErrorRetryFunc for the
+// error-aware version and its constructors.
 type RetryFunc func(int) (bool, time.Duration)
 
 // Cacher defines the interface required by the watcher for caching data
-// retreived from external services. It is implemented by Store.
+// retreived from external services. It is implemented by Store and
+// BoundedStore.
 type Cacher interface {
 	Save(key string, value interface{})
 	Recall(key string) (value interface{}, found bool)
@@ -45,6 +49,13 @@ type Watcher struct {
 
 	// changed is a list of deps that have been changed since last check
 	changed stringSet
+	// changes and triggered are the dependency changes and the triggered
+	// templates of the last Wait, indexes the last index of each dependency.
+	// See changeset.go.
+	changes   map[string]DependencyChange
+	triggered map[string]struct{}
+	indexes   map[string]uint64
+	changesMx sync.Mutex
 	// tracker tracks template<->dependencies (see bottom of this file)
 	depTracker *tracker
 	// olddepCh is the chan where no longer used dependencies are sent.
@@ -53,6 +64,19 @@ type Watcher struct {
 	// depViewMap is a map of Dependency-IDs to Views.
 	depViewMap   map[string]*view
 	depViewMapMx sync.Mutex
+	// polling is the set of views with a running poll goroutine, including
+	// views already stopped but not yet exited. Protected by depViewMapMx.
+	polling map[*view]struct{}
+
+	// subs are the subscribers by dependency ID, see subscribe.go.
+	subs   map[string]map[*subscription]struct{}
+	subsMx sync.Mutex
+
+	// kvGroups and kvKeys track KV key lookups coalesced into a single KV
+	// list query, see kv_coalesce.go. Both are protected by depViewMapMx.
+	kvGroups            map[string]*kvGroup
+	kvKeys              map[string]*kvGroup
+	kvCoalesceThreshold int
 
 	// bufferTemplates manages the buffer period per template to accumulate
 	// dependency changes.
@@ -62,16 +86,31 @@ type Watcher struct {
 	bufferTrigger chan string
 
 	// Consul related
-	retryFuncConsul RetryFunc
+	retryFuncConsul ErrorRetryFunc
+	// reauthConsul re-authenticates the Consul client on auth errors
+	reauthConsul *reauther
+	// limiterConsul limits the requests of all Consul views
+	limiterConsul *limiter
 	// blockWaitTime is how long to block on consul's blocking queries
 	blockWaitTime time.Duration
 	// maxStale passed to consul to control staleness
 	maxStale time.Duration
 
 	// Vault related
-	retryFuncVault RetryFunc
+	retryFuncVault ErrorRetryFunc
+	// reauthVault re-authenticates the Vault client on auth errors
+	reauthVault *reauther
+	// limiterVault limits the requests of all Vault views
+	limiterVault *limiter
 	// defaultLease is used for non-renewable leases when secret has no lease
 	defaultLease time.Duration
+
+	// staleMaxAge is how long to serve data whose upstream fails
+	staleMaxAge time.Duration
+
+	// retry functions for permanent and auth errors, see dep.ErrorClass
+	retryFuncPermanent ErrorRetryFunc
+	retryFuncAuth      ErrorRetryFunc
 }
 
 type WatcherInput struct {
@@ -85,6 +124,13 @@ type WatcherInput struct {
 	VaultDefaultLease time.Duration
 	// RetryFun for Vault
 	VaultRetryFunc RetryFunc
+	// ErrorRetryFunc for Vault, takes precedence over VaultRetryFunc. If
+	// neither is set DefaultRetryFunc is used, NoRetry disables retries.
+	VaultErrorRetryFunc ErrorRetryFunc
+	// RateLimit limits requests to Vault across all dependencies
+	VaultRateLimit RateLimitInput
+	// ReauthFunc is called on Vault auth errors to re-authenticate
+	VaultReauthFunc ReauthFunc
 
 	// Optional Consul specific parameters
 	// MaxStale is the max time Consul will return a stale value.
@@ -93,6 +139,36 @@ type WatcherInput struct {
 	ConsulBlockWait time.Duration
 	// RetryFun for Consul
 	ConsulRetryFunc RetryFunc
+	// ErrorRetryFunc for Consul, takes precedence over ConsulRetryFunc. If
+	// neither is set DefaultRetryFunc is used, NoRetry disables retries.
+	ConsulErrorRetryFunc ErrorRetryFunc
+	// RateLimit limits requests to Consul across all dependencies
+	ConsulRateLimit RateLimitInput
+	// ReauthFunc is called on Consul auth errors to re-authenticate
+	ConsulReauthFunc ReauthFunc
+	// KVCoalesceThreshold is the number of KV keys sharing a parent path
+	// that triggers watching them all with a single KV list query.
+	// Zero disables coalescing.
+	ConsulKVCoalesceThreshold int
+
+	// StaleOnErrorMaxAge enables serving stale data on upstream errors. A
+	// view that exhausts its retries keeps serving its last data, restarting
+	// its retries, until it has been stale for longer than this. The data is
+	// then dropped, so the templates wait on it as missing, and the error is
+	// returned by Wait as usual if the upstream still fails. Zero disables it.
+	// See DataAge and the dataAge template function.
+	StaleOnErrorMaxAge time.Duration
+
+	// Fetch errors are classified as transient, permanent or auth errors
+	// (see dep.ErrorClass). Transient errors are retried with the upstream's
+	// retry function above.
+	// PermanentErrorRetryFunc is used for permanent errors, eg. a missing
+	// Vault secret. They are not retried if nil.
+	PermanentErrorRetryFunc ErrorRetryFunc
+	// AuthErrorRetryFunc is used for auth errors, eg. permission denied,
+	// after calling the upstream's ReauthFunc. Defaults to the upstream's
+	// retry function.
+	AuthErrorRetryFunc ErrorRetryFunc
 }
 
 type drainableChan chan struct{}
@@ -120,36 +196,47 @@ func NewWatcher(i WatcherInput) *Watcher {
 
 	bufferTriggerCh := make(chan string, dataBufferSize/2)
 	w := &Watcher{
-		clients:         clients,
-		cache:           cache,
-		dataCh:          make(chan *view, dataBufferSize),
-		errCh:           make(chan error),
-		olddepCh:        make(chan string, dataBufferSize),
-		waitingCh:       make(chan struct{}),
-		stopCh:          make(chan struct{}, 1),
-		changed:         newStringSet(),
-		depTracker:      newTracker(),
-		depViewMap:      make(map[string]*view),
-		bufferTrigger:   bufferTriggerCh,
-		bufferTemplates: newTimers(),
-		retryFuncConsul: i.ConsulRetryFunc,
-		maxStale:        i.ConsulMaxStale,
-		blockWaitTime:   i.ConsulBlockWait,
-		retryFuncVault:  i.VaultRetryFunc,
-		defaultLease:    i.VaultDefaultLease,
-	}
-
-	go w.bufferTemplates.Run(bufferTriggerCh)
+		clients:             clients,
+		cache:               cache,
+		dataCh:              make(chan *view, dataBufferSize),
+		errCh:               make(chan error),
+		olddepCh:            make(chan string, dataBufferSize),
+		waitingCh:           make(chan struct{}),
+		stopCh:              make(chan struct{}, 1),
+		changed:             newStringSet(),
+		changes:             make(map[string]DependencyChange),
+		triggered:           make(map[string]struct{}),
+		indexes:             make(map[string]uint64),
+		depTracker:          newTracker(),
+		depViewMap:          make(map[string]*view),
+		polling:             make(map[*view]struct{}),
+		subs:                make(map[string]map[*subscription]struct{}),
+		kvGroups:            make(map[string]*kvGroup),
+		kvKeys:              make(map[string]*kvGroup),
+		bufferTrigger:       bufferTriggerCh,
+		bufferTemplates:     newTimers(),
+		retryFuncConsul:     retryFuncOf(i.ConsulErrorRetryFunc, i.ConsulRetryFunc),
+		reauthConsul:        newReauther(i.ConsulReauthFunc),
+		limiterConsul:       newLimiter(i.ConsulRateLimit),
+		kvCoalesceThreshold: i.ConsulKVCoalesceThreshold,
+		maxStale:            i.ConsulMaxStale,
+		blockWaitTime:       i.ConsulBlockWait,
+		retryFuncVault:      retryFuncOf(i.VaultErrorRetryFunc, i.VaultRetryFunc),
+		reauthVault:         newReauther(i.VaultReauthFunc),
+		limiterVault:        newLimiter(i.VaultRateLimit),
+		defaultLease:        i.VaultDefaultLease,
+		staleMaxAge:         i.StaleOnErrorMaxAge,
+		retryFuncPermanent:  i.PermanentErrorRetryFunc,
+		retryFuncAuth:       i.AuthErrorRetryFunc,
+	}
 
 	return w
 }
 
-const vaultTokenDummyTemplateID = "dummy.watcher.vault-token.id"
-
 // WatchVaultToken takes a vault token and watches it to keep it updated.
-// This is a specialized method as this token can be required without being in
-// a template. I hope to generalize this idea so you can watch arbitrary
-// dependencies in the future.
+// The token is subscribed to, as it is required without being in a
+// template, and its updates are discarded. See Subscribe to watch other
+// dependencies outside of templates.
 func (w *Watcher) WatchVaultToken(token string) error {
 	// Start a watcher for the Vault renew if that config was specified
 	if token != "" {
@@ -157,9 +244,8 @@ func (w *Watcher) WatchVaultToken(token string) error {
 		if err != nil {
 			return errors.Wrap(err, "watcher")
 		}
-		w.Add(vt)
-		// prevent cleanDeps from removing it
-		w.Register(vaultTokenDummyTemplateID, vt)
+		// never canceled, the subscription keeps it watched until Stop
+		w.Subscribe(vt)
 	}
 	return nil
 }
@@ -167,7 +253,7 @@ func (w *Watcher) WatchVaultToken(token string) error {
 // WaitCh returns an error channel and runs Wait sending the result down
 // the channel. Useful for when you need to use Wait in a select block.
 func (w *Watcher) WaitCh(ctx context.Context) <-chan error {
-	errCh := make(chan error)
+	errCh := make(chan error, 1) // buffered so the goroutine always exits
 	go func() {
 		errCh <- w.Wait(ctx)
 	}()
@@ -175,10 +261,11 @@ func (w *Watcher) WaitCh(ctx context.Context) <-chan error {
 }
 
 // Wait blocks until new a watched value changes or until context is closed
-// or exceeds its deadline.
+// or exceeds its deadline. Use WaitChanges to also get what changed.
 func (w *Watcher) Wait(ctx context.Context) error {
 	w.changed.Clear() // clear old updates before waiting on new ones
-	w.stopCh.drain()  // in case Stop was already called
+	w.resetChanges()
+	w.stopCh.drain() // in case Stop was already called
 
 	cleanStop := make(chan struct{})
 	defer close(cleanStop) // only run while waiting
@@ -195,8 +282,18 @@ func (w *Watcher) Wait(ctx context.Context) error {
 	// combine cache and changed updates so we don't forget one
 	dataUpdate := func(v *view) {
 		id := v.Dependency().String()
-		w.cache.Save(id, v.Data())
+		if v.dataExpired() {
+			w.cache.Delete(id)
+			w.changed.Add(id)
+			w.recordChange(id, 0)
+			return
+		}
+		data, index := v.DataAndLastIndex()
+		w.cache.Save(id, data)
 		w.changed.Add(id)
+		w.recordChange(id, index)
+		w.notify(id, data, index)
+		w.fanOutKV(id, data, index)
 	}
 	for {
 		select {
@@ -214,13 +311,15 @@ func (w *Watcher) Wait(ctx context.Context) error {
 				}
 			}
 
-		case <-w.bufferTrigger:
+		case id := <-w.bufferTrigger:
 			// A template is now ready to be rendered, though there might be a
 			// few ready around the same time if they have the same dependencies.
 			// Drain the channel similar for the dataCh above.
+			w.recordTrigger(id)
 			for {
 				select {
-				case <-w.bufferTrigger:
+				case id := <-w.bufferTrigger:
+					w.recordTrigger(id)
 				case <-time.After(time.Microsecond):
 					return nil
 				}
@@ -254,13 +353,19 @@ func (w *Watcher) Wait(ctx context.Context) error {
 func (w *Watcher) cleanDeps(done chan struct{}) {
 	// get all dependencies
 	w.depViewMapMx.Lock()
-	deps := make([]string, 0, len(w.depViewMap))
+	deps := make([]string, 0, len(w.depViewMap)+len(w.kvKeys))
 	for k := range w.depViewMap {
 		deps = append(deps, k)
 	}
+	for k := range w.kvKeys {
+		deps = append(deps, k)
+	}
 	w.depViewMapMx.Unlock()
 	// remove any no longer used
 	for k := range w.depTracker.findUnused(deps) {
+		if w.subscribed(k) {
+			continue
+		}
 		w.remove(k)
 		select {
 		case <-done:
@@ -277,14 +382,30 @@ func (w *Watcher) Register(tmplID string, deps ...dep.Dependency) {
 	if len(deps) > 0 {
 		w.depTracker.update(tmplID, deps...)
 	}
+	// Caches tracking ownership can hold data no view keeps up to date, so
+	// watch all registered dependencies and not just those missing data.
+	if _, ok := w.cache.(cacheOwner); ok {
+		for _, d := range deps {
+			w.Add(d)
+		}
+	}
+}
+
+// Deregister forgets the dependencies registered for the templates, eg. when
+// they are dropped on a reload. Dependencies no longer used by any template
+// are removed on the next Wait. A template registered again is seen as new,
+// so Changed returns true for it.
+func (w *Watcher) Deregister(tmplIDs ...string) {
+	for _, id := range tmplIDs {
+		w.depTracker.forget(id)
+	}
 }
 
 // Changed is used to check a template to see if any of its dependencies
 // have been updated (changed).
 // Returns True if template dependencies have changed.
 func (w *Watcher) Changed(tmplID string) bool {
-	deps, initialized := w.depTracker.templateDeps(tmplID)
-	if !initialized { // first pass, always return true
+	if !w.depTracker.initialized(tmplID) { // first pass, always return true
 		return true
 	}
 
@@ -296,12 +417,7 @@ func (w *Watcher) Changed(tmplID string) bool {
 		return true
 	}
 
-	for depID := range w.changed.Map() {
-		if _, ok := deps[depID]; ok {
-			return true
-		}
-	}
-	return false
+	return w.depTracker.usesAny(tmplID, w.changed.Map())
 }
 
 // Buffer sets the template to activate buffer and accumulate changes for a
@@ -310,8 +426,7 @@ func (w *Watcher) Changed(tmplID string) bool {
 // period.
 func (w *Watcher) Buffer(tmplID string) bool {
 	// first pass skips buffering.
-	_, initialized := w.depTracker.templateDeps(tmplID)
-	if !initialized {
+	if !w.depTracker.initialized(tmplID) {
 		return false
 	}
 
@@ -333,30 +448,80 @@ func (w *Watcher) Add(d dep.Dependency) bool {
 		//log.Printf("[TRACE] (watcher) %s already exists, skipping", d)
 		return false
 	}
+	if _, ok := w.kvKeys[d.String()]; ok {
+		return false
+	}
+
+	if kv, ok := d.(*idep.KVGetQuery); ok && w.coalesceKV(kv) {
+		return true
+	}
+
+	w.startView(d)
+	return true
+}
 
+// startView creates and starts polling a view for the dependency.
+// The caller must hold the depViewMapMx lock.
+func (w *Watcher) startView(d dep.Dependency) *view {
 	// Choose the correct retry function based off of the dependency's type.
-	var retryFunc RetryFunc
+	var retryFunc ErrorRetryFunc
+	var limiter *limiter
+	var reauth *reauther
 	switch d.(type) {
 	case idep.ConsulType:
 		retryFunc = w.retryFuncConsul
+		limiter = w.limiterConsul
+		reauth = w.reauthConsul
 	case idep.VaultType:
 		retryFunc = w.retryFuncVault
+		limiter = w.limiterVault
+		reauth = w.reauthVault
 	}
 
 	v := newView(&newViewInput{
-		Dependency:    d,
-		Clients:       w.clients,
-		MaxStale:      w.maxStale,
-		BlockWaitTime: w.blockWaitTime,
-		RetryFunc:     retryFunc,
+		Dependency:         d,
+		Clients:            w.clients,
+		MaxStale:           w.maxStale,
+		BlockWaitTime:      w.blockWaitTime,
+		RetryFunc:          retryFunc,
+		PermanentRetryFunc: w.retryFuncPermanent,
+		AuthRetryFunc:      w.retryFuncAuth,
+		Reauth:             reauth,
+		StaleMaxAge:        w.staleMaxAge,
+		Limiter:            limiter,
 	})
 
 	//log.Printf("[TRACE] (watcher) %s starting", d)
 
 	w.depViewMap[d.String()] = v
-	go v.poll(w.dataCh, w.errCh)
+	w.own(d)
+	w.polling[v] = struct{}{}
+	go func() {
+		v.poll(w.dataCh, w.errCh)
+		w.depViewMapMx.Lock()
+		delete(w.polling, v)
+		w.depViewMapMx.Unlock()
+	}()
 
-	return true
+	return v
+}
+
+// own marks the dependency's cache entry as owned, if the cache tracks
+// ownership.
+func (w *Watcher) own(d dep.Dependency) {
+	if c, ok := w.cache.(cacheOwner); ok {
+		c.Own(d.String())
+	}
+}
+
+// dropCache drops the dependency's data from the cache. Caches tracking
+// ownership keep the data, now unowned, and evict it as needed.
+func (w *Watcher) dropCache(id string) {
+	if c, ok := w.cache.(cacheOwner); ok {
+		c.Disown(id)
+		return
+	}
+	w.cache.Delete(id)
 }
 
 // Wrap embedded cache's Recaller interface
@@ -364,21 +529,60 @@ func (w *Watcher) Recall(id string) (interface{}, bool) {
 	return w.cache.Recall(id)
 }
 
+// DataAge returns how long the dependency's data has been stale, ie. the
+// time since the last successful contact with its upstream while fetching
+// it fails. It is zero while the upstream is reachable. See
+// WatcherInput.StaleOnErrorMaxAge.
+func (w *Watcher) DataAge(id string) time.Duration {
+	w.depViewMapMx.Lock()
+	v, ok := w.depViewMap[id]
+	if g, coalesced := w.kvKeys[id]; coalesced {
+		v, ok = g.view, g.view != nil
+	}
+	w.depViewMapMx.Unlock()
+	if !ok {
+		return 0
+	}
+	return v.age()
+}
+
+// snapshotter is implemented by Cachers that can take snapshots, like Store.
+type snapshotter interface {
+	Snapshot() *Snapshot
+}
+
+// Snapshot returns an immutable view of the cached data, used to render
+// templates consistently (see Resolver.RunBatch). Returns nil if the cache
+// doesn't support snapshots.
+func (w *Watcher) Snapshot() *Snapshot {
+	if c, ok := w.cache.(snapshotter); ok {
+		return c.Snapshot()
+	}
+	return nil
+}
+
 // SetBufferPeriod sets a buffer period to accumulate dependency changes for
 // a template.
 func (w *Watcher) SetBufferPeriod(min, max time.Duration, tmplIDs ...string) {
 	for _, id := range tmplIDs {
 		w.bufferTemplates.Add(min, max, id)
 	}
+	if len(tmplIDs) > 0 {
+		w.bufferTemplates.Start(w.bufferTrigger)
+	}
 }
 
 // Stop halts this watcher and any currently polling views immediately. If a
 // view was in the middle of a poll, no data will be returned.
-func (w *Watcher) Stop() {
+//
+// Stop then waits for all of the watcher's goroutines (views and their
+// in-flight fetches, buffer period timers) to exit, returning an error if
+// the context is done first. A stopped watcher can still be used; Wait and
+// Add work as they do on a new watcher.
+func (w *Watcher) Stop(ctx context.Context) error {
 	w.depViewMapMx.Lock()
-	defer w.depViewMapMx.Unlock()
 
-	w.bufferTemplates.Stop()
+	buffersDone := w.bufferTemplates.Stop()
 
 	//log.Printf("[DEBUG] (watcher) stopping all views")
 
@@ -389,22 +593,88 @@ func (w *Watcher) Stop() {
 		//log.Printf("[TRACE] (watcher) stopping %s", view.Dependency())
 		view.stop()
 	}
+	polling := make([]*view, 0, len(w.polling))
+	for v := range w.polling {
+		polling = append(polling, v)
+	}
+
+	// Empty cache, caches tracking ownership keep the data unowned so it
+	// can be reused by the next views (eg. after a reload).
+	if c, ok := w.cache.(cacheOwner); ok {
+		for id := range w.depViewMap {
+			c.Disown(id)
+		}
+		for id := range w.kvKeys {
+			c.Disown(id)
+		}
+	} else if w.cache != nil {
+		w.cache.Reset()
+	}
+	w.resetIndexes()
 
 	// Reset the map to have no views
 	w.depViewMap = make(map[string]*view)
+	w.kvGroups = make(map[string]*kvGroup)
+	w.kvKeys = make(map[string]*kvGroup)
 
 	w.stopCh.drain() // So calling Stop twice doesn't block
 	w.stopCh <- struct{}{}
 
-	// Empty cache
-	if w.cache != nil {
-		w.cache.Reset()
-	}
-
 	// Close any idle TCP connections
 	if w.clients != nil {
 		w.clients.Stop()
 	}
+	w.depViewMapMx.Unlock()
+
+	w.closeSubscriptions()
+
+	select {
+	case <-buffersDone:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "watcher: stop: buffer periods")
+	}
+	var running []string
+	for _, v := range polling {
+		select {
+		case <-v.doneCh:
+			continue
+		case <-ctx.Done():
+		}
+		if !isDone(v.doneCh) {
+			running = append(running, v.Dependency().String())
+		}
+	}
+	if len(running) > 0 {
+		sort.Strings(running)
+		return errors.Wrapf(ctx.Err(), "watcher: stop: %d views still running: %s",
+			len(running), strings.Join(running, ", "))
+	}
+	return nil
+}
+
+// Close stops the watcher, waiting for all of its goroutines to exit.
+func (w *Watcher) Close() error {
+	return w.Stop(context.Background())
+}
+
+// isDone returns true if the channel is closed.
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// ConsulStats returns the statistics on requests made to Consul.
+func (w *Watcher) ConsulStats() RequestStats {
+	return w.limiterConsul.stats()
+}
+
+// VaultStats returns the statistics on requests made to Vault.
+func (w *Watcher) VaultStats() RequestStats {
+	return w.limiterVault.stats()
 }
 
 // Size returns the number of views this watcher is watching.
@@ -424,7 +694,15 @@ func (w *Watcher) remove(id string) bool {
 
 	//log.Printf("[DEBUG] (watcher) removing %s", id)
 
-	defer w.cache.Delete(id)
+	if w.removeKV(id) {
+		return true
+	}
+	if w.kvInUse(id) {
+		return false
+	}
+
+	defer w.dropCache(id)
+	defer w.forgetIndex(id)
 
 	if view, ok := w.depViewMap[id]; ok {
 		//log.Printf("[TRACE] (watcher) actually removing %s", id)
@@ -443,7 +721,100 @@ func (w *Watcher) Watching(id string) bool {
 	defer w.depViewMapMx.Unlock()
 
 	_, ok := w.depViewMap[id]
-	return ok
+	_, coalesced := w.kvKeys[id]
+	return ok || coalesced
+}
+
+// DependencyStatus is a read-only snapshot of the state of a dependency
+// known to the Watcher, either by being watched or by being registered as
+// used by a template.
+type DependencyStatus struct {
+	// ID is the dependency's ID (its String() value).
+	ID string
+	// Templates is the sorted list of IDs of templates that use the dependency.
+	Templates []string
+	// Watching is true if there is an active view polling for the dependency.
+	Watching bool
+	// LastIndex is the last index returned by the upstream service.
+	LastIndex uint64
+	// LastUpdated is the time the dependency's data last changed. It is zero
+	// if no data has been received.
+	LastUpdated time.Time
+	// LastContact is the time of the last successful response from the
+	// upstream service, whether or not the data changed.
+	LastContact time.Time
+	// Retries is the number of consecutive failed fetches being retried.
+	Retries int
+	// Err is the most recent error fetching the dependency. It is cleared on
+	// the next successful contact with the upstream.
+	Err error
+	// Cached is true if data for the dependency is currently in the cache.
+	Cached bool
+}
+
+// TemplateIDs returns the sorted IDs of all templates that have registered
+// their dependencies with the Watcher.
+func (w *Watcher) TemplateIDs() []string {
+	return w.depTracker.templateIDs()
+}
+
+// TemplateDependencies returns the sorted IDs of the dependencies used by the
+// given template, ie. what the template is waiting on.
+func (w *Watcher) TemplateDependencies(tmplID string) []string {
+	return w.depTracker.templateDeps(tmplID)
+}
+
+// DependencyTemplates returns the sorted IDs of the templates that use the
+// given dependency.
+func (w *Watcher) DependencyTemplates(depID string) []string {
+	return w.depTracker.depTemplates(depID)
+}
+
+// DependencyStatus returns the current status of the given dependency.
+func (w *Watcher) DependencyStatus(depID string) DependencyStatus {
+	status := DependencyStatus{
+		ID:        depID,
+		Templates: w.depTracker.depTemplates(depID),
+	}
+
+	w.depViewMapMx.Lock()
+	view, ok := w.depViewMap[depID]
+	if g, coalesced := w.kvKeys[depID]; coalesced {
+		view, ok = g.view, g.view != nil
+	}
+	w.depViewMapMx.Unlock()
+	if ok {
+		vs := view.status()
+		status.Watching = true
+		status.LastIndex = vs.lastIndex
+		status.LastUpdated = vs.lastUpdate
+		status.LastContact = vs.lastContact
+		status.Retries = vs.retries
+		status.Err = vs.err
+	}
+
+	_, status.Cached = w.cache.Recall(depID)
+	return status
+}
+
+// Dependencies returns the status of all dependencies that are either being
+// watched or registered as used by a template, sorted by ID.
+func (w *Watcher) Dependencies() []DependencyStatus {
+	ids := w.depTracker.depIDs()
+	w.depViewMapMx.Lock()
+	for id := range w.depViewMap {
+		ids[id] = struct{}{}
+	}
+	for id := range w.kvKeys {
+		ids[id] = struct{}{}
+	}
+	w.depViewMapMx.Unlock()
+
+	result := make([]DependencyStatus, 0, len(ids))
+	for _, id := range sortedKeys(ids) {
+		result = append(result, w.DependencyStatus(id))
+	}
+	return result
 }
 
 ///////////
@@ -489,6 +860,14 @@ func (t *tracker) clear(tmplID string) {
 	}
 }
 
+// forget removes the template, it will be treated as new (uninitialized).
+func (t *tracker) forget(tmplID string) {
+	t.clear(tmplID)
+	t.Lock()
+	defer t.Unlock()
+	delete(t.tpls, tmplID)
+}
+
 func (t *tracker) findUnused(depIDs []string) map[string]struct{} {
 	t.RLock()
 	defer t.RUnlock()
@@ -501,9 +880,60 @@ func (t *tracker) findUnused(depIDs []string) map[string]struct{} {
 	return result
 }
 
-func (t *tracker) templateDeps(tmplID string) (map[string]struct{}, bool) {
+// initialized returns true if the template's dependencies are tracked.
+func (t *tracker) initialized(tmplID string) bool {
+	t.RLock()
+	defer t.RUnlock()
+	_, ok := t.tpls[tmplID]
+	return ok
+}
+
+// usesAny returns true if the template depends on any of the dependencies.
+func (t *tracker) usesAny(tmplID string, depIDs map[string]struct{}) bool {
 	t.RLock()
 	defer t.RUnlock()
-	deps, ok := t.tpls[tmplID]
-	return deps, ok
+	deps := t.tpls[tmplID]
+	for depID := range depIDs {
+		if _, ok := deps[depID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// templateDeps returns the sorted IDs of the template's dependencies.
+func (t *tracker) templateDeps(tmplID string) []string {
+	t.RLock()
+	defer t.RUnlock()
+	return sortedKeys(t.tpls[tmplID])
+}
+
+func (t *tracker) templateIDs() []string {
+	t.RLock()
+	defer t.RUnlock()
+	result := make([]string, 0, len(t.tpls))
+	for tmplID := range t.tpls {
+		result = append(result, tmplID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (t *tracker) depTemplates(depID string) []string {
+	t.RLock()
+	defer t.RUnlock()
+	return sortedKeys(t.deps[depID])
+}
+
+// depIDs returns the set of all dependencies used by any template.
+func (t *tracker) depIDs() map[string]struct{} {
+	t.RLock()
+	defer t.RUnlock()
+	result := make(map[string]struct{}, len(t.deps))
+	for depID, tmpls := range t.deps {
+		if len(tmpls) > 0 {
+			result[depID] = struct{}{}
+		}
+	}
+	return result
 }
@@ -3,7 +3,9 @@ package hcat
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,7 +17,7 @@ import (
 func TestWatcherAdd(t *testing.T) {
 	t.Run("updates-map", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		d := &idep.FakeDep{}
 		if added := w.Add(d); !added {
@@ -28,7 +30,7 @@ func TestWatcherAdd(t *testing.T) {
 	})
 	t.Run("exists", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		d := &idep.FakeDep{}
 		if added := w.Add(d); !added {
@@ -40,7 +42,7 @@ func TestWatcherAdd(t *testing.T) {
 	})
 	t.Run("startsViewPoll", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		if added := w.Add(&idep.FakeDep{}); !added {
 			t.Errorf("expected add to return true")
@@ -58,7 +60,7 @@ func TestWatcherAdd(t *testing.T) {
 func TestWatcherWatching(t *testing.T) {
 	t.Run("not-exists", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		d := &idep.FakeDep{}
 		if w.Watching(d.String()) == true {
@@ -68,7 +70,7 @@ func TestWatcherWatching(t *testing.T) {
 
 	t.Run("exists", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		d := &idep.FakeDep{}
 		w.Add(d)
@@ -82,7 +84,7 @@ func TestWatcherWatching(t *testing.T) {
 func TestWatcherRemove(t *testing.T) {
 	t.Run("exists", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		d := &idep.FakeDep{}
 		w.Add(d)
@@ -99,7 +101,7 @@ func TestWatcherRemove(t *testing.T) {
 
 	t.Run("does-not-exist", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		var fd idep.FakeDep
 		removed := w.remove(fd.String())
@@ -109,10 +111,44 @@ func TestWatcherRemove(t *testing.T) {
 	})
 }
 
+func TestWatcherDeregister(t *testing.T) {
+	w := newWatcher(t)
+	defer w.Close()
+
+	foo, bar := &idep.FakeDep{Name: "foo"}, &idep.FakeDep{Name: "bar"}
+	w.Register("tmpl-a", foo, bar)
+	w.Register("tmpl-b", foo)
+	if w.Changed("tmpl-a") {
+		t.Fatal("expected no changes")
+	}
+
+	w.Deregister("tmpl-a")
+	if !w.Changed("tmpl-a") {
+		t.Error("expected a deregistered template to be new")
+	}
+	if tmpls := w.DependencyTemplates(bar.String()); len(tmpls) != 0 {
+		t.Error("expected no templates for bar, got:", tmpls)
+	}
+
+	w.Add(foo)
+	w.Add(bar)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 3 && w.Watching(bar.String()); i++ {
+		w.Wait(ctx) // removes unused dependencies
+	}
+	if w.Watching(bar.String()) {
+		t.Error("expected unused dependency to be removed")
+	}
+	if !w.Watching(foo.String()) {
+		t.Error("expected dependency still in use to be watched")
+	}
+}
+
 func TestWatcherVaultToken(t *testing.T) {
 	t.Run("empty-token", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		err := w.WatchVaultToken("")
 		if err != nil {
 			t.Fatal("Didn't expect and error:", err)
@@ -123,7 +159,7 @@ func TestWatcherVaultToken(t *testing.T) {
 	})
 	t.Run("token-added", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		err := w.WatchVaultToken("fake-token")
 		if err != nil {
 			t.Fatal("Didn't expect and error:", err)
@@ -136,7 +172,7 @@ func TestWatcherVaultToken(t *testing.T) {
 	})
 	t.Run("not-cleaned", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		err := w.WatchVaultToken("fake-token")
 		if err != nil {
 			t.Fatal("Didn't expect and error:", err)
@@ -156,7 +192,7 @@ func TestWatcherVaultToken(t *testing.T) {
 func TestWatcherSize(t *testing.T) {
 	t.Run("empty", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		if w.Size() != 0 {
 			t.Errorf("expected %d to be %d", w.Size(), 0)
@@ -165,7 +201,7 @@ func TestWatcherSize(t *testing.T) {
 
 	t.Run("returns-num-views", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		for i := 0; i < 10; i++ {
 			d := &idep.FakeDep{Name: fmt.Sprintf("%d", i)}
@@ -181,7 +217,7 @@ func TestWatcherSize(t *testing.T) {
 func TestWatcherWait(t *testing.T) {
 	t.Run("timeout", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		t1 := time.Now()
 		ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond*100)
 		defer cancel()
@@ -196,7 +232,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("deadline", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		t1 := time.Now()
 		ctx, cancel := context.WithDeadline(context.Background(),
 			time.Now().Add(time.Microsecond*100))
@@ -212,7 +248,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("cancel", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		errCh := make(chan error)
 		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
@@ -233,7 +269,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("0-timeout", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		t1 := time.Now()
 		testerr := errors.New("test")
 		go func() {
@@ -248,7 +284,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("error", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		testerr := errors.New("test")
 		go func() {
 			w.errCh <- testerr
@@ -260,7 +296,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("remove-old-dependency", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		d := &idep.FakeDep{}
 		w.Add(d)
 		if !w.Watching(d.String()) {
@@ -274,7 +310,7 @@ func TestWatcherWait(t *testing.T) {
 	// Test cache updates
 	t.Run("simple-update", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		foodep := &idep.FakeDep{Name: "foo"}
 		view := newView(&newViewInput{
 			Dependency: foodep,
@@ -288,7 +324,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("multi-update", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		deps := make([]dep.Dependency, 5)
 		views := make([]*view, 5)
 		for i := 0; i < 5; i++ {
@@ -314,7 +350,7 @@ func TestWatcherWait(t *testing.T) {
 	// test tracking of updated dependencies
 	t.Run("simple-updated-tracking", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		foodep := &idep.FakeDep{Name: "foo"}
 		view := newView(&newViewInput{
 			Dependency: foodep,
@@ -327,7 +363,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("multi-updated-tracking", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		deps := make([]dep.Dependency, 5)
 		views := make([]*view, 5)
 		for i := 0; i < 5; i++ {
@@ -348,7 +384,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("duplicate-updated-tracking", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		for i := 0; i < 2; i++ {
 			foodep := &idep.FakeDep{Name: "foo"}
 			view := newView(&newViewInput{
@@ -363,7 +399,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("wait-channel", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 		foodep := &idep.FakeDep{Name: "foo"}
 		view := newView(&newViewInput{
 			Dependency: foodep,
@@ -380,7 +416,7 @@ func TestWatcherWait(t *testing.T) {
 	})
 	t.Run("wait-channel-cancel", func(t *testing.T) {
 		w := newWatcher(t)
-		defer w.Stop()
+		defer w.Close()
 
 		errCh := make(chan error)
 		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
@@ -408,7 +444,7 @@ func TestWatcherWait(t *testing.T) {
 		leaked := make(chan bool, 1)
 		defer close(leaked)
 		<-w.waitingCh
-		w.Stop()
+		w.Stop(context.Background())
 		select {
 		case <-errCh:
 			leaked <- false
@@ -422,7 +458,7 @@ func TestWatcherWait(t *testing.T) {
 	t.Run("wait-stop-order", func(t *testing.T) {
 		w := newWatcher(t)
 		// can Stop can be run before Wait and have Wait work correctly
-		w.Stop()
+		w.Stop(context.Background())
 		errCh := make(chan error)
 		go func() {
 			errCh <- w.Wait(context.Background())
@@ -439,7 +475,171 @@ func TestWatcherWait(t *testing.T) {
 		if ok := <-bad_stop; ok {
 			t.Fatal("Stop->Wait shouldn't stop Wait")
 		}
-		w.Stop()
+		w.Stop(context.Background())
+	})
+}
+
+func TestWatcherStaleOnError(t *testing.T) {
+	w := NewWatcher(WatcherInput{
+		Clients:            NewClientSet(),
+		Cache:              NewStore(),
+		StaleOnErrorMaxAge: 200 * time.Millisecond,
+	})
+	defer w.Close()
+	d := &outageDep{}
+	w.Register("tmpl", d)
+	w.Add(d)
+
+	if err := w.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.Recall(d.String()); !ok {
+		t.Fatal("expected data")
+	}
+
+	// the stale data is served until it expires, then it's missing
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Wait(ctx); err != nil {
+		t.Fatal("expected the data to expire, got:", err)
+	}
+	if _, ok := w.changed.Map()[d.String()]; !ok {
+		t.Fatal("expected the dependency to be changed")
+	}
+	if _, ok := w.Recall(d.String()); ok {
+		t.Fatal("expected expired data to be missing")
+	}
+	if age := w.DataAge(d.String()); age != 0 {
+		t.Fatal("expected no age without data, got:", age)
+	}
+
+	// the error is returned as without stale data
+	if err := w.Wait(ctx); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// outageDep returns data once, then fails as during an upstream outage.
+type outageDep struct {
+	idep.FakeDep
+	fetched int32
+}
+
+func (d *outageDep) Fetch(dep.Clients) (interface{}, *dep.ResponseMetadata, error) {
+	if atomic.AddInt32(&d.fetched, 1) > 1 {
+		return nil, nil, fmt.Errorf("upstream unavailable")
+	}
+	return "foo", &dep.ResponseMetadata{LastIndex: 1}, nil
+}
+
+func (d *outageDep) String() string {
+	return "outage_dep"
+}
+
+func TestWatcherGraph(t *testing.T) {
+	t.Run("template-dependencies", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+
+		foo, bar := &idep.FakeDep{Name: "foo"}, &idep.FakeDep{Name: "bar"}
+		w.Register("tmpl-a", foo, bar)
+		w.Register("tmpl-b", foo)
+
+		ids := w.TemplateIDs()
+		if !reflect.DeepEqual(ids, []string{"tmpl-a", "tmpl-b"}) {
+			t.Fatal("bad template ids:", ids)
+		}
+		deps := w.TemplateDependencies("tmpl-a")
+		if !reflect.DeepEqual(deps, []string{bar.String(), foo.String()}) {
+			t.Fatal("bad template dependencies:", deps)
+		}
+		tmpls := w.DependencyTemplates(foo.String())
+		if !reflect.DeepEqual(tmpls, []string{"tmpl-a", "tmpl-b"}) {
+			t.Fatal("bad dependency templates:", tmpls)
+		}
+		if tmpls := w.DependencyTemplates("nope"); len(tmpls) != 0 {
+			t.Fatal("expected no templates, got:", tmpls)
+		}
+	})
+	t.Run("template-dependencies-concurrent", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+
+		foo, bar := &idep.FakeDep{Name: "foo"}, &idep.FakeDep{Name: "bar"}
+		w.Register("tmpl", foo)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				w.Register("tmpl", foo, bar)
+				w.Register("tmpl", foo)
+			}
+		}()
+		for !isDone(done) {
+			w.TemplateDependencies("tmpl")
+		}
+	})
+	t.Run("dependency-status", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+
+		foo := &idep.FakeDep{Name: "foo"}
+		w.Register("tmpl", foo)
+		status := w.DependencyStatus(foo.String())
+		if status.Watching || status.Cached || status.LastIndex != 0 {
+			t.Fatalf("bad status: %#v", status)
+		}
+
+		w.Add(foo)
+		w.Wait(context.Background())
+		status = w.DependencyStatus(foo.String())
+		switch {
+		case !status.Watching:
+			t.Error("expected to be watching")
+		case !status.Cached:
+			t.Error("expected to be cached")
+		case status.LastIndex != 1:
+			t.Error("bad last index:", status.LastIndex)
+		case status.LastUpdated.IsZero():
+			t.Error("expected last updated time")
+		case status.Err != nil:
+			t.Error("unexpected error:", status.Err)
+		case !reflect.DeepEqual(status.Templates, []string{"tmpl"}):
+			t.Error("bad templates:", status.Templates)
+		}
+	})
+	t.Run("dependency-error", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+
+		d := &idep.FakeDepFetchError{Name: "foo"}
+		w.Register("tmpl", d)
+		w.Add(d)
+		if err := w.Wait(context.Background()); err == nil {
+			t.Fatal("expected an error")
+		}
+		status := w.DependencyStatus(d.String())
+		if status.Err == nil {
+			t.Fatal("expected error status")
+		}
+	})
+	t.Run("dependencies", func(t *testing.T) {
+		w := newWatcher(t)
+		defer w.Close()
+
+		foo, bar := &idep.FakeDep{Name: "foo"}, &idep.FakeDep{Name: "bar"}
+		w.Register("tmpl", foo)
+		w.Add(bar)
+		all := w.Dependencies()
+		if len(all) != 2 {
+			t.Fatal("expected 2 dependencies, got:", len(all))
+		}
+		if all[0].ID != bar.String() || !all[0].Watching {
+			t.Errorf("bad status: %#v", all[0])
+		}
+		if all[1].ID != foo.String() || all[1].Watching {
+			t.Errorf("bad status: %#v", all[1])
+		}
 	})
 }
 